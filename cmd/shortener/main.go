@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"os"
+
 	"github.com/gtgaleevtimur/reduction-url-service/internal/app"
 )
 
@@ -13,6 +16,13 @@ var (
 )
 
 func main() {
+	// Команда импорта URL из других сервисов сокращения URL.
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := app.Import(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	fmt.Println("Build version:", buildVersion)
 	fmt.Println("Build date:", buildDate)
 	fmt.Println("Build commit:", buildCommit)
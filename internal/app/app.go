@@ -13,42 +13,74 @@ import (
 	"golang.org/x/crypto/acme/autocert"
 	"google.golang.org/grpc"
 
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/events"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/grpcserv"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/handler"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
 )
 
 // Run - функция собирающая все компоненты сервиса воедино.
 func Run() {
-	// Инициализация хранилища приложения.
-	storage, err := repository.NewDataSource()
+	// Инициализация шины событий URL и хранилища приложения, публикующего в нее события.
+	bus := events.NewBus()
+	storage, err := repository.NewDataSource(repository.WithEvents(bus))
 	if err != nil {
 		log.Fatal(err)
 	}
 	// Инициализация и запуск сервера.
-	startServer(storage)
+	startServer(storage, bus)
 }
 
 // startServer - запускает сервер с настройками из конфигурационного файла.
-func startServer(storage repository.Storager) {
+func startServer(storage repository.Storager, bus *events.Bus) {
 	// Конфигурационный файл-одиночка.
 	conf := config.NewConfig()
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer cancel()
+	// Квоты на создание URL общие для HTTP и gRPC серверов.
+	quotas := quota.New(conf)
+	// Ключи подписи токенов пользователей и разрешенные API ключи общие для HTTP и gRPC серверов.
+	keys, err := auth.Load(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiKeys, err := auth.LoadAPIKeys(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Ошибки настройки HTTP сервера проверяются до запуска серверов.
+	router, err := handler.NewRouter(storage, conf, handler.WithQuota(quotas), handler.WithEvents(bus), handler.WithKeyring(keys), handler.WithAPIKeys(apiKeys))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Окончание срока действия URL проверяется периодически.
+	if conf.ExpiryCheckInterval > 0 {
+		go repository.WatchExpired(ctx, storage, bus, conf.ExpiryCheckInterval)
+	}
 
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(grpcserv.MyUnaryInterceptor))
+	// Ограничение частоты вызовов выполняется до аутентификации, пока доступен адрес клиента.
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		grpcserv.RateLimitInterceptor(ratelimit.NewLimiters(conf), conf, keys, apiKeys),
+		grpcserv.IdempotencyInterceptor(conf, keys),
+		grpcserv.MyUnaryInterceptor(keys),
+	))
 
 	if conf.EnableGRPC {
-		go startGRPC(storage, conf, grpcServer, cancel)
+		go startGRPC(storage, conf, quotas, keys, apiKeys, grpcServer, cancel)
 	}
 
 	if !conf.EnableHTTPS {
 		server := &http.Server{
 			Addr:    conf.ServerAddress,
-			Handler: handler.NewRouter(storage, conf),
+			Handler: router,
 		}
 
+		// Потоки событий не завершаются сами, поэтому при остановке сервера подписки отменяются.
+		server.RegisterOnShutdown(bus.Close)
 		go gracefulShutdown(ctx, server, grpcServer)
 
 		err := server.ListenAndServe()
@@ -65,10 +97,12 @@ func startServer(storage repository.Storager) {
 		}
 		server := &http.Server{
 			Addr:      ":443",
-			Handler:   handler.NewRouter(storage, conf),
+			Handler:   router,
 			TLSConfig: manager.TLSConfig(),
 		}
 
+		// Потоки событий не завершаются сами, поэтому при остановке сервера подписки отменяются.
+		server.RegisterOnShutdown(bus.Close)
 		go gracefulShutdown(ctx, server, grpcServer)
 
 		err := server.ListenAndServeTLS("server.crt", "server.key")
@@ -99,13 +133,13 @@ func gracefulShutdown(ctx context.Context, server *http.Server, grpcServer *grpc
 }
 
 // startGRPC - запуск grpc сервера.
-func startGRPC(storage repository.Storager, conf *config.Config, grpcServer *grpc.Server, cancel context.CancelFunc) {
+func startGRPC(storage repository.Storager, conf *config.Config, quotas *quota.Quota, keys *auth.Keyring, apiKeys auth.APIKeys, grpcServer *grpc.Server, cancel context.CancelFunc) {
 	listen, err := net.Listen("tcp", ":0")
 	if err != nil {
 		cancel()
 		log.Fatal(err.Error())
 	}
-	proto.RegisterShortenerServer(grpcServer, grpcserv.New(storage, conf))
+	proto.RegisterShortenerServer(grpcServer, grpcserv.New(storage, conf, grpcserv.WithQuota(quotas), grpcserv.WithKeyring(keys), grpcserv.WithAPIKeys(apiKeys)))
 	log.Println("gRPC server start at:", listen.Addr().String())
 	if err = grpcServer.Serve(listen); err != nil {
 		cancel()
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/importer"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// Import - команда shortener import --format=<format> --user=<userid> [file ...], переносящая URL из экспортов
+// других сервисов сокращения URL в хранилище сервиса. Без файлов экспорт читается из стандартного ввода.
+// Хранилище выбирается по переменным окружения, как при запуске сервиса. Ошибки записей выводятся
+// в stderr и не прерывают импорт, итог выводится в stdout.
+func Import(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "export format: "+strings.Join(importer.Formats, ", "))
+	user := fs.String("user", "", "owner user id of imported URLs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *user == "" {
+		return errors.New("import: --user is required")
+	}
+	// Формат проверяется до подключения к хранилищу.
+	if err := importer.CheckFormat(*format); err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	storage, err := repository.NewDataSource()
+	if err != nil {
+		return err
+	}
+	conf := config.NewConfig()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+	im := importer.Importer{
+		Storage: storage,
+		UserID:  *user,
+		Timeout: conf.WriteTimeout,
+		Short:   conf.ExpShortURL,
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var total importer.Summary
+	for _, name := range files {
+		summary, err := importFile(ctx, im, *format, name)
+		total.Imported += summary.Imported
+		total.Failed += summary.Failed
+		if err != nil {
+			return fmt.Errorf("import %s: %w", name, err)
+		}
+	}
+	fmt.Printf("imported %d, failed %d\n", total.Imported, total.Failed)
+	return nil
+}
+
+// importFile - импортирует экспорт из файла name, "-" - стандартный ввод.
+func importFile(ctx context.Context, im importer.Importer, format string, name string) (importer.Summary, error) {
+	in := io.Reader(os.Stdin)
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return importer.Summary{}, err
+		}
+		defer file.Close()
+		in = file
+	}
+	src, err := importer.NewReader(format, in)
+	if err != nil {
+		return importer.Summary{}, err
+	}
+	return im.Run(ctx, src, func(result importer.Result) error {
+		if result.Error != "" {
+			fmt.Fprintf(os.Stderr, "%s: record %d %s: %s\n", name, result.Record, result.URL, result.Error)
+		}
+		return nil
+	})
+}
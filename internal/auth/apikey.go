@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+)
+
+// apiKeyHashPrefix - префикс хеша SHA-256 API ключа в настройках.
+const apiKeyHashPrefix = "sha256:"
+
+// APIKeys - набор разрешенных API ключей клиентов, ключи хранятся в виде хешей SHA-256.
+type APIKeys map[[sha256.Size]byte]struct{}
+
+// LoadAPIKeys - создает набор API ключей из настройки APIKeys: ключей или их хешей SHA-256 в hex
+// с префиксом sha256: через запятую.
+func LoadAPIKeys(c *config.Config) (APIKeys, error) {
+	keys := make(APIKeys)
+	for _, key := range strings.Split(c.APIKeys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if !strings.HasPrefix(key, apiKeyHashPrefix) {
+			keys[sha256.Sum256([]byte(key))] = struct{}{}
+			continue
+		}
+		b, err := hex.DecodeString(strings.TrimPrefix(key, apiKeyHashPrefix))
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid API key hash %q", key)
+		}
+		var sum [sha256.Size]byte
+		copy(sum[:], b)
+		keys[sum] = struct{}{}
+	}
+	return keys, nil
+}
+
+// Identify - проверяет API ключ key и возвращает его идентификатор - хеш ключа, по которому учитываются
+// квоты и частота запросов клиента. Если ключ не разрешен, то возвращает false.
+func (a APIKeys) Identify(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(key))
+	if _, ok := a[sum]; !ok {
+		return "", false
+	}
+	return hex.EncodeToString(sum[:]), true
+}
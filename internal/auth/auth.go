@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"google.golang.org/grpc/metadata"
+)
+
+// Способы передачи токена пользователя. Токен один для HTTP и gRPC серверов, поэтому пользователь видит
+// одни и те же URL через любой из них.
+const (
+	Cookie   = "shortener"     // cookie пользователя HTTP сервера.
+	Header   = "Authorization" // заголовок HTTP запроса и метаданные gRPC со схемой Bearer.
+	Metadata = "token"         // метаданные gRPC.
+)
+
+const (
+	// MinSecretLength - минимальная длина секретного ключа.
+	MinSecretLength = 16
+	// tokenVersion - версия формата токена.
+	tokenVersion byte = 1
+	// keyIDSize - длина идентификатора ключа в токене.
+	keyIDSize = 4
+	// claimsSize - длина времени выпуска и окончания действия в токене.
+	claimsSize = 16
+	// userIDSize - длина случайного идентификатора пользователя в байтах.
+	userIDSize = 16
+)
+
+// ErrInvalidToken - ошибка, показывающая, что токен поврежден, подделан или подписан неизвестным ключом.
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrExpiredToken - ошибка, показывающая, что срок действия токена истек.
+var ErrExpiredToken = errors.New("token expired")
+
+// ErrShortSecret - ошибка, показывающая, что секретный ключ слишком короткий.
+var ErrShortSecret = errors.New("auth key must be at least 16 bytes")
+
+// Claims - данные токена пользователя.
+type Claims struct {
+	UserID    string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// Current - токен подписан текущим ключом связки.
+	Current bool
+	// Legacy - токен выпущен прежней версией сервиса и принят на переходный период.
+	Legacy bool
+}
+
+// key - ключ связки.
+type key struct {
+	id   [keyIDSize]byte
+	aead cipher.AEAD
+}
+
+// newKey - конструктор ключа связки из секрета. Ключ шифрования и идентификатор ключа выводятся из секрета SHA-256.
+func newKey(secret string) (key, error) {
+	if len(secret) < MinSecretLength {
+		return key{}, ErrShortSecret
+	}
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return key{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return key{}, err
+	}
+	k := key{aead: aead}
+	id := sha256.Sum256(append([]byte("key-id:"), secret...))
+	copy(k.id[:], id[:])
+	return k, nil
+}
+
+// Keyring - связка ключей токенов пользователя. Первый ключ связки - текущий.
+type Keyring struct {
+	keys []key
+	ttl  time.Duration
+	now  func() time.Time
+	// legacy - принимать токены прежних версий сервиса.
+	legacy bool
+}
+
+// NewKeyring - конструктор связки ключей из секретов, первый секрет - текущий ключ.
+// Токены действуют в течение ttl.
+func NewKeyring(secrets []string, ttl time.Duration) (*Keyring, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("auth keys are not set")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("token TTL must be positive")
+	}
+	k := &Keyring{ttl: ttl, now: time.Now}
+	for _, secret := range secrets {
+		key, err := newKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		k.keys = append(k.keys, key)
+	}
+	return k, nil
+}
+
+// Load - создает связку ключей из настроек: ключей AuthKeys через запятую и файла AuthKeysFile с ключом в каждой
+// строке (пустые строки и строки, начинающиеся с #, пропускаются). Ключи AuthKeys идут перед ключами файла.
+// Если ключи не заданы, то создается случайный ключ: токены не будут приниматься после перезапуска сервиса.
+// Токены прежних версий сервиса принимаются, если включена настройка LegacyTokens.
+func Load(c *config.Config) (*Keyring, error) {
+	var secrets []string
+	for _, secret := range strings.Split(c.AuthKeys, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	if c.AuthKeysFile != "" {
+		data, err := os.ReadFile(c.AuthKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				secrets = append(secrets, line)
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if len(secrets) == 0 {
+		secret, err := random(32)
+		if err != nil {
+			return nil, err
+		}
+		log.Println("auth keys are not set, using a random key: user tokens will not survive a restart")
+		secrets = append(secrets, hex.EncodeToString(secret))
+	}
+	k, err := NewKeyring(secrets, c.TokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	k.legacy = c.LegacyTokens
+	return k, nil
+}
+
+// Issue - выпускает токен пользователя userID, подписанный текущим ключом, и возвращает его вместе с данными токена.
+func (k *Keyring) Issue(userID string) (string, Claims, error) {
+	current := k.keys[0]
+	nonce, err := random(current.aead.NonceSize())
+	if err != nil {
+		return "", Claims{}, err
+	}
+	// Время в токене хранится с точностью до секунды.
+	now := k.now().Truncate(time.Second)
+	claims := Claims{UserID: userID, IssuedAt: now, ExpiresAt: now.Add(k.ttl), Current: true}
+	plaintext := make([]byte, claimsSize, claimsSize+len(userID))
+	binary.BigEndian.PutUint64(plaintext, uint64(claims.IssuedAt.Unix()))
+	binary.BigEndian.PutUint64(plaintext[8:], uint64(claims.ExpiresAt.Unix()))
+	plaintext = append(plaintext, userID...)
+	header := append([]byte{tokenVersion}, current.id[:]...)
+	token := append(header, nonce...)
+	token = current.aead.Seal(token, nonce, plaintext, header)
+	return base64.RawURLEncoding.EncodeToString(token), claims, nil
+}
+
+// Verify - проверяет токен и возвращает его данные.
+func (k *Keyring) Verify(token string) (Claims, error) {
+	if k.legacy {
+		if claims, ok := verifyLegacy(token); ok {
+			return claims, nil
+		}
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < 1+keyIDSize || raw[0] != tokenVersion {
+		return Claims{}, ErrInvalidToken
+	}
+	header := raw[:1+keyIDSize]
+	for i, key := range k.keys {
+		if !bytes.Equal(key.id[:], header[1:]) {
+			continue
+		}
+		nonceSize := key.aead.NonceSize()
+		if len(raw) < len(header)+nonceSize {
+			return Claims{}, ErrInvalidToken
+		}
+		nonce, sealed := raw[len(header):len(header)+nonceSize], raw[len(header)+nonceSize:]
+		plaintext, err := key.aead.Open(nil, nonce, sealed, header)
+		if err != nil || len(plaintext) <= claimsSize {
+			return Claims{}, ErrInvalidToken
+		}
+		claims := Claims{
+			UserID:    string(plaintext[claimsSize:]),
+			IssuedAt:  time.Unix(int64(binary.BigEndian.Uint64(plaintext)), 0),
+			ExpiresAt: time.Unix(int64(binary.BigEndian.Uint64(plaintext[8:])), 0),
+			Current:   i == 0,
+		}
+		if !k.now().Before(claims.ExpiresAt) {
+			return Claims{}, ErrExpiredToken
+		}
+		return claims, nil
+	}
+	return Claims{}, ErrInvalidToken
+}
+
+// Stale - сообщает, что токен стоит выпустить заново: он подписан прежним ключом связки (в том числе выпущен
+// прежней версией сервиса) или прошла половина срока его действия.
+func (k *Keyring) Stale(c Claims) bool {
+	return !c.Current || k.now().After(c.IssuedAt.Add(c.ExpiresAt.Sub(c.IssuedAt)/2))
+}
+
+// NewUserID - создает случайный идентификатор нового пользователя.
+func NewUserID() (string, error) {
+	b, err := random(userIDSize)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// random - генератор случайных байт длинной size.
+func random(size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// FromRequest - возвращает токен пользователя из заголовка Authorization со схемой Bearer, а если заголовка нет -
+// из cookie. bearer сообщает, что токен передан в заголовке.
+func FromRequest(r *http.Request) (token string, bearer bool) {
+	if token, ok := bearerToken(r.Header.Get(Header)); ok {
+		return token, true
+	}
+	if cookie, err := r.Cookie(Cookie); err == nil {
+		return cookie.Value, false
+	}
+	return "", false
+}
+
+// FromMetadata - возвращает токен пользователя из метаданных gRPC token или authorization со схемой Bearer.
+func FromMetadata(md metadata.MD) string {
+	if values := md.Get(Metadata); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+	if values := md.Get(Header); len(values) > 0 {
+		token, _ := bearerToken(values[0])
+		return token
+	}
+	return ""
+}
+
+// bearerToken - возвращает токен из значения заголовка Authorization со схемой Bearer.
+func bearerToken(value string) (string, bool) {
+	scheme, token, _ := strings.Cut(value, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// userIDKey - ключ контекста с идентификатором пользователя.
+type userIDKey struct{}
+
+// NewContext - возвращает контекст с идентификатором пользователя userID из проверенного или выпущенного токена.
+func NewContext(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// FromContext - возвращает идентификатор пользователя из контекста.
+func FromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(string)
+	return userID, ok && userID != ""
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestKeyring_Verify(t *testing.T) {
+	k, err := NewKeyring([]string{"current-secret-key-0"}, time.Hour)
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	k.now = func() time.Time { return now }
+	token, issued, err := k.Issue("user1")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), issued.ExpiresAt)
+	t.Run("Valid token", func(t *testing.T) {
+		claims, err := k.Verify(token)
+		require.NoError(t, err)
+		assert.Equal(t, "user1", claims.UserID)
+		assert.True(t, claims.IssuedAt.Equal(now))
+		assert.True(t, claims.Current)
+		assert.False(t, k.Stale(claims))
+	})
+	t.Run("Tampered token", func(t *testing.T) {
+		tampered := []byte(token)
+		tampered[len(tampered)-2] ^= 1
+		_, err := k.Verify(string(tampered))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		_, err = k.Verify("HdUeLk85Gp0i7pLh")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+	t.Run("Unknown key", func(t *testing.T) {
+		other, err := NewKeyring([]string{"another-secret-key"}, time.Hour)
+		require.NoError(t, err)
+		_, err = other.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+	t.Run("Half of lifetime passed", func(t *testing.T) {
+		k.now = func() time.Time { return now.Add(31 * time.Minute) }
+		claims, err := k.Verify(token)
+		require.NoError(t, err)
+		assert.True(t, k.Stale(claims))
+	})
+	t.Run("Expired token", func(t *testing.T) {
+		k.now = func() time.Time { return now.Add(time.Hour) }
+		_, err := k.Verify(token)
+		assert.ErrorIs(t, err, ErrExpiredToken)
+	})
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, err := NewKeyring([]string{"previous-secret-key"}, time.Hour)
+	require.NoError(t, err)
+	token, _, err := old.Issue("user1")
+	require.NoError(t, err)
+	// Новый ключ добавляется в начало связки, прежний продолжает приниматься.
+	k, err := NewKeyring([]string{"current-secret-key-0", "previous-secret-key"}, time.Hour)
+	require.NoError(t, err)
+	claims, err := k.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", claims.UserID)
+	assert.False(t, claims.Current)
+	assert.True(t, k.Stale(claims))
+	token, _, err = k.Issue("user1")
+	require.NoError(t, err)
+	_, err = old.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestKeyring_Legacy(t *testing.T) {
+	// Токен прежней версии сервиса: 10 случайных байт и проверочное слово, зашифрованные общим ключом.
+	block, err := aes.NewCipher([]byte(legacySecret))
+	require.NoError(t, err)
+	raw := make([]byte, aes.BlockSize)
+	block.Encrypt(raw, []byte("0123456789cookie"))
+	token := hex.EncodeToString(raw)
+	c := *config.NewConfig()
+	c.AuthKeys = "current-secret-key-0"
+	k, err := Load(&c)
+	require.NoError(t, err)
+	_, err = k.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	c.LegacyTokens = true
+	k, err = Load(&c)
+	require.NoError(t, err)
+	claims, err := k.Verify(token)
+	require.NoError(t, err)
+	// Идентификатором пользователя остается прежний токен, а сам токен нужно выпустить заново.
+	assert.Equal(t, token, claims.UserID)
+	assert.True(t, claims.Legacy)
+	assert.True(t, k.Stale(claims))
+	block.Encrypt(raw, []byte("0123456789abcdef"))
+	_, err = k.Verify(hex.EncodeToString(raw))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestLoad(t *testing.T) {
+	c := *config.NewConfig()
+	c.AuthKeys = "current-secret-key-0"
+	c.AuthKeysFile = filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(c.AuthKeysFile, []byte("# прежние ключи\n\nprevious-secret-key\n"), 0600))
+	k, err := Load(&c)
+	require.NoError(t, err)
+	require.Len(t, k.keys, 2)
+	old, err := NewKeyring([]string{"previous-secret-key"}, time.Hour)
+	require.NoError(t, err)
+	token, _, err := old.Issue("user1")
+	require.NoError(t, err)
+	_, err = k.Verify(token)
+	assert.NoError(t, err)
+
+	c.AuthKeys = "short"
+	_, err = Load(&c)
+	assert.ErrorIs(t, err, ErrShortSecret)
+
+	c.AuthKeys, c.AuthKeysFile = "", ""
+	k, err = Load(&c)
+	require.NoError(t, err)
+	assert.Len(t, k.keys, 1)
+}
+
+func TestAPIKeys(t *testing.T) {
+	c := *config.NewConfig()
+	// Второй ключ задан хешем SHA-256 строки "hashed".
+	c.APIKeys = "plain, sha256:1a06df824ed741b53c785079a6347f00eec5af82f9850775409ca69dff4068a6"
+	keys, err := LoadAPIKeys(&c)
+	require.NoError(t, err)
+	id, ok := keys.Identify("plain")
+	assert.True(t, ok)
+	assert.NotContains(t, id, "plain")
+	_, ok = keys.Identify("hashed")
+	assert.True(t, ok)
+	_, ok = keys.Identify("unknown")
+	assert.False(t, ok)
+	_, ok = keys.Identify("")
+	assert.False(t, ok)
+
+	c.APIKeys = "sha256:abc"
+	_, err = LoadAPIKeys(&c)
+	assert.Error(t, err)
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	token, bearer := FromRequest(r)
+	assert.Equal(t, "", token)
+	assert.False(t, bearer)
+	r.AddCookie(&http.Cookie{Name: Cookie, Value: "cookie"})
+	token, bearer = FromRequest(r)
+	assert.Equal(t, "cookie", token)
+	assert.False(t, bearer)
+	// Заголовок Authorization имеет приоритет над cookie, другие схемы игнорируются.
+	r.Header.Set(Header, "Basic dXNlcjpwYXNz")
+	token, bearer = FromRequest(r)
+	assert.Equal(t, "cookie", token)
+	assert.False(t, bearer)
+	r.Header.Set(Header, "bearer header")
+	token, bearer = FromRequest(r)
+	assert.Equal(t, "header", token)
+	assert.True(t, bearer)
+}
+
+func TestFromMetadata(t *testing.T) {
+	assert.Equal(t, "", FromMetadata(nil))
+	assert.Equal(t, "header", FromMetadata(metadata.Pairs("authorization", "Bearer header")))
+	assert.Equal(t, "token", FromMetadata(metadata.Pairs("authorization", "Bearer header", "token", "token")))
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+	userID, ok := FromContext(NewContext(context.Background(), "user1"))
+	assert.True(t, ok)
+	assert.Equal(t, "user1", userID)
+}
@@ -0,0 +1,7 @@
+// Package auth - internal package, выпускающий и проверяющий токены пользователя. Токен содержит идентификатор
+// пользователя, время выпуска и окончания действия и зашифрован AES-GCM ключом из связки ключей: новые токены
+// подписываются текущим ключом, а токены, подписанные прежними ключами связки, продолжают приниматься,
+// поэтому ключ можно сменить, не сбрасывая пользователей. Токен общий для HTTP и gRPC серверов: он передается
+// в cookie, заголовке Authorization или метаданных gRPC. На переходный период могут приниматься токены прежних
+// версий сервиса, вместо которых выпускаются новые.
+package auth
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+)
+
+// legacySecret - ключ шифрования токенов прежних версий сервиса.
+const legacySecret = "HdUeLk85Gp0i7pLh"
+
+// legacyNonces - проверочные слова в конце токенов прежних версий: cookie HTTP сервера и токена gRPC сервера.
+var legacyNonces = []string{"cookie", "userid"}
+
+// verifyLegacy - проверяет токен прежних версий сервиса: 10 случайных байт и проверочное слово, зашифрованные AES
+// общим ключом, в hex. Такие токены не содержат срока действия, а идентификатором пользователя был сам токен,
+// поэтому он же возвращается в данных токена, чтобы пользователь сохранил свои URL.
+func verifyLegacy(token string) (Claims, bool) {
+	raw, err := hex.DecodeString(token)
+	if err != nil || len(raw) != aes.BlockSize {
+		return Claims{}, false
+	}
+	block, err := aes.NewCipher([]byte(legacySecret))
+	if err != nil {
+		return Claims{}, false
+	}
+	plaintext := make([]byte, aes.BlockSize)
+	block.Decrypt(plaintext, raw)
+	for _, nonce := range legacyNonces {
+		if string(plaintext[aes.BlockSize-len(nonce):]) == nonce {
+			return Claims{UserID: token, Legacy: true}, true
+		}
+	}
+	return Claims{}, false
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env"
 )
@@ -15,6 +16,45 @@ const (
 	HostPort string = "8080"      // порт хоста по дефолту.
 	HostAddr string = "localhost" // адрес хоста по дефолту.
 	HTTP     string = "http://"   // префикс адреса по дефолту.
+
+	RedirectCode int = 307 // код перенаправления по дефолту.
+
+	PasswordMaxAttempts     int           = 5                // количество неудачных попыток ввода пароля URL по дефолту.
+	PasswordLockout         time.Duration = 15 * time.Minute // время блокировки после неудачных попыток по дефолту.
+	PasswordMaxLinkAttempts int           = 100              // количество неудачных попыток ввода пароля URL от всех клиентов по дефолту.
+
+	QueryConflict string = "keep" // способ разрешения конфликтов параметров запроса при перенаправлении по дефолту.
+
+	RateLimitKey           string  = "ip" // ключ ограничения частоты запросов по дефолту.
+	RateLimitCreate        float64 = 10   // запросов в секунду на создание URL по дефолту.
+	RateLimitCreateBurst   int     = 50   // допустимый всплеск запросов на создание URL по дефолту.
+	RateLimitRedirect      float64 = 100  // переходов в секунду по дефолту.
+	RateLimitRedirectBurst int     = 200  // допустимый всплеск переходов по дефолту.
+	RateLimitAdmin         float64 = 5    // запросов в секунду на управление URL по дефолту.
+	RateLimitAdminBurst    int     = 20   // допустимый всплеск запросов на управление URL по дефолту.
+	RateLimitShards        int     = 16   // количество шардов ограничителя по дефолту.
+
+	ScanMaxNotFound   int           = 50                     // количество ответов 404 клиенту до блокировки по дефолту.
+	ScanBan           time.Duration = 10 * time.Minute       // время блокировки клиента по дефолту.
+	ScanSlowdownAfter int           = 10                     // количество ответов 404, после которого ответы замедляются, по дефолту.
+	ScanSlowdownStep  time.Duration = 100 * time.Millisecond // замедление за каждый следующий ответ 404 по дефолту.
+
+	QuotaAnonymousDaily int = 100   // URL в сутки для анонимного пользователя по дефолту.
+	QuotaAnonymousTotal int = 1000  // URL всего для анонимного пользователя по дефолту.
+	QuotaAPIKeyDaily    int = 10000 // URL в сутки для API ключа по дефолту.
+	QuotaAPIKeyTotal    int = 0     // URL всего для API ключа по дефолту (без ограничения).
+
+	ReadTimeout   time.Duration = 5 * time.Second  // время на чтение из хранилища (переходы, статистика, списки URL) по дефолту.
+	WriteTimeout  time.Duration = 10 * time.Second // время на запись в хранилище (создание URL, варианты) по дефолту.
+	DeleteTimeout time.Duration = time.Minute      // время на асинхронное удаление URL по дефолту.
+	PingTimeout   time.Duration = 10 * time.Second // время на проверку доступности хранилища по дефолту.
+
+	IdempotencyTTL time.Duration = 24 * time.Hour // время хранения ответов по ключу идемпотентности по дефолту.
+
+	EventsHeartbeat     time.Duration = 15 * time.Second // период комментария-пульса в потоке событий по дефолту.
+	ExpiryCheckInterval time.Duration = time.Minute      // период проверки окончания срока действия URL по дефолту.
+
+	TokenTTL time.Duration = 30 * 24 * time.Hour // время действия токена пользователя по дефолту.
 )
 
 var (
@@ -32,6 +72,58 @@ type Config struct {
 	Config        string `env:"CONFIG"`
 	TrustedSubnet string `json:"trusted_subnet" env:"TRUSTED_SUBNET"`
 	EnableGRPC    bool   `json:"enable_grpc" env:"ENABLE_GRPC"`
+	RedirectCode  int    `json:"redirect_code" env:"REDIRECT_CODE"`
+
+	PasswordMaxAttempts     int           `json:"password_max_attempts" env:"PASSWORD_MAX_ATTEMPTS"`
+	PasswordLockout         time.Duration `json:"password_lockout" env:"PASSWORD_LOCKOUT"`
+	PasswordMaxLinkAttempts int           `json:"password_max_link_attempts" env:"PASSWORD_MAX_LINK_ATTEMPTS"`
+
+	InactiveURL   string `json:"inactive_url" env:"INACTIVE_URL"`
+	QueryConflict string `json:"query_conflict" env:"QUERY_CONFLICT"`
+
+	RateLimitKey           string  `json:"rate_limit_key" env:"RATE_LIMIT_KEY"`
+	RateLimitCreate        float64 `json:"rate_limit_create" env:"RATE_LIMIT_CREATE"`
+	RateLimitCreateBurst   int     `json:"rate_limit_create_burst" env:"RATE_LIMIT_CREATE_BURST"`
+	RateLimitRedirect      float64 `json:"rate_limit_redirect" env:"RATE_LIMIT_REDIRECT"`
+	RateLimitRedirectBurst int     `json:"rate_limit_redirect_burst" env:"RATE_LIMIT_REDIRECT_BURST"`
+	RateLimitAdmin         float64 `json:"rate_limit_admin" env:"RATE_LIMIT_ADMIN"`
+	RateLimitAdminBurst    int     `json:"rate_limit_admin_burst" env:"RATE_LIMIT_ADMIN_BURST"`
+	RateLimitShards        int     `json:"rate_limit_shards" env:"RATE_LIMIT_SHARDS"`
+	// TrustedProxies - адреса и подсети прокси через запятую, которым доверяются заголовки X-Real-IP и X-Forwarded-For.
+	TrustedProxies string `json:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	ScanMaxNotFound   int           `json:"scan_max_not_found" env:"SCAN_MAX_NOT_FOUND"`
+	ScanBan           time.Duration `json:"scan_ban" env:"SCAN_BAN"`
+	ScanSlowdownAfter int           `json:"scan_slowdown_after" env:"SCAN_SLOWDOWN_AFTER"`
+	ScanSlowdownStep  time.Duration `json:"scan_slowdown_step" env:"SCAN_SLOWDOWN_STEP"`
+
+	QuotaAnonymousDaily int `json:"quota_anonymous_daily" env:"QUOTA_ANONYMOUS_DAILY"`
+	QuotaAnonymousTotal int `json:"quota_anonymous_total" env:"QUOTA_ANONYMOUS_TOTAL"`
+	QuotaAPIKeyDaily    int `json:"quota_api_key_daily" env:"QUOTA_API_KEY_DAILY"`
+	QuotaAPIKeyTotal    int `json:"quota_api_key_total" env:"QUOTA_API_KEY_TOTAL"`
+	// APIKeys - разрешенные API ключи клиентов или их хеши SHA-256 с префиксом sha256: через запятую.
+	APIKeys string `json:"api_keys" env:"API_KEYS"`
+
+	ReadTimeout   time.Duration `json:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout  time.Duration `json:"write_timeout" env:"WRITE_TIMEOUT"`
+	DeleteTimeout time.Duration `json:"delete_timeout" env:"DELETE_TIMEOUT"`
+	PingTimeout   time.Duration `json:"ping_timeout" env:"PING_TIMEOUT"`
+
+	// IdempotencyTTL - время хранения ответов по ключу идемпотентности, ноль или меньше выключает поддержку ключей.
+	IdempotencyTTL time.Duration `json:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+
+	EventsHeartbeat     time.Duration `json:"events_heartbeat" env:"EVENTS_HEARTBEAT"`
+	ExpiryCheckInterval time.Duration `json:"expiry_check_interval" env:"EXPIRY_CHECK_INTERVAL"`
+
+	// AuthKeys - секретные ключи токенов пользователя через запятую, первый - текущий.
+	AuthKeys string `json:"auth_keys" env:"AUTH_KEYS"`
+	// AuthKeysFile - файл с секретными ключами токенов пользователя, по ключу в строке.
+	AuthKeysFile string        `json:"auth_keys_file" env:"AUTH_KEYS_FILE"`
+	TokenTTL     time.Duration `json:"token_ttl" env:"TOKEN_TTL"`
+	// LegacyTokens - принимать токены прежних версий сервиса на переходный период и выпускать вместо них новые.
+	LegacyTokens bool `json:"legacy_tokens" env:"LEGACY_TOKENS"`
+
+	ValidateRequests bool `json:"validate_requests" env:"VALIDATE_REQUESTS"`
 }
 
 // NewConfig - конструктор конфигурационного файла.
@@ -46,6 +138,44 @@ func NewConfig(options ...Option) *Config {
 				Config:        "",
 				TrustedSubnet: "",
 				EnableGRPC:    false,
+				RedirectCode:  RedirectCode,
+
+				PasswordMaxAttempts:     PasswordMaxAttempts,
+				PasswordLockout:         PasswordLockout,
+				PasswordMaxLinkAttempts: PasswordMaxLinkAttempts,
+
+				QueryConflict: QueryConflict,
+
+				RateLimitKey:           RateLimitKey,
+				RateLimitCreate:        RateLimitCreate,
+				RateLimitCreateBurst:   RateLimitCreateBurst,
+				RateLimitRedirect:      RateLimitRedirect,
+				RateLimitRedirectBurst: RateLimitRedirectBurst,
+				RateLimitAdmin:         RateLimitAdmin,
+				RateLimitAdminBurst:    RateLimitAdminBurst,
+				RateLimitShards:        RateLimitShards,
+
+				ScanMaxNotFound:   ScanMaxNotFound,
+				ScanBan:           ScanBan,
+				ScanSlowdownAfter: ScanSlowdownAfter,
+				ScanSlowdownStep:  ScanSlowdownStep,
+
+				QuotaAnonymousDaily: QuotaAnonymousDaily,
+				QuotaAnonymousTotal: QuotaAnonymousTotal,
+				QuotaAPIKeyDaily:    QuotaAPIKeyDaily,
+				QuotaAPIKeyTotal:    QuotaAPIKeyTotal,
+
+				ReadTimeout:   ReadTimeout,
+				WriteTimeout:  WriteTimeout,
+				DeleteTimeout: DeleteTimeout,
+				PingTimeout:   PingTimeout,
+
+				IdempotencyTTL: IdempotencyTTL,
+
+				EventsHeartbeat:     EventsHeartbeat,
+				ExpiryCheckInterval: ExpiryCheckInterval,
+
+				TokenTTL: TokenTTL,
 			}
 
 			// если в аргументах получили Options, то применяем их к Config.
@@ -81,6 +211,114 @@ func NewConfig(options ...Option) *Config {
 			if !config.EnableHTTPS {
 				config.EnableHTTPS = configJSON.EnableHTTPS
 			}
+			if config.RedirectCode == RedirectCode && configJSON.RedirectCode != 0 {
+				config.RedirectCode = configJSON.RedirectCode
+			}
+			if config.PasswordMaxAttempts == PasswordMaxAttempts && configJSON.PasswordMaxAttempts != 0 {
+				config.PasswordMaxAttempts = configJSON.PasswordMaxAttempts
+			}
+			if config.PasswordLockout == PasswordLockout && configJSON.PasswordLockout != 0 {
+				config.PasswordLockout = configJSON.PasswordLockout
+			}
+			if config.PasswordMaxLinkAttempts == PasswordMaxLinkAttempts && configJSON.PasswordMaxLinkAttempts != 0 {
+				config.PasswordMaxLinkAttempts = configJSON.PasswordMaxLinkAttempts
+			}
+			if config.InactiveURL == "" {
+				config.InactiveURL = configJSON.InactiveURL
+			}
+			if config.QueryConflict == QueryConflict && configJSON.QueryConflict != "" {
+				config.QueryConflict = configJSON.QueryConflict
+			}
+			if config.RateLimitKey == RateLimitKey && configJSON.RateLimitKey != "" {
+				config.RateLimitKey = configJSON.RateLimitKey
+			}
+			if config.RateLimitCreate == RateLimitCreate && configJSON.RateLimitCreate != 0 {
+				config.RateLimitCreate = configJSON.RateLimitCreate
+			}
+			if config.RateLimitCreateBurst == RateLimitCreateBurst && configJSON.RateLimitCreateBurst != 0 {
+				config.RateLimitCreateBurst = configJSON.RateLimitCreateBurst
+			}
+			if config.RateLimitRedirect == RateLimitRedirect && configJSON.RateLimitRedirect != 0 {
+				config.RateLimitRedirect = configJSON.RateLimitRedirect
+			}
+			if config.RateLimitRedirectBurst == RateLimitRedirectBurst && configJSON.RateLimitRedirectBurst != 0 {
+				config.RateLimitRedirectBurst = configJSON.RateLimitRedirectBurst
+			}
+			if config.RateLimitAdmin == RateLimitAdmin && configJSON.RateLimitAdmin != 0 {
+				config.RateLimitAdmin = configJSON.RateLimitAdmin
+			}
+			if config.RateLimitAdminBurst == RateLimitAdminBurst && configJSON.RateLimitAdminBurst != 0 {
+				config.RateLimitAdminBurst = configJSON.RateLimitAdminBurst
+			}
+			if config.RateLimitShards == RateLimitShards && configJSON.RateLimitShards != 0 {
+				config.RateLimitShards = configJSON.RateLimitShards
+			}
+			if config.TrustedProxies == "" {
+				config.TrustedProxies = configJSON.TrustedProxies
+			}
+			if config.ScanMaxNotFound == ScanMaxNotFound && configJSON.ScanMaxNotFound != 0 {
+				config.ScanMaxNotFound = configJSON.ScanMaxNotFound
+			}
+			if config.ScanBan == ScanBan && configJSON.ScanBan != 0 {
+				config.ScanBan = configJSON.ScanBan
+			}
+			if config.ScanSlowdownAfter == ScanSlowdownAfter && configJSON.ScanSlowdownAfter != 0 {
+				config.ScanSlowdownAfter = configJSON.ScanSlowdownAfter
+			}
+			if config.ScanSlowdownStep == ScanSlowdownStep && configJSON.ScanSlowdownStep != 0 {
+				config.ScanSlowdownStep = configJSON.ScanSlowdownStep
+			}
+			if config.QuotaAnonymousDaily == QuotaAnonymousDaily && configJSON.QuotaAnonymousDaily != 0 {
+				config.QuotaAnonymousDaily = configJSON.QuotaAnonymousDaily
+			}
+			if config.QuotaAnonymousTotal == QuotaAnonymousTotal && configJSON.QuotaAnonymousTotal != 0 {
+				config.QuotaAnonymousTotal = configJSON.QuotaAnonymousTotal
+			}
+			if config.QuotaAPIKeyDaily == QuotaAPIKeyDaily && configJSON.QuotaAPIKeyDaily != 0 {
+				config.QuotaAPIKeyDaily = configJSON.QuotaAPIKeyDaily
+			}
+			if config.QuotaAPIKeyTotal == QuotaAPIKeyTotal && configJSON.QuotaAPIKeyTotal != 0 {
+				config.QuotaAPIKeyTotal = configJSON.QuotaAPIKeyTotal
+			}
+			if config.APIKeys == "" {
+				config.APIKeys = configJSON.APIKeys
+			}
+			if !config.ValidateRequests {
+				config.ValidateRequests = configJSON.ValidateRequests
+			}
+			if config.ReadTimeout == ReadTimeout && configJSON.ReadTimeout != 0 {
+				config.ReadTimeout = configJSON.ReadTimeout
+			}
+			if config.WriteTimeout == WriteTimeout && configJSON.WriteTimeout != 0 {
+				config.WriteTimeout = configJSON.WriteTimeout
+			}
+			if config.DeleteTimeout == DeleteTimeout && configJSON.DeleteTimeout != 0 {
+				config.DeleteTimeout = configJSON.DeleteTimeout
+			}
+			if config.PingTimeout == PingTimeout && configJSON.PingTimeout != 0 {
+				config.PingTimeout = configJSON.PingTimeout
+			}
+			if config.IdempotencyTTL == IdempotencyTTL && configJSON.IdempotencyTTL != 0 {
+				config.IdempotencyTTL = configJSON.IdempotencyTTL
+			}
+			if config.EventsHeartbeat == EventsHeartbeat && configJSON.EventsHeartbeat != 0 {
+				config.EventsHeartbeat = configJSON.EventsHeartbeat
+			}
+			if config.ExpiryCheckInterval == ExpiryCheckInterval && configJSON.ExpiryCheckInterval != 0 {
+				config.ExpiryCheckInterval = configJSON.ExpiryCheckInterval
+			}
+			if config.AuthKeys == "" {
+				config.AuthKeys = configJSON.AuthKeys
+			}
+			if config.AuthKeysFile == "" {
+				config.AuthKeysFile = configJSON.AuthKeysFile
+			}
+			if config.TokenTTL == TokenTTL && configJSON.TokenTTL != 0 {
+				config.TokenTTL = configJSON.TokenTTL
+			}
+			if !config.LegacyTokens {
+				config.LegacyTokens = configJSON.LegacyTokens
+			}
 		})
 
 	return config
@@ -107,6 +345,7 @@ func (c *Config) ParseFlags() {
 	flag.StringVar(&c.Config, "c", c.Config, "config JSON file")
 	flag.StringVar(&c.TrustedSubnet, "t", c.TrustedSubnet, "TRUSTED_SUBNET")
 	flag.BoolVar(&c.EnableGRPC, "g", c.EnableGRPC, "ENABLE_GRPC")
+	flag.IntVar(&c.RedirectCode, "r", c.RedirectCode, "REDIRECT_CODE")
 	flag.Parse()
 }
 
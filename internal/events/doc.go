@@ -0,0 +1,4 @@
+// Package events - internal package, шина событий URL пользователей внутри процесса: создание, удаление, переход
+// и окончание срока действия. Хранилище публикует события в шину, а эндпоинт GET /api/user/events передает их
+// подписчикам. Шина хранит последние события, чтобы переподключившийся клиент получил пропущенные.
+package events
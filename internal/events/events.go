@@ -0,0 +1,151 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Типы событий URL.
+const (
+	Created = "link.created" // URL создан.
+	Deleted = "link.deleted" // URL удален.
+	Clicked = "link.clicked" // переход по URL.
+	Expired = "link.expired" // срок действия URL истек или исчерпан лимит переходов.
+)
+
+// Причины окончания действия URL.
+const (
+	ReasonSchedule = "schedule" // наступило окончание срока действия not_after.
+	ReasonClicks   = "clicks"   // исчерпан лимит переходов max_clicks.
+)
+
+// Ограничения шины событий.
+const (
+	HistorySize      = 1024 // количество последних событий, хранимых для возобновления подписки.
+	subscriberBuffer = 64   // размер очереди событий подписчика.
+)
+
+// Event - событие URL пользователя.
+type Event struct {
+	ID      uint64    `json:"-"`
+	Type    string    `json:"type"`
+	UserID  string    `json:"-"`
+	Code    string    `json:"code"`
+	URL     string    `json:"url,omitempty"`
+	Variant string    `json:"variant,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Bus - шина событий. Идентификаторы событий возрастают, в том числе после перезапуска процесса,
+// так как начинаются с текущего времени в наносекундах.
+type Bus struct {
+	seq     uint64
+	history []Event
+	subs    map[string]map[*Subscription]struct{}
+	closed  bool
+	sync.Mutex
+}
+
+// Subscription - подписка на события пользователя. Канал C закрывается при отмене подписки, закрытии шины,
+// а так же если подписчик не успевает получать события: тогда он должен подписаться заново с последним
+// полученным идентификатором.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	userID string
+	bus    *Bus
+}
+
+// NewBus - конструктор шины событий.
+func NewBus() *Bus {
+	return &Bus{
+		seq:  uint64(time.Now().UnixNano()),
+		subs: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Publish - публикует событие подписчикам его пользователя, присваивая ему идентификатор и, если не задано, время.
+// Публикация не блокируется медленными подписчиками. Для nil шины ничего не делает.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	b.seq++
+	e.ID = b.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(b.history) == HistorySize {
+		copy(b.history, b.history[1:])
+		b.history = b.history[:HistorySize-1]
+	}
+	b.history = append(b.history, e)
+	for sub := range b.subs[e.UserID] {
+		select {
+		case sub.c <- e:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe - подписывает на события пользователя userID. Если задан lastID, то возвращает хранимые события
+// пользователя после события lastID, которые подписчик должен обработать до событий из канала.
+func (b *Bus) Subscribe(userID string, lastID uint64) (*Subscription, []Event) {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, userID: userID, bus: b}
+	b.Lock()
+	defer b.Unlock()
+	var backlog []Event
+	if lastID != 0 {
+		for _, e := range b.history {
+			if e.ID > lastID && e.UserID == userID {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+	if b.closed {
+		close(c)
+		return sub, backlog
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[*Subscription]struct{})
+	}
+	b.subs[userID][sub] = struct{}{}
+	return sub, backlog
+}
+
+// Close - закрывает шину, отменяя все подписки. Используется при остановке сервера.
+func (b *Bus) Close() {
+	b.Lock()
+	defer b.Unlock()
+	b.closed = true
+	for _, subs := range b.subs {
+		for sub := range subs {
+			b.remove(sub)
+		}
+	}
+}
+
+// remove - отменяет подписку и закрывает ее канал. Вызывается под блокировкой шины.
+func (b *Bus) remove(sub *Subscription) {
+	subs, ok := b.subs[sub.userID]
+	if _, found := subs[sub]; !ok || !found {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subs, sub.userID)
+	}
+	close(sub.c)
+}
+
+// Close - отменяет подписку. Повторная отмена ничего не делает.
+func (s *Subscription) Close() {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+	s.bus.remove(s)
+}
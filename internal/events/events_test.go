@@ -0,0 +1,58 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+	sub, backlog := bus.Subscribe("user", 0)
+	defer sub.Close()
+	assert.Empty(t, backlog)
+	bus.Publish(Event{Type: Created, UserID: "user", Code: "a"})
+	bus.Publish(Event{Type: Created, UserID: "another", Code: "b"})
+	bus.Publish(Event{Type: Clicked, UserID: "user", Code: "a"})
+	first, second := <-sub.C, <-sub.C
+	assert.Equal(t, Created, first.Type)
+	assert.Equal(t, Clicked, second.Type)
+	assert.Greater(t, second.ID, first.ID)
+	assert.False(t, first.Time.IsZero())
+	assert.Empty(t, sub.C)
+	// Переподключившийся подписчик получает события после последнего полученного.
+	resumed, backlog := bus.Subscribe("user", first.ID)
+	defer resumed.Close()
+	require.Len(t, backlog, 1)
+	assert.Equal(t, second.ID, backlog[0].ID)
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	sub, _ := bus.Subscribe("user", 0)
+	for i := 0; i < subscriberBuffer+1; i++ {
+		bus.Publish(Event{Type: Clicked, UserID: "user", Code: "a"})
+	}
+	// Подписка медленного подписчика отменяется, а не блокирует публикацию.
+	received := 0
+	for range sub.C {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+	sub.Close()
+	assert.Empty(t, bus.subs)
+}
+
+func TestBus_Close(t *testing.T) {
+	bus := NewBus()
+	sub, _ := bus.Subscribe("user", 0)
+	bus.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	sub, _ = bus.Subscribe("user", 0)
+	_, ok = <-sub.C
+	assert.False(t, ok)
+	var nilBus *Bus
+	nilBus.Publish(Event{Type: Created})
+}
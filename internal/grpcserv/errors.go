@@ -0,0 +1,53 @@
+package grpcserv
+
+import (
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// errorDomain - домен ошибок сервиса в деталях ответа gRPC.
+const errorDomain = "shortener"
+
+// statusError - преобразует ошибку сервиса в ошибку gRPC, код выбирается по виду ошибки.
+// Вид ошибки передается в деталях ответа (ErrorInfo), текст внутренних ошибок клиенту не передается.
+func statusError(method string, err error) error {
+	kind := repository.KindOf(err)
+	message := err.Error()
+	if kind == repository.KindInternal {
+		log.Printf("%s: %v", method, err)
+		message = "internal error"
+	}
+	st := status.New(codeOf(kind), message)
+	detailed, derr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: kind.String(),
+		Domain: errorDomain,
+	})
+	if derr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// codeOf - возвращает код gRPC для вида ошибки.
+func codeOf(kind repository.Kind) codes.Code {
+	switch kind {
+	case repository.KindNotFound, repository.KindGone:
+		return codes.NotFound
+	case repository.KindConflict:
+		return codes.AlreadyExists
+	case repository.KindInvalid:
+		return codes.InvalidArgument
+	case repository.KindForbidden:
+		return codes.PermissionDenied
+	case repository.KindUnavailable:
+		return codes.Unavailable
+	case repository.KindNotActive:
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
@@ -3,22 +3,20 @@ package grpcserv
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
-	"strings"
+	"time"
 
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
 	"github.com/gtgaleevtimur/reduction-url-service/proto"
 )
@@ -29,62 +27,163 @@ type Shortener struct {
 
 	conf       *config.Config
 	repository repository.Storager
+	quota      *quota.Quota
+	keys       *auth.Keyring
+	apiKeys    auth.APIKeys
+}
+
+// Option - функция, применяемая к Shortener при его создании.
+type Option func(*Shortener)
+
+// WithQuota - задает учет квот на создание URL, общий с другими серверами сервиса (например, HTTP).
+func WithQuota(q *quota.Quota) Option {
+	return func(s *Shortener) {
+		s.quota = q
+	}
+}
+
+// WithKeyring - задает связку ключей токенов пользователя, общую с перехватчиками и другими серверами сервиса
+// (например, HTTP).
+func WithKeyring(k *auth.Keyring) Option {
+	return func(s *Shortener) {
+		s.keys = k
+	}
 }
 
 // New - конструктор grpc Shortener.
-func New(s repository.Storager, conf *config.Config) *Shortener {
-	return &Shortener{
-		proto.UnimplementedShortenerServer{},
-		conf,
-		s,
+func New(s repository.Storager, conf *config.Config, options ...Option) *Shortener {
+	shortener := &Shortener{
+		conf:       conf,
+		repository: s,
+		quota:      quota.New(conf),
+	}
+	for _, opt := range options {
+		opt(shortener)
+	}
+	// Если связка ключей токенов пользователя не передана, то она создается из конфигурации.
+	if shortener.keys == nil {
+		keys, err := auth.Load(conf)
+		if err != nil {
+			panic(err)
+		}
+		shortener.keys = keys
+	}
+	// Если набор API ключей не передан, то он создается из конфигурации.
+	if shortener.apiKeys == nil {
+		apiKeys, err := auth.LoadAPIKeys(conf)
+		if err != nil {
+			panic(err)
+		}
+		shortener.apiKeys = apiKeys
 	}
+	return shortener
 }
 
 // AddByText - сокращает полный URL, добавляя в БД.
 func (s *Shortener) AddByText(ctx context.Context, r *proto.StringForm) (*proto.CommonResponse, error) {
+	// Операция ограничена контекстом запроса и временем из конфигурации.
+	ctx, cancel := repository.WithTimeout(ctx, s.conf.WriteTimeout)
+	defer cancel()
 	var response proto.CommonResponse
-	var token string
 	url := r.GetLink()
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		values := md.Get("token")
-		if len(values) > 0 {
-			token = values[0]
-		}
-		if len(token) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing token")
-		}
-		res, err := s.repository.InsertURL(ctx, url, token)
-		if err != nil && err != repository.ErrConflictInsert {
-			return &response, status.Error(codes.Internal, "method AddByText not realise")
-		}
-		exShortURL := s.conf.ExpShortURL(res)
-		response.Link = exShortURL
+	userid, err := userID(ctx)
+	if err != nil {
+		return nil, err
 	}
+	id, err := s.reserveQuota(ctx, userid, 1)
+	if err != nil {
+		return &response, err
+	}
+	res, err := s.repository.InsertURL(ctx, url, userid)
+	if err != nil {
+		s.quota.Release(id, 1)
+	}
+	if err != nil && !errors.Is(err, repository.ErrConflictInsert) {
+		return &response, statusError("AddByText", err)
+	}
+	exShortURL := s.conf.ExpShortURL(res)
+	response.Link = exShortURL
 	return &response, nil
 }
 
 // GetByHashURL - возвращает оригинальный URL по хэшу.
 func (s *Shortener) GetByHashURL(ctx context.Context, r *proto.StringForm) (*proto.CommonResponse, error) {
+	// Операция ограничена контекстом запроса и временем из конфигурации.
+	ctx, cancel := repository.WithTimeout(ctx, s.conf.ReadTimeout)
+	defer cancel()
 	var response proto.CommonResponse
 	hash := r.GetLink()
-	res, err := s.repository.GetFullURL(ctx, hash)
+	link, err := s.repository.GetLink(ctx, hash)
 	if err != nil {
-		return &response, status.Error(codes.Internal, "method GetByHashURL not realise")
+		return &response, statusError("GetByHashURL", err)
 	}
-	if !strings.HasPrefix(res, config.HTTP) {
-		res = config.HTTP + strings.TrimPrefix(res, "//")
+	// Проверяем срок действия URL, до начала действия выдаем резервный URL, если он задан.
+	if err = link.CheckSchedule(time.Now()); err != nil {
+		fallback := link.FallbackURL
+		if fallback == "" {
+			fallback = s.conf.InactiveURL
+		}
+		if errors.Is(err, repository.ErrNotActiveURL) && fallback != "" {
+			response.Link = fallback
+			return &response, nil
+		}
+		return &response, statusError("GetByHashURL", err)
 	}
-	response.Link = res
+	// Защищенные паролем URL выдаются только через HTTP, где действует ограничение попыток ввода пароля.
+	if link.Protected() {
+		return &response, status.Error(codes.PermissionDenied, "URL is password protected")
+	}
+	res, variant := destination(ctx, link)
+	if err = s.repository.Click(ctx, hash, variant); err != nil {
+		return &response, statusError("GetByHashURL", err)
+	}
+	// Адрес формируется, как в HTTP: добавляем схему, если ее нет, и UTM метки, если они заданы.
+	response.Link = link.Location(res, "", nil, s.conf.QueryConflict)
 	return &response, nil
 }
 
+// variantMetadata - ключ метаданных, в которых передается выбранный для клиента вариант URL.
+const variantMetadata = "variant"
+
+// destination - возвращает адрес перенаправления по URL и идентификатор выбранного варианта, как в HTTP:
+// сначала проверяются правила перенаправления по метаданным вызова, затем варианты A/B теста, иначе используется
+// оригинальный URL. Выбранный вариант возвращается в заголовке ответа variant, а клиент, передавший его
+// в метаданных следующего вызова, получает тот же вариант.
+func destination(ctx context.Context, link repository.URL) (string, string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	rc := repository.NewRuleContext(metadataValue(md, "user-agent"), metadataValue(md, "accept-language"), time.Now())
+	if rule, ok := link.MatchRule(rc); ok {
+		return rule.URL, ""
+	}
+	if len(link.Variants) == 0 {
+		return link.FURL, ""
+	}
+	variant, ok := link.Variant(metadataValue(md, variantMetadata))
+	if !ok {
+		variant = link.PickVariant()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(variantMetadata, variant.ID))
+	return variant.URL, variant.ID
+}
+
+// metadataValue - возвращает первое значение ключа key метаданных md.
+func metadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
 // Ping - возвращает 200 в случае успешного Ping, возвращает 500 , если БД не доступна.
 func (s *Shortener) Ping(ctx context.Context, no *proto.NoParam) (*proto.IntForm, error) {
+	// Операция ограничена контекстом запроса и временем из конфигурации.
+	ctx, cancel := repository.WithTimeout(ctx, s.conf.PingTimeout)
+	defer cancel()
 	var response proto.IntForm
 	err := s.repository.Ping(ctx)
 	if err != nil {
 		response.Value = http.StatusInternalServerError
-		return &response, status.Error(codes.Internal, "method Ping not realise")
+		return &response, statusError("Ping", repository.Wrap(repository.KindUnavailable, err))
 	}
 	response.Value = http.StatusOK
 	return &response, nil
@@ -92,14 +191,17 @@ func (s *Shortener) Ping(ctx context.Context, no *proto.NoParam) (*proto.IntForm
 
 // Stats - возвращает количество пользователей и сохраненных url в БД.
 func (s *Shortener) Stats(ctx context.Context, no *proto.NoParam) (*proto.StatsResponse, error) {
+	// Операция ограничена контекстом запроса и временем из конфигурации.
+	ctx, cancel := repository.WithTimeout(ctx, s.conf.ReadTimeout)
+	defer cancel()
 	var response proto.StatsResponse
 	urls, err := s.repository.GetCountURL(ctx)
 	if err != nil {
-		return &response, status.Errorf(codes.Internal, "method Stats not realise count urls")
+		return &response, statusError("Stats", err)
 	}
 	users, err := s.repository.GetCountUsers(ctx)
 	if err != nil {
-		return &response, status.Errorf(codes.Internal, "method Stats not realise count users")
+		return &response, statusError("Stats", err)
 	}
 	response.Urls = int32(urls)
 	response.Users = int32(users)
@@ -109,160 +211,233 @@ func (s *Shortener) Stats(ctx context.Context, no *proto.NoParam) (*proto.StatsR
 // Delete - удаляет все url пользователя, возвращает http.StatusAccepted.
 func (s *Shortener) Delete(ctx context.Context, r *proto.DeleteRequest) (*proto.IntForm, error) {
 	var response proto.IntForm
-	var token string
 	ids := r.GetId()
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		values := md.Get("token")
-		if len(values) > 0 {
-			token = values[0]
-		}
-		if len(token) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing token")
-		}
-		go s.repository.Delete(ctx, ids, token)
-		response.Value = http.StatusAccepted
+	userid, err := userID(ctx)
+	if err != nil {
+		return nil, err
 	}
+	// Удаление продолжается после ответа, поэтому его контекст не зависит от контекста запроса.
+	go func() {
+		ctx, cancel := repository.WithTimeout(context.Background(), s.conf.DeleteTimeout)
+		defer cancel()
+		if err := s.repository.Delete(ctx, ids, userid); err != nil {
+			log.Printf("Delete: %v", err)
+		}
+	}()
+	response.Value = http.StatusAccepted
 	return &response, nil
 }
 
 // GetUserURLs - возвращает сохраненные пользователем url.
 func (s *Shortener) GetUserURLs(ctx context.Context, r *proto.NoParam) (*proto.GetUserURLsResponse, error) {
+	// Операция ограничена контекстом запроса и временем из конфигурации.
+	ctx, cancel := repository.WithTimeout(ctx, s.conf.ReadTimeout)
+	defer cancel()
 	var response proto.GetUserURLsResponse
-	var token string
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		values := md.Get("token")
-		if len(values) > 0 {
-			token = values[0]
-		}
-		fmt.Println(token)
-		if len(token) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing token")
-		}
-		res, err := s.repository.GetAllUserURLs(ctx, token)
-		if err != nil {
-			return nil, status.Errorf(codes.Unimplemented, "method GetUserURLs not implemented")
-		}
-		result := make([]*proto.Links, len(res))
-		for i, v := range res {
-			result[i] = &proto.Links{
-				Short: s.conf.ExpShortURL(v.Short),
-				Full:  v.Full,
-			}
+	userid, err := userID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.repository.GetAllUserURLs(ctx, userid)
+	if err != nil {
+		return nil, statusError("GetUserURLs", err)
+	}
+	result := make([]*proto.Links, len(res))
+	for i, v := range res {
+		result[i] = &proto.Links{
+			Short: s.conf.ExpShortURL(v.Short),
+			Full:  v.Full,
 		}
-		response.Links = result
 	}
+	response.Links = result
 	return &response, nil
 }
 
 // PostJSON - метод принимающий в теле json с полным url,возвращает сокращенный URL в json.
 func (s *Shortener) PostJSON(ctx context.Context, r *proto.PostJSONRespReq) (*proto.PostJSONRespReq, error) {
+	// Операция ограничена контекстом запроса и временем из конфигурации.
+	ctx, cancel := repository.WithTimeout(ctx, s.conf.WriteTimeout)
+	defer cancel()
 	var response proto.PostJSONRespReq
-	var token string
 	body := r.GetJson()
 	var full repository.FullURL
 	err := json.Unmarshal(body, &full)
 	if err != nil {
-		return &response, status.Errorf(codes.Internal, "method PostJSON->json not realise")
+		return &response, status.Error(codes.InvalidArgument, err.Error())
 	}
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		values := md.Get("token")
-		if len(values) > 0 {
-			token = values[0]
-		}
-		if len(token) == 0 {
-			return &response, status.Error(codes.Unauthenticated, "missing token")
-		}
-		var sURL repository.ShortURL
-		sURL.Short, err = s.repository.InsertURL(ctx, full.Full, token)
-		if err != nil && !errors.Is(err, repository.ErrConflictInsert) {
-			return &response, status.Errorf(codes.Internal, "method PostJSON->InsertURL not realise")
-		}
-		sURL.Short = s.conf.ExpShortURL(sURL.Short)
-		respBody, err := json.Marshal(sURL)
-		if err != nil {
-			return &response, status.Errorf(codes.Internal, "method PostJSON->json.Marshal not realise")
-		}
-		response.Json = respBody
+	userid, err := userID(ctx)
+	if err != nil {
+		return &response, err
+	}
+	opts, err := full.Options()
+	if err != nil {
+		return &response, statusError("PostJSON", err)
+	}
+	id, err := s.reserveQuota(ctx, userid, 1)
+	if err != nil {
+		return &response, err
+	}
+	var sURL repository.ShortURL
+	sURL.Short, err = s.repository.InsertLink(ctx, full.Full, userid, opts)
+	if err != nil {
+		s.quota.Release(id, 1)
 	}
+	if err != nil && !errors.Is(err, repository.ErrConflictInsert) {
+		return &response, statusError("PostJSON", err)
+	}
+	sURL.Short = s.conf.ExpShortURL(sURL.Short)
+	respBody, err := json.Marshal(sURL)
+	if err != nil {
+		return &response, statusError("PostJSON", err)
+	}
+	response.Json = respBody
 
 	return &response, nil
 }
 
 // PostBatch - метод реализующий загрузку массива с url.
 func (s *Shortener) PostBatch(ctx context.Context, r *proto.PostBatchRequest) (*proto.PostBatchResponse, error) {
+	// Операция ограничена контекстом запроса и временем из конфигурации.
+	ctx, cancel := repository.WithTimeout(ctx, s.conf.WriteTimeout)
+	defer cancel()
 	var response proto.PostBatchResponse
-	var token string
 	batch := r.GetLinks()
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		values := md.Get("token")
-		if len(values) > 0 {
-			token = values[0]
-		}
-		if len(token) == 0 {
-			return &response, status.Error(codes.Unauthenticated, "missing token")
-		}
-		result := make([]*proto.ButchLinks, 0)
-		for _, v := range batch {
-			short, err := s.repository.InsertURL(ctx, v.Link, token)
-			if err != nil && !errors.Is(err, repository.ErrConflictInsert) {
-				return &response, status.Errorf(codes.Internal, "method PostBatch not realise Insert")
-			}
-			result = append(result, &proto.ButchLinks{
-				Link: short,
-				Id:   v.Id,
-			})
+	userid, err := userID(ctx)
+	if err != nil {
+		return &response, err
+	}
+	// Расходуем квоту пользователя сразу на все URL пакета.
+	id, err := s.reserveQuota(ctx, userid, len(batch))
+	if err != nil {
+		return &response, err
+	}
+	result := make([]*proto.ButchLinks, 0)
+	for i, v := range batch {
+		short, err := s.repository.InsertURL(ctx, v.Link, userid)
+		if errors.Is(err, repository.ErrConflictInsert) {
+			s.quota.Release(id, 1)
+		} else if err != nil {
+			s.quota.Release(id, len(batch)-i)
+			return &response, statusError("PostBatch", err)
 		}
-		response.Links = result
+		result = append(result, &proto.ButchLinks{
+			Link: short,
+			Id:   v.Id,
+		})
 	}
+	response.Links = result
 	return &response, nil
 }
 
-// MyUnaryInterceptor - перехватчик-аутентификатор, проверяет заголовок метаданных userid,
-// если он пуст или проверка токен не удалась, то он выдает новый userid.
-func MyUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	var token string
-	md, ok := metadata.FromIncomingContext(ctx)
-	if ok {
-		values := md.Get("token")
-		if len(values) > 0 {
-			token = values[0]
+// registerMethod - метод регистрации нового пользователя.
+const registerMethod = "/shortener.Shortener/Register"
+
+// tokenMethods - методы выдачи токена, для которых перехватчик-аутентификатор не создает нового пользователя.
+var tokenMethods = map[string]bool{
+	registerMethod:               true,
+	"/shortener.Shortener/Login": true,
+}
+
+// MyUnaryInterceptor - перехватчик-аутентификатор, проверяет токен пользователя в метаданных token или authorization
+// связкой ключей k. Если токена нет, то он выдает новый токен новому пользователю, а если токен передан, но не прошел
+// проверку (подделан, истек или подписан неизвестным ключом), то отклоняет вызов с codes.Unauthenticated. Новый токен, а также токен, подписанный прежним ключом или выданный больше половины срока назад, возвращается
+// клиенту в заголовке ответа token. Идентификатор пользователя передается обработчику в контексте вызова.
+func MyUnaryInterceptor(k *auth.Keyring) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// Проверка токена на подлинность.
+		md, _ := metadata.FromIncomingContext(ctx)
+		if token := auth.FromMetadata(md); token != "" {
+			claims, err := k.Verify(token)
+			if err == nil {
+				if k.Stale(claims) && !tokenMethods[info.FullMethod] {
+					if token, _, err = k.Issue(claims.UserID); err == nil {
+						grpc.SetHeader(ctx, metadata.Pairs(auth.Metadata, token))
+					}
+				}
+				return handler(auth.NewContext(ctx, claims.UserID), req)
+			}
+			// Register выдает токен новому пользователю и без подлинного токена.
+			if info.FullMethod != registerMethod {
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
 		}
-	}
-	tokenBuf := make([]byte, aes.BlockSize)
-	key := []byte("HdUeLk85Gp0i7pLh")
-	nonce := []byte("userid")
-	aesBlock, err := aes.NewCipher(key)
-	if err != nil {
-		log.Printf("aesBlock inizialise error:%s", err.Error())
-	}
-	// Проверка токена на подлинность.
-	if len(token) != 0 {
-		userIDByte, err := hex.DecodeString(token)
+		// Методы выдачи токена сами создают пользователя или отклоняют вызов без токена.
+		if tokenMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		// Если токена нет, то создаем нового пользователя и пишем его токен в метаданные.
+		userID, err := auth.NewUserID()
 		if err != nil {
-			log.Printf("Cookie decoding: %v\n", err)
+			return nil, status.Error(codes.Internal, err.Error())
 		}
-		aesBlock.Decrypt(tokenBuf, userIDByte)
-		if string(tokenBuf[len(tokenBuf)-len(nonce):]) == string(nonce) {
-			return handler(ctx, req)
+		token, _, err := k.Issue(userID)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
 		}
+		// Остальные метаданные, срок и данные клиента вызова сохраняются.
+		md = md.Copy()
+		md.Set(auth.Metadata, token)
+		ctx = metadata.NewIncomingContext(ctx, md)
+		// Клиент получает токен в заголовке ответа и передает его в следующих вызовах.
+		grpc.SetHeader(ctx, metadata.Pairs(auth.Metadata, token))
+		ctx = context.WithValue(ctx, tokenIssuedKey{}, true)
+		return handler(auth.NewContext(ctx, userID), req)
 	}
-	// Если токена нет или значение-пустая строка, то создаем новый токен и пишем в метаданные.
-	userID, err := generateRandom(10)
+}
+
+// tokenIssuedKey - ключ контекста вызова, отмечающий, что токен пользователя выдан в этом вызове.
+type tokenIssuedKey struct{}
+
+// tokenIssued - сообщает, что токен пользователя выдан в этом вызове, то есть клиент не передал токен.
+func tokenIssued(ctx context.Context) bool {
+	issued, _ := ctx.Value(tokenIssuedKey{}).(bool)
+	return issued
+}
+
+// verifyToken - проверяет подлинность токена пользователя из метаданных и возвращает его данные.
+func verifyToken(ctx context.Context, k *auth.Keyring) (auth.Claims, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := auth.FromMetadata(md)
+	if token == "" {
+		return auth.Claims{}, false
+	}
+	claims, err := k.Verify(token)
+	return claims, err == nil
+}
+
+// userID - возвращает идентификатор пользователя из контекста вызова, если его нет - ошибку codes.Unauthenticated.
+func userID(ctx context.Context) (string, error) {
+	userid, ok := auth.FromContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "missing token")
+	}
+	return userid, nil
+}
+
+// Register - создает нового пользователя и выдает ему токен.
+func (s *Shortener) Register(ctx context.Context, _ *proto.NoParam) (*proto.TokenResponse, error) {
+	userid, err := auth.NewUserID()
 	if err != nil {
-		log.Printf("UserID generate: %v\n", err)
+		return nil, status.Error(codes.Internal, err.Error())
 	}
-	aesBlock.Encrypt(tokenBuf, append(userID, nonce...))
-	mdNew := metadata.New(map[string]string{"token": hex.EncodeToString(tokenBuf)})
-	newCtx := metadata.NewIncomingContext(context.Background(), mdNew)
-	return handler(newCtx, req)
+	return s.issueToken(userid)
 }
 
-// generateRandom - генератор случайных байт длинной size.
-func generateRandom(size int) ([]byte, error) {
-	b := make([]byte, size)
-	_, err := rand.Read(b)
+// Login - выдает новый токен пользователю переданного токена, например, полученного от HTTP сервера.
+// Если подлинного токена нет, то возвращает ошибку codes.Unauthenticated.
+func (s *Shortener) Login(ctx context.Context, _ *proto.NoParam) (*proto.TokenResponse, error) {
+	userid, err := userID(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	return s.issueToken(userid)
+}
+
+// issueToken - выпускает токен пользователя userid.
+func (s *Shortener) issueToken(userid string) (*proto.TokenResponse, error) {
+	token, claims, err := s.keys.Issue(userid)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &proto.TokenResponse{Token: token, UserId: userid, ExpiresAt: claims.ExpiresAt.Unix()}, nil
 }
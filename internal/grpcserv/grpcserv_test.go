@@ -2,27 +2,47 @@ package grpcserv
 
 import (
 	"context"
-	"crypto/aes"
-	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"math/rand"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
 	"github.com/gtgaleevtimur/reduction-url-service/proto"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
+var testKeys = func() *auth.Keyring {
+	k, err := auth.NewKeyring([]string{"test-secret-key-0123"}, time.Hour)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+// testToken - возвращает токен gRPC пользователя userid, подписанный тестовыми ключами.
+func testToken(t *testing.T, userid string) string {
+	token, _, err := testKeys.Issue(userid)
+	require.NoError(t, err)
+	return token
+}
+
 func TestNew(t *testing.T) {
 	storage, err := repository.NewDataSource()
 	require.NoError(t, err)
@@ -39,7 +59,7 @@ func TestShortener_AddByText(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -51,17 +71,7 @@ func TestShortener_AddByText(t *testing.T) {
 		{Link: `http://test.ru` + strconv.Itoa(rand.Intn(99))},
 		{Link: `http://test.ru` + strconv.Itoa(rand.Intn(99))},
 	}
-	tokenBuf := make([]byte, aes.BlockSize)
-	key := []byte("HdUeLk85Gp0i7pLh")
-	nonce := []byte("userid")
-	aesBlock, err := aes.NewCipher(key)
-	require.NoError(t, err)
-	b := make([]byte, 10)
-	_, err = rand.Read(b)
-	require.NoError(t, err)
-	aesBlock.Encrypt(tokenBuf, append(b, nonce...))
-	md := metadata.New(map[string]string{"token": hex.EncodeToString(tokenBuf)})
-	fmt.Println("token:", hex.EncodeToString(tokenBuf))
+	md := metadata.New(map[string]string{"token": testToken(t, strconv.Itoa(rand.Int()))})
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
 	for _, v := range links {
 		connData, err := client.AddByText(ctx, v)
@@ -79,7 +89,7 @@ func TestShortener_GetByHashURL(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -102,6 +112,50 @@ func TestShortener_GetByHashURL(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, links[i].Link, connGet.Link)
 	}
+	// Правила перенаправления проверяются по метаданным вызова.
+	hash, err := storage.InsertLink(context.Background(), "http://test.test/rules", "sadASdQeAWDwdAs",
+		repository.LinkOptions{Rules: []repository.RedirectRule{{Language: "en", URL: "http://test.test/en"}}})
+	require.NoError(t, err)
+	for language, want := range map[string]string{"en-US": "http://test.test/en", "ru": "http://test.test/rules"} {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", language)
+		connGet, err := client.GetByHashURL(ctx, &proto.StringForm{Link: hash})
+		require.NoError(t, err)
+		assert.Equal(t, want, connGet.Link)
+	}
+	// Адрес HTTPS с UTM метками не дополняется схемой по умолчанию.
+	hash, err = storage.InsertLink(context.Background(), "https://test.test/secure", "sadASdQeAWDwdAs",
+		repository.LinkOptions{UTM: &repository.UTM{Source: "grpc"}})
+	require.NoError(t, err)
+	connGet, err := client.GetByHashURL(context.Background(), &proto.StringForm{Link: hash})
+	require.NoError(t, err)
+	assert.Equal(t, "https://test.test/secure?utm_source=grpc", connGet.Link)
+	// Вариант A/B теста выбирается по весу и сохраняется, если клиент передает его в метаданных.
+	hash, err = storage.InsertLink(context.Background(), "http://test.test/landing", "sadASdQeAWDwdAs",
+		repository.LinkOptions{Variants: []repository.Variant{
+			{ID: "a", URL: "http://test.test/landing-a", Weight: 1},
+			{ID: "b", URL: "http://test.test/landing-b", Weight: 1},
+		}})
+	require.NoError(t, err)
+	var header metadata.MD
+	first, err := client.GetByHashURL(context.Background(), &proto.StringForm{Link: hash}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get("variant"), 1)
+	variant := header.Get("variant")[0]
+	assert.Equal(t, "http://test.test/landing-"+variant, first.Link)
+	for i := 0; i < 5; i++ {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "variant", variant)
+		connGet, err := client.GetByHashURL(ctx, &proto.StringForm{Link: hash})
+		require.NoError(t, err)
+		assert.Equal(t, first.Link, connGet.Link)
+	}
+	stats, err := storage.GetLinkStats(context.Background(), hash, "sadASdQeAWDwdAs")
+	require.NoError(t, err)
+	assert.Equal(t, 6, stats.Clicks)
+	for _, v := range stats.Variants {
+		if v.ID == variant {
+			assert.Equal(t, 6, v.Clicks)
+		}
+	}
 }
 
 func TestShortener_Ping(t *testing.T) {
@@ -112,7 +166,7 @@ func TestShortener_Ping(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -132,7 +186,7 @@ func TestShortener_Stats(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -153,7 +207,7 @@ func TestShortener_Delete(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -165,16 +219,7 @@ func TestShortener_Delete(t *testing.T) {
 		{Link: `http://test.ru` + strconv.Itoa(rand.Intn(99))},
 		{Link: `http://test.ru` + strconv.Itoa(rand.Intn(99))},
 	}
-	tokenBuf := make([]byte, aes.BlockSize)
-	key := []byte("HdUeLk85Gp0i7pLh")
-	nonce := []byte("userid")
-	aesBlock, err := aes.NewCipher(key)
-	require.NoError(t, err)
-	b := make([]byte, 10)
-	_, err = rand.Read(b)
-	require.NoError(t, err)
-	aesBlock.Encrypt(tokenBuf, append(b, nonce...))
-	md := metadata.New(map[string]string{"token": hex.EncodeToString(tokenBuf)})
+	md := metadata.New(map[string]string{"token": testToken(t, strconv.Itoa(rand.Int()))})
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
 	ids := make([]string, 0)
 	for _, v := range links {
@@ -200,23 +245,15 @@ func TestShortener_GetUserURLs(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	require.NoError(t, err)
 	defer conn.Close()
 	client := proto.NewShortenerClient(conn)
-	tokenBuf := make([]byte, aes.BlockSize)
-	key := []byte("HdUeLk85Gp0i7pLh")
-	nonce := []byte("userid")
-	aesBlock, err := aes.NewCipher(key)
-	require.NoError(t, err)
-	b := make([]byte, 10)
-	_, err = rand.Read(b)
-	require.NoError(t, err)
-	aesBlock.Encrypt(tokenBuf, append(b, nonce...))
-	md := metadata.New(map[string]string{"token": hex.EncodeToString(tokenBuf)})
+	token := testToken(t, strconv.Itoa(rand.Int()))
+	md := metadata.New(map[string]string{"token": token})
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
 	link := &proto.StringForm{
 		Link: `http://test.ru` + strconv.Itoa(rand.Intn(99)),
@@ -233,6 +270,11 @@ func TestShortener_GetUserURLs(t *testing.T) {
 		assert.Equal(t, k.Short, connAdd.GetLink())
 		assert.Equal(t, k.Full, link.Link)
 	}
+	// Тот же токен принимается в метаданных authorization со схемой Bearer, как в заголовке HTTP запроса.
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	connGetAll, err = client.GetUserURLs(ctx, &proto.NoParam{})
+	require.NoError(t, err)
+	assert.Equal(t, len(responseLinks), len(connGetAll.GetLinks()))
 }
 
 func TestShortener_PostJSON(t *testing.T) {
@@ -243,7 +285,7 @@ func TestShortener_PostJSON(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -271,7 +313,7 @@ func TestShortener_PostBatch(t *testing.T) {
 	defer l.Close()
 	conf := config.NewConfig()
 	address := l.Addr().String()
-	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor))
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
 	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
 	go grpcServer.Serve(l)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -292,3 +334,271 @@ func TestShortener_PostBatch(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, connButch)
 }
+
+func TestShortener_Register(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	storage, err := repository.NewDataSource()
+	require.NoError(t, err)
+	defer l.Close()
+	conf := config.NewConfig()
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
+	proto.RegisterShortenerServer(grpcServer, New(storage, conf, WithKeyring(testKeys)))
+	go grpcServer.Serve(l)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewShortenerClient(conn)
+	// Вызов без токена выполняется от имени нового пользователя, токен которого возвращается в заголовке.
+	var header metadata.MD
+	added, err := client.AddByText(context.Background(), &proto.StringForm{Link: "http://test.ru/register"}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get("token"), 1)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("token", header.Get("token")[0]))
+	urls, err := client.GetUserURLs(ctx, &proto.NoParam{})
+	require.NoError(t, err)
+	require.Len(t, urls.Links, 1)
+	assert.Equal(t, added.Link, urls.Links[0].Short)
+	// Вызов с подлинным токеном не получает нового.
+	header = nil
+	_, err = client.GetUserURLs(ctx, &proto.NoParam{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Empty(t, header.Get("token"))
+	// Login выдает новый токен тому же пользователю, а без токена отклоняется.
+	login, err := client.Login(ctx, &proto.NoParam{})
+	require.NoError(t, err)
+	claims, err := testKeys.Verify(login.Token)
+	require.NoError(t, err)
+	assert.Equal(t, login.UserId, claims.UserID)
+	assert.Equal(t, claims.ExpiresAt.Unix(), login.ExpiresAt)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+login.Token))
+	urls, err = client.GetUserURLs(ctx, &proto.NoParam{})
+	require.NoError(t, err)
+	assert.Len(t, urls.Links, 1)
+	_, err = client.Login(context.Background(), &proto.NoParam{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	// Register всегда создает нового пользователя.
+	register, err := client.Register(ctx, &proto.NoParam{})
+	require.NoError(t, err)
+	assert.NotEqual(t, login.UserId, register.UserId)
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("token", register.Token))
+	_, err = client.GetUserURLs(ctx, &proto.NoParam{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestMyUnaryInterceptor(t *testing.T) {
+	// Контекст вызова с новым токеном сохраняет срок и остальные метаданные.
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", "key"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.Shortener/GetUserURLs"}
+	_, err := MyUnaryInterceptor(testKeys)(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		d, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.True(t, d.Equal(deadline))
+		md, _ := metadata.FromIncomingContext(ctx)
+		assert.Equal(t, []string{"key"}, md.Get("x-api-key"))
+		claims, err := testKeys.Verify(md.Get("token")[0])
+		require.NoError(t, err)
+		userid, err := userID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, claims.UserID, userid)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	// Переданный, но неверный токен не заменяется новым пользователем, вызов отклоняется.
+	invalid := metadata.NewIncomingContext(context.Background(), metadata.Pairs("token", "invalid"))
+	called := false
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return nil, nil
+	}
+	_, err = MyUnaryInterceptor(testKeys)(invalid, nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.False(t, called)
+	// Регистрация выдает новый токен и при неверном токене.
+	_, err = MyUnaryInterceptor(testKeys)(invalid, nil, &grpc.UnaryServerInfo{FullMethod: registerMethod}, handler)
+	require.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestRateLimitInterceptor(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	storage, err := repository.NewDataSource()
+	require.NoError(t, err)
+	defer l.Close()
+	conf := config.NewConfig()
+	limiters := ratelimit.Limiters{
+		ratelimit.Create: ratelimit.NewTokenBucket(ratelimit.Budget{Rate: 0.01, Burst: 2}, 1),
+	}
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(RateLimitInterceptor(limiters, conf, testKeys, nil), MyUnaryInterceptor(testKeys)))
+	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
+	go grpcServer.Serve(l)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewShortenerClient(conn)
+	for i := 0; i < 2; i++ {
+		_, err = client.AddByText(context.Background(), &proto.StringForm{Link: "http://test.ru/limit" + strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+	var header metadata.MD
+	_, err = client.AddByText(context.Background(), &proto.StringForm{Link: "http://test.ru/limit"}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"100"}, header.Get("retry-after"))
+	_, err = client.Ping(context.Background(), &proto.NoParam{})
+	assert.NoError(t, err)
+}
+
+func TestRateKey(t *testing.T) {
+	c := *config.NewConfig()
+	c.APIKeys = "key"
+	apiKeys, err := auth.LoadAPIKeys(&c)
+	require.NoError(t, err)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}})
+	// Неизвестный API ключ учитывается по адресу соединения.
+	unknown := metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", "unknown"))
+	assert.Equal(t, "ip:10.0.0.1", rateKey(unknown, ratelimit.KeyAPIKey, testKeys, apiKeys))
+	id, ok := apiKeys.Identify("key")
+	require.True(t, ok)
+	known := metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", "key"))
+	assert.Equal(t, "key:"+id, rateKey(known, ratelimit.KeyAPIKey, testKeys, apiKeys))
+}
+
+func TestIdempotencyInterceptor(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	storage, err := repository.NewDataSource()
+	require.NoError(t, err)
+	defer l.Close()
+	conf := config.NewConfig()
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(IdempotencyInterceptor(conf, testKeys), MyUnaryInterceptor(testKeys)))
+	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
+	go grpcServer.Serve(l)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewShortenerClient(conn)
+	ctx := metadata.NewOutgoingContext(context.Background(),
+		metadata.Pairs("token", testToken(t, "idempotent"), "idempotency-key", "key1"))
+	batch := &proto.PostBatchRequest{Links: []*proto.ButchLinks{{Id: "1", Link: "http://test.ru/idempotent"}}}
+	first, err := client.PostBatch(ctx, batch)
+	require.NoError(t, err)
+	// Повтор с тем же ключом возвращает первый ответ.
+	var header metadata.MD
+	replayed, err := client.PostBatch(ctx, batch, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, first.Links[0].Link, replayed.Links[0].Link)
+	assert.Equal(t, []string{"true"}, header.Get("idempotent-replayed"))
+	// Ключ с другим запросом отклоняется, а в другом методе - независим.
+	batch.Links[0].Link = "http://test.ru/idempotent1"
+	_, err = client.PostBatch(ctx, batch)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.AddByText(ctx, &proto.StringForm{Link: "http://test.ru/idempotent2"})
+	assert.NoError(t, err)
+	// Без подлинного токена ключ не к кому привязать, поэтому вызов отклоняется, а не выполняется без ключа.
+	anonymous := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("idempotency-key", "key1"))
+	_, err = client.AddByText(anonymous, &proto.StringForm{Link: "http://test.ru/idempotent3"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestShortener_Quota(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	storage, err := repository.NewDataSource()
+	require.NoError(t, err)
+	defer l.Close()
+	conf := *config.NewConfig()
+	conf.QuotaAnonymousDaily = 2
+	conf.APIKeys = "key"
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
+	proto.RegisterShortenerServer(grpcServer, New(storage, &conf, WithQuota(quota.New(&conf))))
+	go grpcServer.Serve(l)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewShortenerClient(conn)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("token", testToken(t, "quotauser1")))
+	_, err = client.PostBatch(ctx, &proto.PostBatchRequest{Links: []*proto.ButchLinks{
+		{Id: "1", Link: "http://test.ru/quota1"},
+		{Id: "2", Link: "http://test.ru/quota2"},
+		{Id: "3", Link: "http://test.ru/quota3"},
+	}})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	for i := 0; i < 2; i++ {
+		_, err = client.AddByText(ctx, &proto.StringForm{Link: "http://test.ru/quota" + strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+	_, err = client.AddByText(ctx, &proto.StringForm{Link: "http://test.ru/quota"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// Неизвестный API ключ не дает квоты своего уровня, разрешенный - дает.
+	_, err = client.AddByText(metadata.AppendToOutgoingContext(ctx, "x-api-key", "unknown"), &proto.StringForm{Link: "http://test.ru/quota"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = client.AddByText(metadata.AppendToOutgoingContext(ctx, "x-api-key", "key"), &proto.StringForm{Link: "http://test.ru/quota"})
+	assert.NoError(t, err)
+	// Вызовы без токена расходуют общую квоту IP адреса, а не квоту каждого нового токена.
+	for i, want := range []codes.Code{codes.OK, codes.OK, codes.ResourceExhausted} {
+		_, err = client.AddByText(context.Background(), &proto.StringForm{Link: "http://test.ru/ip" + strconv.Itoa(i)})
+		assert.Equal(t, want, status.Code(err))
+	}
+}
+
+func TestShortener_StatusError(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer l.Close()
+	conf := config.NewConfig()
+	storage := repository.NewStorage(conf)
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(MyUnaryInterceptor(testKeys)))
+	proto.RegisterShortenerServer(grpcServer, New(storage, conf))
+	go grpcServer.Serve(l)
+	defer grpcServer.Stop()
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewShortenerClient(conn)
+	reason := func(err error) string {
+		for _, d := range status.Convert(err).Details() {
+			if info, ok := d.(*errdetails.ErrorInfo); ok {
+				return info.Reason
+			}
+		}
+		return ""
+	}
+	_, err = client.GetByHashURL(context.Background(), &proto.StringForm{Link: "000000"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "not_found", reason(err))
+	hash, err := storage.InsertLink(context.Background(), "http://test.test/once", "sadASdQeAWDwdAs",
+		repository.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	_, err = client.GetByHashURL(context.Background(), &proto.StringForm{Link: hash})
+	require.NoError(t, err)
+	_, err = client.GetByHashURL(context.Background(), &proto.StringForm{Link: hash})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "gone", reason(err))
+	// До начала срока действия и после его окончания возвращаются разные коды.
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	hash, err = storage.InsertLink(context.Background(), "http://test.test/soon", "sadASdQeAWDwdAs",
+		repository.LinkOptions{NotBefore: &future})
+	require.NoError(t, err)
+	_, err = client.GetByHashURL(context.Background(), &proto.StringForm{Link: hash})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "not_active", reason(err))
+	hash, err = storage.InsertLink(context.Background(), "http://test.test/expired", "sadASdQeAWDwdAs",
+		repository.LinkOptions{NotAfter: &past})
+	require.NoError(t, err)
+	_, err = client.GetByHashURL(context.Background(), &proto.StringForm{Link: hash})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "gone", reason(err))
+	b, err := json.Marshal(repository.FullURL{Full: "http://test.test/rule", MaxClicks: -1})
+	require.NoError(t, err)
+	_, err = client.PostJSON(context.Background(), &proto.PostJSONRespReq{Json: b})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "invalid", reason(err))
+}
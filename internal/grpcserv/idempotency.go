@@ -0,0 +1,77 @@
+package grpcserv
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/idempotency"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
+)
+
+// IdempotencyInterceptor - перехватчик, поддерживающий ключ идемпотентности (метаданные idempotency-key) в методах
+// создания URL. Успешный ответ на вызов с ключом сохраняется для пользователя и метода и возвращается при повторе
+// вызова с тем же ключом, с метаданными idempotent-replayed. Ключ, использованный для вызова с другим запросом,
+// отклоняется с ошибкой codes.FailedPrecondition, а повтор вызова, который еще выполняется, - с codes.Aborted.
+// Ошибки не сохраняются. Пользователь определяется по токену, проверенному связкой ключей k, поэтому перехватчик
+// должен стоять до MyUnaryInterceptor, а вызов с ключом без подлинного токена отклоняется с codes.FailedPrecondition.
+// Если поддержка ключей выключена в конфигурации, то вызовы передаются дальше без изменений.
+func IdempotencyInterceptor(c *config.Config, k *auth.Keyring) grpc.UnaryServerInterceptor {
+	var store *idempotency.Store[proto.Message]
+	if c.IdempotencyTTL > 0 {
+		store = idempotency.New[proto.Message](c.IdempotencyTTL)
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		keys := md.Get(idempotency.Metadata)
+		msg, ok := req.(proto.Message)
+		if store == nil || methodGroups[info.FullMethod] != ratelimit.Create || !ok || len(keys) == 0 || keys[0] == "" {
+			return handler(ctx, req)
+		}
+		claims, ok := verifyToken(ctx, k)
+		if !ok {
+			return nil, status.Error(codes.FailedPrecondition, "idempotency key requires a valid user token")
+		}
+		if err := idempotency.ValidKey(keys[0]); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		key := idempotency.Key{UserID: claims.UserID, Scope: info.FullMethod, Key: keys[0]}
+		stored, replay, err := store.Begin(key, idempotency.Fingerprint(body))
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			return nil, status.Error(codes.Aborted, err.Error())
+		case errors.Is(err, idempotency.ErrMismatch):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		case replay:
+			grpc.SetHeader(ctx, metadata.Pairs(idempotency.ReplayedHeader, "true"))
+			return proto.Clone(stored), nil
+		}
+		// Если ответ не сохранен (в том числе при панике обработчика), ключ освобождается.
+		completed := false
+		defer func() {
+			if !completed {
+				store.Abort(key)
+			}
+		}()
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		if result, ok := resp.(proto.Message); ok {
+			store.Complete(key, proto.Clone(result))
+			completed = true
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,57 @@
+package grpcserv
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
+)
+
+// WithAPIKeys - задает разрешенные API ключи клиентов, общие с другими серверами сервиса (например, HTTP).
+func WithAPIKeys(keys auth.APIKeys) Option {
+	return func(s *Shortener) {
+		s.apiKeys = keys
+	}
+}
+
+// apiKey - возвращает идентификатор API ключа из метаданных вызова, если ключ разрешен набором keys.
+func apiKey(ctx context.Context, keys auth.APIKeys) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(ratelimit.APIKeyHeader)
+	if len(values) == 0 {
+		return "", false
+	}
+	return keys.Identify(values[0])
+}
+
+// quotaIdentity - возвращает пользователя, на которого расходуется квота: разрешенный API ключ, если он передан,
+// иначе пользователь userid из токена. Вызов без токена расходует квоту IP адреса клиента,
+// иначе каждый такой вызов получал бы новый токен и полную квоту.
+func (s *Shortener) quotaIdentity(ctx context.Context, userid string) quota.Identity {
+	if key, ok := apiKey(ctx, s.apiKeys); ok {
+		return quota.Identity{Tier: quota.TierAPIKey, ID: key}
+	}
+	if tokenIssued(ctx) {
+		return quota.Identity{Tier: quota.TierAnonymous, ID: peerIP(ctx)}
+	}
+	return quota.Identity{Tier: quota.TierAnonymous, ID: userid}
+}
+
+// reserveQuota - расходует квоту пользователя на создание n URL.
+// Если квота исчерпана, то возвращает ошибку codes.ResourceExhausted.
+func (s *Shortener) reserveQuota(ctx context.Context, userid string, n int) (quota.Identity, error) {
+	id := s.quotaIdentity(ctx, userid)
+	if err := s.quota.Reserve(id, n); err != nil {
+		if errors.Is(err, quota.ErrDailyQuotaExceeded) || errors.Is(err, quota.ErrTotalQuotaExceeded) {
+			return id, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return id, status.Error(codes.Internal, err.Error())
+	}
+	return id, nil
+}
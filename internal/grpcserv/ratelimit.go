@@ -0,0 +1,78 @@
+package grpcserv
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
+)
+
+// methodGroups - группы ограничения частоты запросов методов gRPC сервиса.
+var methodGroups = map[string]string{
+	"/shortener.Shortener/AddByText":    ratelimit.Create,
+	"/shortener.Shortener/PostJSON":     ratelimit.Create,
+	"/shortener.Shortener/PostBatch":    ratelimit.Create,
+	"/shortener.Shortener/GetByHashURL": ratelimit.Redirect,
+	"/shortener.Shortener/Stats":        ratelimit.Admin,
+	"/shortener.Shortener/Delete":       ratelimit.Admin,
+	"/shortener.Shortener/GetUserURLs":  ratelimit.Admin,
+	"/shortener.Shortener/Register":     ratelimit.Create,
+	"/shortener.Shortener/Login":        ratelimit.Admin,
+}
+
+// RateLimitInterceptor - перехватчик, ограничивающий частоту вызовов методов по ключу клиента.
+// При превышении бюджета возвращает ошибку codes.ResourceExhausted и время ожидания в метаданных retry-after.
+// Пользователь определяется по токену, проверенному связкой ключей k, клиент - по API ключу из набора apiKeys.
+func RateLimitInterceptor(limiters ratelimit.Limiters, c *config.Config, k *auth.Keyring, apiKeys auth.APIKeys) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		group, ok := methodGroups[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+		if ok, wait := limiters.Allow(group, rateKey(ctx, c.RateLimitKey, k, apiKeys)); !ok {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rateKey - возвращает ключ, по которому учитываются вызовы клиента: API ключ, токен пользователя
+// или IP адрес, в зависимости от способа mode. Если разрешенного API ключа или подлинного токена нет,
+// то используется IP адрес соединения.
+func rateKey(ctx context.Context, mode string, k *auth.Keyring, apiKeys auth.APIKeys) string {
+	switch mode {
+	case ratelimit.KeyAPIKey:
+		if key, ok := apiKey(ctx, apiKeys); ok {
+			return "key:" + key
+		}
+	case ratelimit.KeyUser:
+		if claims, ok := verifyToken(ctx, k); ok {
+			return "user:" + claims.UserID
+		}
+	}
+	return peerIP(ctx)
+}
+
+// peerIP - возвращает ключ IP адреса соединения клиента вызова.
+func peerIP(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		return "ip:" + strings.TrimSpace(addr)
+	}
+	return "ip:"
+}
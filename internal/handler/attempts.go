@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter - ограничитель неудачных попыток по ключу (например, URL и IP пользователя).
+// После max неудачных попыток ключ блокируется на время window.
+type attemptLimiter struct {
+	max       int
+	window    time.Duration
+	items     map[string]*attempt
+	nextSweep time.Time
+	sync.Mutex
+}
+
+// attempt - счетчик неудачных попыток ключа.
+type attempt struct {
+	count int
+	until time.Time
+}
+
+// newAttemptLimiter - конструктор ограничителя, при max <= 0 ограничение отключено.
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:    max,
+		window: window,
+		items:  make(map[string]*attempt),
+	}
+}
+
+// Blocked - сообщает, заблокирован ли ключ, и возвращает оставшееся время блокировки.
+func (l *attemptLimiter) Blocked(key string) (time.Duration, bool) {
+	if l.max <= 0 {
+		return 0, false
+	}
+	l.Lock()
+	defer l.Unlock()
+	a, ok := l.items[key]
+	if !ok {
+		return 0, false
+	}
+	left := time.Until(a.until)
+	if left <= 0 {
+		delete(l.items, key)
+		return 0, false
+	}
+	return left, a.count >= l.max
+}
+
+// Count - возвращает количество неудачных попыток ключа, учитываемых в текущий момент.
+func (l *attemptLimiter) Count(key string) int {
+	if l.max <= 0 {
+		return 0
+	}
+	l.Lock()
+	defer l.Unlock()
+	a, ok := l.items[key]
+	if !ok || time.Now().After(a.until) {
+		return 0
+	}
+	return a.count
+}
+
+// Fail - учитывает неудачную попытку ключа.
+func (l *attemptLimiter) Fail(key string) {
+	if l.max <= 0 {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	if now.After(l.nextSweep) {
+		l.sweep(now)
+		l.nextSweep = now.Add(l.window)
+	}
+	a, ok := l.items[key]
+	if !ok || now.After(a.until) {
+		a = &attempt{}
+		l.items[key] = a
+	}
+	a.count++
+	a.until = now.Add(l.window)
+}
+
+// Reset - сбрасывает счетчик попыток ключа после удачной попытки.
+func (l *attemptLimiter) Reset(key string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.items, key)
+}
+
+// sweep - удаляет устаревшие счетчики, чтобы хранилище не росло бесконечно.
+func (l *attemptLimiter) sweep(now time.Time) {
+	for k, a := range l.items {
+		if now.After(a.until) {
+			delete(l.items, k)
+		}
+	}
+}
@@ -1,59 +1,121 @@
 package handler
 
 import (
-	"crypto/aes"
+	"context"
 	"crypto/rand"
-	"encoding/hex"
+	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
 )
 
-// CookiesMiddleware - middleware, проверяющяя в запросе cookie на наличие/подлинность.
-// Если cookie нет, то генерируем новую и вставляем в Header. Алгоритм подписи - AES.
-func CookiesMiddleware(next http.Handler) http.Handler {
+// WithKeyring - задает связку ключей токенов пользователя, общую с другими серверами сервиса (например, gRPC).
+func WithKeyring(k *auth.Keyring) Option {
+	return func(h *ServerHandler) {
+		h.keys = k
+	}
+}
+
+// CookiesMiddleware - middleware, проверяющяя токен пользователя в заголовке Authorization или cookie.
+// Если токена нет или cookie не прошла проверку, то создаем нового пользователя и выдаем ему cookie,
+// а на неверный токен в заголовке отвечаем 401. Cookie, подписанную прежним ключом или выданную больше половины
+// срока назад, выдаем заново тому же пользователю. Идентификатор пользователя передается дальше в контексте запроса.
+func (h ServerHandler) CookiesMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Инициализируем буфер-переменную куда будем кодировать-декодировать cookie.
-		cookieBuf := make([]byte, aes.BlockSize)
-		// Секретный ключ.
-		key := []byte("HdUeLk85Gp0i7pLh")
-		// Проверочное слово.
-		nonce := []byte("cookie")
-		// Интерфейс шифрования.
-		aesBlock, err := aes.NewCipher(key)
-		if err != nil {
-			log.Fatal(err)
-		}
-		// Проверка наличия cookie.
-		if userCookie, err := r.Cookie("shortener"); err == nil {
-			// Дешифровка cookie в строку.
-			requestUserIDByte, err := hex.DecodeString(userCookie.Value)
-			if err != nil {
-				log.Printf("Cookie decoding: %v\n", err)
+		// Проверка наличия и подлинности токена.
+		token, bearer := auth.FromRequest(r)
+		if token != "" || bearer {
+			claims, err := h.keys.Verify(token)
+			if err == nil {
+				if !bearer && h.keys.Stale(claims) {
+					if err = h.setUserCookie(w, r, claims.UserID); err != nil {
+						log.Printf("Cookie refresh: %v\n", err)
+					}
+				}
+				next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), claims.UserID)))
+				return
 			}
-			// Дешифровка строки интерфейсом шифрования.
-			aesBlock.Decrypt(cookieBuf, requestUserIDByte)
-			// Проверка на подлинность.
-			if string(cookieBuf[len(cookieBuf)-len(nonce):]) == string(nonce) {
-				next.ServeHTTP(w, r)
+			// Клиент API, передавший токен в заголовке, не должен незаметно стать новым пользователем.
+			if bearer {
+				writeProblem(w, r, http.StatusUnauthorized, err.Error())
 				return
 			}
 		}
-		// Если cookie не обнаружено или она не прошла проверку подлиности, создаем новую cookie.
-		userID, err := generateRandom(10)
+		// Если cookie не обнаружено или она не прошла проверку подлиности, создаем нового пользователя.
+		userID, err := auth.NewUserID()
 		if err != nil {
-			log.Printf("UserID generate: %v\n", err)
+			writeError(w, r, err)
+			return
 		}
-		aesBlock.Encrypt(cookieBuf, append(userID, nonce...))
-		cookie := &http.Cookie{
-			Name: "shortener", Value: hex.EncodeToString(cookieBuf),
-			Expires: time.Now().Add(time.Hour * 24),
-			Path:    `/`,
+		if err = h.setUserCookie(w, r, userID); err != nil {
+			writeError(w, r, err)
+			return
 		}
-		http.SetCookie(w, cookie)
-		r.AddCookie(cookie)
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), cookieIssuedKey{}, true)
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(ctx, userID)))
+	})
+}
+
+// setUserCookie - выдает пользователю userID cookie с новым токеном.
+func (h ServerHandler) setUserCookie(w http.ResponseWriter, r *http.Request, userID string) error {
+	token, claims, err := h.keys.Issue(userID)
+	if err != nil {
+		return err
+	}
+	// Cookie недоступна скриптам страниц и не передается в запросах, отправленных с других сайтов,
+	// а для запросов по HTTPS - и по HTTP.
+	http.SetCookie(w, &http.Cookie{
+		Name: auth.Cookie, Value: token,
+		Expires:  claims.ExpiresAt,
+		Path:     `/`,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
 	})
+	return nil
+}
+
+// GetToken - возвращает новый токен текущего пользователя. Токен передается в заголовке Authorization со схемой
+// Bearer или в метаданных gRPC, поэтому клиент API и gRPC работает с URL того же пользователя, что и cookie.
+func (h ServerHandler) GetToken(w http.ResponseWriter, r *http.Request) {
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	token, claims, err := h.keys.Issue(userid)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response, err := json.Marshal(struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{Token: token, ExpiresAt: claims.ExpiresAt.UTC()})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// cookieIssuedKey - ключ контекста запроса, отмечающий, что cookie пользователя выдана в этом запросе.
+type cookieIssuedKey struct{}
+
+// cookieIssued - сообщает, выдана ли cookie пользователя в этом запросе, а не передана клиентом.
+func cookieIssued(r *http.Request) bool {
+	issued, _ := r.Context().Value(cookieIssuedKey{}).(bool)
+	return issued
+}
+
+// secureRequest - сообщает, получен ли запрос по HTTPS, в том числе через прокси, завершающий TLS.
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
 }
 
 // generateRandom - генератор случайных байт длинной size.
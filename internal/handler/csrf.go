@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// CSRFCookie - cookie с токеном защиты от CSRF, значение которого клиент передает в заголовке CSRFHeader,
+	// а HTML форма - в поле CSRFField.
+	CSRFCookie = "csrf_token"
+	// CSRFHeader - заголовок запроса с токеном защиты от CSRF.
+	CSRFHeader = "X-CSRF-Token"
+	// CSRFField - поле HTML формы с токеном защиты от CSRF.
+	CSRFField = "csrf_token"
+	// csrfTokenSize - длина токена защиты от CSRF в байтах.
+	csrfTokenSize = 16
+)
+
+// csrfToken - возвращает токен защиты от CSRF из cookie запроса. Если cookie нет, то выдает новый токен.
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(CSRFCookie); err == nil && validCSRFToken(cookie.Value) {
+		return cookie.Value, nil
+	}
+	token, err := generateRandom(csrfTokenSize)
+	if err != nil {
+		return "", err
+	}
+	cookie := &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    hex.EncodeToString(token),
+		Path:     `/`,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	}
+	http.SetCookie(w, cookie)
+	r.AddCookie(cookie)
+	return cookie.Value, nil
+}
+
+// validCSRFToken - проверяет формат токена защиты от CSRF.
+func validCSRFToken(token string) bool {
+	b, err := hex.DecodeString(token)
+	return err == nil && len(b) == csrfTokenSize
+}
+
+// checkCSRF - проверяет, что токен из запроса совпадает с токеном из cookie (double submit cookie).
+// Сторонний сайт может отправить форму с cookie пользователя, но не может прочитать cookie и подставить токен.
+func checkCSRF(r *http.Request, token string) bool {
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || !validCSRFToken(cookie.Value) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+}
+
+// errCSRFToken - ошибка, показывающая, что в запросе нет верного токена защиты от CSRF.
+var errCSRFToken = errors.New("CSRF token is missing or invalid, get it from GET /api/user/csrf and pass it in the " + CSRFHeader + " header")
+
+// csrfRequired - сообщает, нужно ли проверять токен защиты от CSRF: запрос изменяет данные и пользователь
+// определяется только cookie, которую браузер передает автоматически. Запросы без cookie пользователя, а также
+// клиентов API с заголовком Authorization: Bearer или разрешенным API ключом не проверяются: сторонний сайт не может
+// передать эти заголовки из браузера пользователя. Неизвестный API ключ не освобождает запрос от проверки.
+func (h ServerHandler) csrfRequired(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	if cookieIssued(r) {
+		return false
+	}
+	if _, ok := h.apiKey(r); ok {
+		return false
+	}
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return !strings.EqualFold(scheme, "Bearer")
+}
+
+// csrfGuard - middleware, отклоняющая с ответом 403 запросы, изменяющие данные пользователя по cookie,
+// без токена защиты от CSRF в заголовке CSRFHeader, совпадающего с cookie CSRFCookie.
+func (h ServerHandler) csrfGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.csrfRequired(r) && !checkCSRF(r, r.Header.Get(CSRFHeader)) {
+			writeProblem(w, r, http.StatusForbidden, errCSRFToken.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetCSRF - обработчик эндпоинта GET /api/user/csrf, возвращает токен защиты от CSRF, который клиент передает
+// в заголовке X-CSRF-Token запросов, изменяющих данные. Если токена нет, то выдает его в cookie csrf_token.
+func (h ServerHandler) GetCSRF(w http.ResponseWriter, r *http.Request) {
+	token, err := csrfToken(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response, err := json.Marshal(struct {
+		Token string `json:"csrf_token"`
+	}{Token: token})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// CSVContentType - тип содержимого импорта и экспорта URL пользователя.
+const CSVContentType = "text/csv"
+
+// Колонки CSV импорта и экспорта URL пользователя.
+const (
+	csvURL   = "url"       // оригинальный URL.
+	csvAlias = "alias"     // идентификатор сокращенного URL, заданный пользователем.
+	csvTags  = "tags"      // метки URL, разделенные запятой или точкой с запятой.
+	csvShort = "short_url" // сокращенный URL, при импорте не используется.
+)
+
+// csvColumns - номера колонок CSV импорта. Без заголовка колонки идут в порядке url, alias, tags.
+type csvColumns map[string]int
+
+// importResult - строка ответа импорта URL: сокращенный URL или ошибка обработки строки CSV.
+type importResult struct {
+	Line  int    `json:"line"`
+	URL   string `json:"url,omitempty"`
+	Short string `json:"short_url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PostImportCSV - обработчик эндпоинта POST /api/user/urls/import.csv, принимает в теле запроса CSV с колонками
+// url, alias и tags, из которых обязательна только url. Первая строка считается заголовком, если в ней есть
+// колонка url, иначе колонки идут в этом порядке. Строки обрабатываются по одной по мере чтения запроса,
+// а результаты возвращаются потоком NDJSON, как в POST /api/shorten/stream.
+func (h ServerHandler) PostImportCSV(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	streamResponse(w, r, func(out *json.Encoder, flush func()) {
+		h.importCSV(r, userid, bufio.NewReader(r.Body), out, flush)
+	})
+}
+
+// importCSV - читает строки CSV из in, сохраняет URL и пишет результаты в out.
+func (h ServerHandler) importCSV(r *http.Request, userid string, in *bufio.Reader, out *json.Encoder, flush func()) {
+	id := h.quotaIdentity(r)
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	var columns csvColumns
+	for written := 0; ; {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// Ошибка разбора строки не прерывает импорт.
+			out.Encode(importResult{Line: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			out.Encode(importResult{Error: err.Error()})
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		if columns == nil {
+			var header bool
+			if columns, header = csvHeader(record); header {
+				continue
+			}
+		}
+		result := importResult{Line: line, URL: columns.value(record, csvURL)}
+		if result.URL == "" {
+			result.Error = "url is required"
+			out.Encode(result)
+			continue
+		}
+		alias := columns.value(record, csvAlias)
+		opts := repository.LinkOptions{Tags: repository.ParseTags(columns.value(record, csvTags))}
+		// Квота расходуется на каждый URL, после ее исчерпания обработка прекращается.
+		if err = h.quota.Reserve(id, 1); err != nil {
+			result.Error = err.Error()
+			out.Encode(result)
+			return
+		}
+		result.Short, result.Error = h.streamInsert(r, id, func(ctx context.Context) (string, error) {
+			if alias != "" {
+				return alias, h.insertCSVAlias(ctx, alias, result.URL, userid, opts)
+			}
+			return h.Storage.InsertLink(ctx, result.URL, userid, opts)
+		})
+		if err = out.Encode(result); err != nil || r.Context().Err() != nil {
+			return
+		}
+		// Результаты отправляются каждые streamFlushLines строк, а так же перед ожиданием следующих строк запроса.
+		if written++; written%streamFlushLines == 0 || in.Buffered() == 0 {
+			flush()
+		}
+	}
+}
+
+// insertCSVAlias - сохраняет URL импорта с идентификатором alias. Если идентификатор уже занят этим же URL
+// пользователя, например при повторной загрузке экспорта, то строка пропускается как уже импортированная.
+func (h ServerHandler) insertCSVAlias(ctx context.Context, alias string, fullURL string, userid string, opts repository.LinkOptions) error {
+	err := h.Storage.InsertAlias(ctx, alias, fullURL, userid, opts)
+	if !errors.Is(err, repository.ErrAliasExists) {
+		return err
+	}
+	if link, lookupErr := h.Storage.GetUserLink(ctx, alias, userid); lookupErr == nil && !link.Delete && link.FURL == fullURL {
+		return repository.ErrConflictInsert
+	}
+	return err
+}
+
+// csvHeader - определяет колонки CSV по первой строке. Строка считается заголовком, если в ней есть колонка url.
+func csvHeader(record []string) (csvColumns, bool) {
+	columns := make(csvColumns)
+	for i, name := range record {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns[csvURL]; ok {
+		return columns, true
+	}
+	return csvColumns{csvURL: 0, csvAlias: 1, csvTags: 2}, false
+}
+
+// value - возвращает значение колонки name строки CSV, пустое если колонки нет.
+// Экранирование формул, добавленное при экспорте, снимается.
+func (c csvColumns) value(record []string, name string) string {
+	i, ok := c[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	value := strings.TrimSpace(record[i])
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaChars, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// csvFormulaChars - символы, с которых табличные редакторы начинают формулу.
+const csvFormulaChars = "=+-@\t\r"
+
+// csvCell - экранирует значение ячейки CSV экспорта, которое табличный редактор выполнил бы как формулу,
+// добавляя в начало апостроф.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaChars, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// GetExportCSV - обработчик эндпоинта GET /api/user/urls/export.csv, возвращает все URL пользователя в CSV
+// с колонками url, alias, tags и short_url. Колонка alias заполняется только для URL с идентификатором, заданным
+// пользователем. Полученный файл можно загрузить в POST /api/user/urls/import.csv.
+func (h ServerHandler) GetExportCSV(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	urls, err := h.Storage.GetAllUserURLs(ctx, userid)
+	// Отсутствие URL у пользователя не является ошибкой, возвращается только заголовок.
+	if err != nil && repository.KindOf(err) != repository.KindNotFound {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", CSVContentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+	w.WriteHeader(http.StatusOK)
+	out := csv.NewWriter(w)
+	out.Write([]string{csvURL, csvAlias, csvTags, csvShort})
+	for _, u := range urls {
+		var alias string
+		if u.Alias {
+			alias = u.Short
+		}
+		out.Write([]string{csvCell(u.Full), csvCell(alias), csvCell(strings.Join(u.Tags, ",")), csvCell(h.Conf.ExpShortURL(u.Short))})
+	}
+	out.Flush()
+	if err = out.Error(); err != nil {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+}
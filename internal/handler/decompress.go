@@ -12,7 +12,7 @@ func Decompress(next http.Handler) http.Handler {
 		if r.Header.Get(`Content-Encoding`) == `gzip` {
 			g, err := gzip.NewReader(r.Body)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeProblem(w, r, http.StatusBadRequest, err.Error())
 				return
 			}
 			r.Body = g
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/events"
+)
+
+// EventStreamContentType - тип содержимого потока событий (Server-Sent Events).
+const EventStreamContentType = "text/event-stream"
+
+// WithEvents - задает шину событий URL, в которую публикует события хранилище.
+func WithEvents(bus *events.Bus) Option {
+	return func(h *ServerHandler) {
+		h.events = bus
+	}
+}
+
+// GetEvents - обработчик эндпоинта GET /api/user/events, передает события URL пользователя потоком Server-Sent Events:
+// создание, удаление, переход и окончание срока действия. Клиент, переподключившийся с заголовком Last-Event-ID,
+// сначала получает пропущенные события, если они еще хранятся в шине. Пока событий нет, каждые EventsHeartbeat
+// передается комментарий, чтобы соединение не закрывалось прокси.
+func (h ServerHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	if h.events == nil {
+		writeProblem(w, r, http.StatusServiceUnavailable, "events are disabled")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, r, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	var lastID uint64
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "Last-Event-ID must be an event id")
+			return
+		}
+	}
+	sub, backlog := h.events.Subscribe(userid, lastID)
+	defer sub.Close()
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range backlog {
+		if writeEvent(w, e) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	// Нулевой период выключает комментарии-пульс.
+	var heartbeat <-chan time.Time
+	if h.Conf.EventsHeartbeat > 0 {
+		ticker := time.NewTicker(h.Conf.EventsHeartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			// Подписка отменена: клиент переподключится и получит пропущенные события по Last-Event-ID.
+			if !ok || writeEvent(w, e) != nil {
+				return
+			}
+		case <-heartbeat:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent - пишет событие в формате Server-Sent Events.
+func writeEvent(w io.Writer, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -15,7 +15,10 @@ import (
 func ExampleServerHandler_FullURLHashBy() {
 	cnf := config.NewConfig()
 	controller := repository.NewStorage(cnf)
-	r := NewRouter(controller, cnf)
+	r, err := NewRouter(controller, cnf)
+	if err != nil {
+		log.Fatal(err)
+	}
 	hash, err := controller.InsertURL(context.Background(), "http://test.test/test", "sadASdQeAWDwdAs")
 	if err != nil {
 		log.Fatal(err)
@@ -40,7 +43,10 @@ func ExampleServerHandler_FullURLHashBy() {
 func ExampleServerHandler_ShortURLTextBy() {
 	cnf := config.NewConfig()
 	controller := repository.NewStorage(cnf)
-	r := NewRouter(controller, cnf)
+	r, err := NewRouter(controller, cnf)
+	if err != nil {
+		log.Fatal(err)
+	}
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 	req, err := http.NewRequest(http.MethodPost, ts.URL+"/", bytes.NewBuffer([]byte("http://www.test.test/test")))
@@ -57,7 +63,10 @@ func ExampleServerHandler_ShortURLTextBy() {
 func ExampleServerHandler_ShortURLJSONBy() {
 	cnf := config.NewConfig()
 	controller := repository.NewStorage(cnf)
-	r := NewRouter(controller, cnf)
+	r, err := NewRouter(controller, cnf)
+	if err != nil {
+		log.Fatal(err)
+	}
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 	b, err := json.Marshal(repository.FullURL{
@@ -83,7 +92,10 @@ func ExampleServerHandler_ShortURLJSONBy() {
 func ExampleServerHandler_Ping() {
 	cnf := config.NewConfig()
 	controller := repository.NewStorage(cnf)
-	r := NewRouter(controller, cnf)
+	r, err := NewRouter(controller, cnf)
+	if err != nil {
+		log.Fatal(err)
+	}
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 	req, err := http.NewRequest(http.MethodGet, ts.URL+"/ping", bytes.NewBuffer([]byte("")))
@@ -100,7 +112,10 @@ func ExampleServerHandler_Ping() {
 func ExampleServerHandler_GetAllUserURLs() {
 	cnf := config.NewConfig()
 	controller := repository.NewStorage(cnf)
-	r := NewRouter(controller, cnf)
+	r, err := NewRouter(controller, cnf)
+	if err != nil {
+		log.Fatal(err)
+	}
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 	req, err := http.NewRequest(http.MethodPost, ts.URL+"/", bytes.NewBuffer([]byte("http://www.test.test/test")))
@@ -5,95 +5,223 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"net"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/events"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/idempotency"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/openapi"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
 )
 
 // NewRouter - функция инициализирующая и настраивающая роутер сервиса.
-func NewRouter(s repository.Storager, c *config.Config) chi.Router {
+// Возвращает ошибку, если описание API, ключи токенов, API ключи или доверенные прокси из конфигурации некорректны.
+func NewRouter(s repository.Storager, c *config.Config, options ...Option) (chi.Router, error) {
 	// Инициализация контролера всех хэндлеров приложения.
 	controller := newServerHandler(s, c)
+	for _, opt := range options {
+		opt(controller)
+	}
+	// Проверка запросов по описанию API включается в конфигурации.
+	if c.ValidateRequests {
+		validator, err := openapi.NewValidator()
+		if err != nil {
+			return nil, err
+		}
+		controller.validator = validator
+	}
+	// Если связка ключей токенов пользователя не передана, то она создается из конфигурации.
+	if controller.keys == nil {
+		keys, err := auth.Load(c)
+		if err != nil {
+			return nil, err
+		}
+		controller.keys = keys
+	}
+	// Заголовки с адресом клиента учитываются только от доверенных прокси из конфигурации.
+	proxies, err := parseProxies(c.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	controller.proxies = proxies
+	// Если набор API ключей не передан, то он создается из конфигурации.
+	if controller.apiKeys == nil {
+		apiKeys, err := auth.LoadAPIKeys(c)
+		if err != nil {
+			return nil, err
+		}
+		controller.apiKeys = apiKeys
+	}
+	// Поддержка ключей идемпотентности выключается нулевым временем хранения ответов.
+	if c.IdempotencyTTL > 0 {
+		controller.idempotency = idempotency.New[storedResponse](c.IdempotencyTTL)
+	}
 	// Инициализация роутера chi.
 	router := chi.NewRouter()
 	// Запуск поддержки встроенных middleware.
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	router.Use(keepConnAddr)
+	router.Use(controller.realIP)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 	// Запуск пользовательских middleware.
-	router.Use(middleware.Compress(1, `text/plain`, `application/json`))
 	router.Use(middleware.AllowContentEncoding(`gzip`))
 	router.Use(Decompress)
-	router.Use(CookiesMiddleware)
+	router.Use(controller.CookiesMiddleware)
+	// Сжатие ответов подключается в группах маршрутов: потоковые ответы не сжимаются.
+	compress := middleware.Compress(1, `text/plain`, `application/json`)
 	// Запуск хэндлеров и их паттерны.
 	router.Route("/", func(router chi.Router) {
-		router.Post("/", controller.ShortURLTextBy)
-		router.Get("/{hash}", controller.FullURLHashBy)
-		router.Get("/ping", controller.Ping)
-
-		router.Route("/api", func(router chi.Router) {
-			router.Get("/internal/stats", controller.GetStats)
-			router.Delete("/user/urls", controller.DeleteBatch)
-			router.Get("/user/urls", controller.GetAllUserURLs)
-			router.Post("/shorten", controller.ShortURLJSONBy)
-			router.Post("/shorten/batch", controller.PostBatch)
+		router.With(compress).Get("/ping", controller.Ping)
+		router.With(compress).Get("/api/openapi.json", controller.OpenAPI)
+		// Переходы по сокращенным URL.
+		router.Group(func(router chi.Router) {
+			router.Use(compress)
+			router.Use(controller.rateLimit(ratelimit.Redirect))
+			router.Use(controller.validateRequest)
+			router.Use(controller.scanGuard)
+			router.Get("/{hash}", controller.FullURLHashBy)
+			router.Head("/{hash}", controller.FullURLHashBy)
+			router.Get("/{hash}/*", controller.FullURLHashBy)
+			router.Head("/{hash}/*", controller.FullURLHashBy)
+			router.Post("/{hash}/unlock", controller.UnlockURL)
+		})
+		// Создание сокращенных URL.
+		router.Group(func(router chi.Router) {
+			router.Use(compress)
+			router.Use(controller.rateLimit(ratelimit.Create))
+			router.Use(controller.validateRequest)
+			router.Use(controller.csrfGuard)
+			router.Use(controller.idempotent)
+			router.Post("/", controller.ShortURLTextBy)
+			router.Post("/api/shorten", controller.ShortURLJSONBy)
+			router.Post("/api/shorten/batch", controller.PostBatch)
+			router.Post("/api/v2/links", controller.PostLink)
+		})
+		// Потоковое создание сокращенных URL и импорт URL пользователя.
+		router.Group(func(router chi.Router) {
+			router.Use(controller.rateLimit(ratelimit.Create))
+			router.Use(controller.validateRequest)
+			router.Use(controller.csrfGuard)
+			router.Post("/api/shorten/stream", controller.PostStream)
+			router.Post("/api/user/urls/import.csv", controller.PostImportCSV)
+		})
+		// Импорт URL из других сервисов сокращения URL.
+		router.Group(func(router chi.Router) {
+			router.Use(controller.rateLimit(ratelimit.Admin))
+			router.Use(controller.validateRequest)
+			router.Use(controller.csrfGuard)
+			router.Post("/api/internal/import", controller.PostImport)
+		})
+		// Поток событий URL пользователя, ответ не сжимается.
+		router.Group(func(router chi.Router) {
+			router.Use(controller.rateLimit(ratelimit.Admin))
+			router.Use(controller.validateRequest)
+			router.Get("/api/user/events", controller.GetEvents)
+		})
+		// Веб-интерфейс управления URL пользователя.
+		router.Group(func(router chi.Router) {
+			router.Use(controller.rateLimit(ratelimit.Admin))
+			router.Use(controller.validateRequest)
+			router.Get(webPath, controller.WebLinks)
+			router.Get(webPath+"/links/{code}", controller.WebLink)
+			router.Post(webPath+"/links/{code}/delete", controller.WebDeleteLink)
+		})
+		router.Group(func(router chi.Router) {
+			router.Use(controller.rateLimit(ratelimit.Create))
+			router.Use(controller.validateRequest)
+			router.Post(webPath+"/links", controller.WebCreateLink)
+		})
+		// Управление URL пользователя и служебные запросы.
+		router.Group(func(router chi.Router) {
+			router.Use(compress)
+			router.Use(controller.rateLimit(ratelimit.Admin))
+			router.Use(controller.validateRequest)
+			router.Use(controller.csrfGuard)
+			router.Get("/api/internal/stats", controller.GetStats)
+			router.Delete("/api/user/urls", controller.DeleteBatch)
+			router.Get("/api/user/urls", controller.GetAllUserURLs)
+			router.Get("/api/user/urls/export.csv", controller.GetExportCSV)
+			router.Put("/api/user/urls/{hash}/variants", controller.SetVariants)
+			router.Get("/api/user/urls/{hash}/stats", controller.GetLinkStats)
+			router.Get("/api/user/quota", controller.GetQuota)
+			router.Get("/api/user/csrf", controller.GetCSRF)
+			router.Get("/api/user/token", controller.GetToken)
+			router.Get("/api/v2/links", controller.GetLinks)
+			router.Get("/api/v2/links/{code}", controller.GetLink)
+			router.Patch("/api/v2/links/{code}", controller.PatchLink)
+			router.Delete("/api/v2/links/{code}", controller.DeleteLink)
 		})
 	})
 	// Запуск хэндлеров обработчиков не поддерживаемых методов и маршрутов.
 	router.NotFound(NotFound())
 	router.MethodNotAllowed(NotAllowed())
 
-	return router
+	return router, nil
 }
 
 // ServerHandler - структура контроллера роутера.
 type ServerHandler struct {
-	Storage repository.Storager
-	Conf    *config.Config
+	Storage  repository.Storager
+	Conf     *config.Config
+	attempts *attemptLimiter
+	// linkAttempts - неудачные попытки ввода пароля URL от всех клиентов.
+	linkAttempts *attemptLimiter
+	limiters     ratelimit.Limiters
+	scans        *attemptLimiter
+	quota        *quota.Quota
+	// validator - проверка запросов по описанию API, nil если проверка выключена.
+	validator *openapi.Validator
+	// idempotency - сохраненные ответы по ключам идемпотентности, nil если поддержка ключей выключена.
+	idempotency *idempotency.Store[storedResponse]
+	// events - шина событий URL, nil если события не публикуются.
+	events *events.Bus
+	// keys - связка ключей токенов пользователя.
+	keys *auth.Keyring
+	// apiKeys - разрешенные API ключи клиентов.
+	apiKeys auth.APIKeys
+	// proxies - подсети доверенных прокси, которые передают адрес клиента в заголовках.
+	proxies []*net.IPNet
 }
 
 // newServerHandler - конструктор контроллера.
 func newServerHandler(s repository.Storager, c *config.Config) *ServerHandler {
-	return &ServerHandler{Storage: s, Conf: c}
+	return &ServerHandler{
+		Storage:      s,
+		Conf:         c,
+		attempts:     newAttemptLimiter(c.PasswordMaxAttempts, c.PasswordLockout),
+		linkAttempts: newAttemptLimiter(c.PasswordMaxLinkAttempts, c.PasswordLockout),
+		limiters:     ratelimit.NewLimiters(c),
+		scans:        newAttemptLimiter(c.ScanMaxNotFound, c.ScanBan),
+		quota:        quota.New(c),
+	}
 }
 
 // GetStats - обработчик эндпоинта GET /api/internal/stats , проверяет реальный IP возвращает статистику по сокращенным
 // URL и пользователям в системе.
 func (h ServerHandler) GetStats(w http.ResponseWriter, r *http.Request) {
-	if h.Conf.TrustedSubnet != "" {
-		_, ipNet, err := net.ParseCIDR(h.Conf.TrustedSubnet)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
-			return
-		}
-		ip, err := GetIP(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
-			return
-		}
-		if !ipNet.Contains(ip) {
-			http.Error(w, repository.ErrCIDRContain.Error(), http.StatusForbidden)
-			return
-		}
+	if h.Conf.TrustedSubnet != "" && !h.trusted(w, r) {
+		return
 	}
-	// Инициализируем контекст
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
 	defer cancel()
 	urls, err := h.Storage.GetCountURL(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	users, err := h.Storage.GetCountUsers(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	temp := &repository.StatStruct{
@@ -102,7 +230,7 @@ func (h ServerHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	}
 	response, err := json.Marshal(temp)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.Header().Add("Content-Type", "application/json")
@@ -110,34 +238,59 @@ func (h ServerHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
+// trusted - проверяет, что реальный IP пользователя входит в доверенную сеть TrustedSubnet, иначе отвечает 403.
+func (h ServerHandler) trusted(w http.ResponseWriter, r *http.Request) bool {
+	_, ipNet, err := net.ParseCIDR(h.Conf.TrustedSubnet)
+	if err != nil {
+		writeProblem(w, r, http.StatusForbidden, err.Error())
+		return false
+	}
+	ip, err := GetIP(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusForbidden, err.Error())
+		return false
+	}
+	if !ipNet.Contains(ip) {
+		writeError(w, r, repository.ErrCIDRContain)
+		return false
+	}
+	return true
+}
+
 // ShortURLTextBy - обработчик эндпоинта POST /, принимает в теле запроса текстовую строку URL для сокращения.
 // Возвращает ответ с кодом 201 и сокращённым URL в виде текстовой строки в теле.
 func (h ServerHandler) ShortURLTextBy(w http.ResponseWriter, r *http.Request) {
-	// Инициализируем контекст
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
 	defer cancel()
 	// Читаем тело и проверяем ошибку.
 	textURL, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 	// Считываем cookie пользователя.
-	userID, err := r.Cookie("shortener")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	// Расходуем квоту пользователя на создание URL.
+	id, ok := h.reserveQuota(w, r, 1)
+	if !ok {
 		return
 	}
 	statusCode := http.StatusCreated
 	// Передаем полученные значения для обработки в хранилище/получаем hash сокращенного url.
-	hash, err := h.Storage.InsertURL(ctx, string(textURL), userID.Value)
+	hash, err := h.Storage.InsertURL(ctx, string(textURL), userid)
 	if err != nil {
+		// URL не создан, возвращаем квоту.
+		h.quota.Release(id, 1)
 		// Проверяем ошибку на соответсвие ситуации, когда вносимый URL уже в базе данных.
 		if errors.Is(err, repository.ErrConflictInsert) {
 			statusCode = http.StatusConflict
 		} else {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
 	}
@@ -149,59 +302,128 @@ func (h ServerHandler) ShortURLTextBy(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(exShortURL))
 }
 
-// FullURLHashBy -обработчик эндпоинта GET /{id} ,принимает в качестве URL-параметра идентификатор сокращённого URL.
-// Возвращает ответ с кодом 307 и оригинальным URL в HTTP-заголовке Location.
+// FullURLHashBy -обработчик эндпоинтов GET и HEAD /{id} ,принимает в качестве URL-параметра идентификатор сокращённого URL.
+// Для URL в режиме wildcard так же обрабатывает запросы /{id}/*, добавляя путь к адресу перенаправления.
+// Возвращает ответ с кодом перенаправления (по умолчанию 307) и оригинальным URL в HTTP-заголовке Location.
 func (h ServerHandler) FullURLHashBy(w http.ResponseWriter, r *http.Request) {
-	// Инициализируем контекст.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
 	defer cancel()
 	// Считываем hash сокращенного URL из параметров запроса.
 	shortURL := chi.URLParam(r, "hash")
 	if shortURL == "" {
-		http.Error(w, "ErrNoEmptyURLParam", http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, "ErrNoEmptyURLParam")
 		return
 	}
-	// Запрашиваем оригинальный URL из базы данных.
-	fullURL, err := h.Storage.GetFullURL(ctx, shortURL)
+	// Запрашиваем оригинальный URL и его настройки из базы данных.
+	link, err := h.Storage.GetLink(ctx, shortURL)
 	if err != nil {
-		if errors.Is(err, repository.ErrDeletedURL) {
-			w.WriteHeader(http.StatusGone)
+		writeError(w, r, err)
+		return
+	}
+	// Путь после идентификатора добавляется к адресу перенаправления только для URL в режиме wildcard.
+	suffix, err := pathSuffix(r)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if suffix != "" && !link.Wildcard {
+		writeError(w, r, repository.ErrNotFoundURL)
+		return
+	}
+	// Проверяем срок действия URL.
+	if !h.checkSchedule(w, r, link) {
+		return
+	}
+	// Если URL защищен паролем, проверяем пароль из заголовка или показываем форму ввода пароля.
+	if link.Protected() {
+		password := r.Header.Get(PasswordHeader)
+		if password == "" {
+			passwordForm(w, shortURL, suffix, r.URL.Query(), http.StatusUnauthorized, "")
+			return
+		}
+		if statusCode := h.verifyPassword(w, r, shortURL, link, password); statusCode != http.StatusOK {
+			writeProblem(w, r, statusCode, "")
 			return
 		}
-		http.Error(w, "NotExistURL", http.StatusNotFound)
-		return
 	}
-	if !strings.HasPrefix(fullURL, config.HTTP) {
-		fullURL = config.HTTP + strings.TrimPrefix(fullURL, "//")
+	fullURL, variant := destination(w, r, shortURL, link)
+	fullURL = link.Location(fullURL, suffix, r.URL.Query(), h.Conf.QueryConflict)
+	// Учитываем переход, запрос HEAD переходом не считается.
+	if r.Method != http.MethodHead {
+		if err = h.Storage.Click(ctx, shortURL, variant); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	redirect(w, link, fullURL, h.redirectCode(link))
+}
+
+// checkSchedule - проверяет срок действия URL и, если он не действует, формирует ответ.
+// До начала действия перенаправляет на резервный URL (заданный для URL или в конфигурации), если он есть,
+// иначе отвечает 403 с типом ProblemNotActive. После окончания действия отвечает 410 с типом ProblemExpired.
+func (h ServerHandler) checkSchedule(w http.ResponseWriter, r *http.Request, link repository.URL) bool {
+	err := link.CheckSchedule(time.Now())
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, repository.ErrNotActiveURL) {
+		fallback := link.FallbackURL
+		if fallback == "" {
+			fallback = h.Conf.InactiveURL
+		}
+		if fallback != "" {
+			w.Header().Set("Cache-Control", "private, no-store")
+			w.Header().Set("Location", fallback)
+			w.WriteHeader(http.StatusFound)
+			return false
+		}
 	}
+	writeError(w, r, err)
+	return false
+}
+
+// redirect - формирует ответ с перенаправлением по сокращенному URL на адрес fullURL.
+func redirect(w http.ResponseWriter, link repository.URL, fullURL string, code int) {
+	w.Header().Set("Cache-Control", linkCacheControl(link, code))
 	w.Header().Set("Location", fullURL)
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	w.WriteHeader(code)
+}
+
+// redirectCode - возвращает код перенаправления для URL: заданный при создании или глобальный из конфигурации.
+func (h ServerHandler) redirectCode(link repository.URL) int {
+	if link.RedirectCode != 0 {
+		return link.RedirectCode
+	}
+	if repository.IsRedirectCode(h.Conf.RedirectCode) {
+		return h.Conf.RedirectCode
+	}
+	return config.RedirectCode
 }
 
 // ShortURLJSONBy - обработчик эндпоинта POST /api/shorten,принимает в теле запроса json с оригинальным URL.
 // Возвращает JSON с сокращенным URL.
 func (h ServerHandler) ShortURLJSONBy(w http.ResponseWriter, r *http.Request) {
-	// Инициализируем контекст.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
 	defer cancel()
 	// Читаем тело запроса.
 	reqBody, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 	// Десерриализуем тело запроса в структуру оригинального URL.
 	var full repository.FullURL
 	err = json.Unmarshal(reqBody, &full)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 	// Считываем cookie пользователя.
-	userid, err := r.Cookie("shortener")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userid, ok := userID(w, r)
+	if !ok {
 		return
 	}
 	statusCode := http.StatusCreated
@@ -209,13 +431,25 @@ func (h ServerHandler) ShortURLJSONBy(w http.ResponseWriter, r *http.Request) {
 	var sURL repository.ShortURL
 	// Передаем данные для сохранения/проверки на сокхранение URL методу базы данных.
 	// Возвращает хэш сохраненного URL.
-	sURL.Short, err = h.Storage.InsertURL(ctx, full.Full, userid.Value)
+	opts, err := full.Options()
 	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Расходуем квоту пользователя на создание URL.
+	id, ok := h.reserveQuota(w, r, 1)
+	if !ok {
+		return
+	}
+	sURL.Short, err = h.Storage.InsertLink(ctx, full.Full, userid, opts)
+	if err != nil {
+		// URL не создан, возвращаем квоту.
+		h.quota.Release(id, 1)
 		// Проверяем ошибку на соответсвие ситуации, когда вносимый URL уже в базе данных.
 		if errors.Is(err, repository.ErrConflictInsert) {
 			statusCode = http.StatusConflict
 		} else {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, r, err)
 			return
 		}
 	}
@@ -224,7 +458,7 @@ func (h ServerHandler) ShortURLJSONBy(w http.ResponseWriter, r *http.Request) {
 	// Сериализуем готовую структуру в JSON.
 	respBody, err := json.Marshal(sURL)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	// Формируем ответ.
@@ -235,19 +469,23 @@ func (h ServerHandler) ShortURLJSONBy(w http.ResponseWriter, r *http.Request) {
 
 // GetAllUserURLs - обработчик эндпоинта GET /api/user/urls, считывая userid из cookie возвращает все URL пользователя.
 func (h ServerHandler) GetAllUserURLs(w http.ResponseWriter, r *http.Request) {
-	// Инициализируем контекст.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
 	defer cancel()
 	// Считываем cookie пользователя.
-	userid, err := r.Cookie("shortener")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userid, ok := userID(w, r)
+	if !ok {
 		return
 	}
 	// Готовим массив с hash сохраненных URL пользвателя.
-	urls, err := h.Storage.GetAllUserURLs(ctx, userid.Value)
+	urls, err := h.Storage.GetAllUserURLs(ctx, userid)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNoContent)
+		// Отсутствие URL у пользователя не является ошибкой.
+		if repository.KindOf(err) == repository.KindNotFound {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeError(w, r, err)
 		return
 	}
 	// Формируем поля с сокращенными URL.
@@ -257,7 +495,7 @@ func (h ServerHandler) GetAllUserURLs(w http.ResponseWriter, r *http.Request) {
 	// Серриализуем полученный массив со структурами в JSON.
 	urlsJSON, err := json.Marshal(urls)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	// Формируем ответ.
@@ -268,49 +506,54 @@ func (h ServerHandler) GetAllUserURLs(w http.ResponseWriter, r *http.Request) {
 
 // Ping - обработчик эндпоинта GET /ping , отражает доступность базы данных.
 func (h ServerHandler) Ping(w http.ResponseWriter, r *http.Request) {
-	// Инициализируем контекст.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.PingTimeout)
 	defer cancel()
-	err := h.Storage.Ping(ctx)
-	statusCode := http.StatusOK
-	if err != nil {
-		statusCode = http.StatusInternalServerError
+	if err := h.Storage.Ping(ctx); err != nil {
+		writeError(w, r, repository.Wrap(repository.KindUnavailable, err))
+		return
 	}
-	w.WriteHeader(statusCode)
+	w.WriteHeader(http.StatusOK)
 }
 
 // PostBatch - обработчик эндпоинта POST /api/shorten/batch , принимает в теле запроса массив с JSON.
 // Возвращет массив с JSON .
 func (h ServerHandler) PostBatch(w http.ResponseWriter, r *http.Request) {
-	// Инициализируем контекст.
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
 	defer cancel()
 	// Читаем тело запроса.
 	body, err := io.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 	// Получаем cookie пользователя.
-	userid, err := r.Cookie("shortener")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userid, ok := userID(w, r)
+	if !ok {
 		return
 	}
 	// Готовим массив со структурами и десерриализуем в него тело запроса.
 	var urls []repository.FullBatch
 	if err = json.Unmarshal(body, &urls); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Расходуем квоту пользователя сразу на все URL пакета.
+	id, ok := h.reserveQuota(w, r, len(urls))
+	if !ok {
 		return
 	}
 	// Готовим массив со структурами для ответа.
 	var result []repository.ShortBatch
 	// Итерируемся по массиву с полученными данными и сохраняем в базу данных.
 	for i := range urls {
-		short, err := h.Storage.InsertURL(ctx, urls[i].Full, userid.Value)
+		short, err := h.Storage.InsertURL(ctx, urls[i].Full, userid)
 		if err != nil {
 			if errors.Is(err, repository.ErrConflictInsert) {
+				// URL уже был сохранен, возвращаем квоту.
+				h.quota.Release(id, 1)
 				// Заполняем массив с ответом в случае соответсвия ошибки.
 				result = append(result, repository.ShortBatch{
 					Short: h.Conf.ExpShortURL(short),
@@ -318,7 +561,9 @@ func (h ServerHandler) PostBatch(w http.ResponseWriter, r *http.Request) {
 				})
 				continue
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				// Возвращаем квоту на URL, которые не были созданы.
+				h.quota.Release(id, len(urls)-i)
+				writeError(w, r, err)
 				return
 			}
 		}
@@ -331,7 +576,7 @@ func (h ServerHandler) PostBatch(w http.ResponseWriter, r *http.Request) {
 	// Серриализуем массив с ответом в JSON.
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 	// Формируем ответ.
@@ -343,19 +588,16 @@ func (h ServerHandler) PostBatch(w http.ResponseWriter, r *http.Request) {
 // DeleteBatch - обработчик эндпоинта DELETE /api/user/urls , принимает в теле запроса JSON.
 // Запускает асинхронный процесс удаления этих URL.
 func (h ServerHandler) DeleteBatch(w http.ResponseWriter, r *http.Request) {
-	// Инициализируем контекст.
-	ctx := context.Background()
 	defer r.Body.Close()
 	// Читаем тело запроса.
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 	// Получаем cookie пользователя.
-	userid, err := r.Cookie("shortener")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userid, ok := userID(w, r)
+	if !ok {
 		return
 	}
 	// Создаем массив для разбора тела запроса.
@@ -364,12 +606,18 @@ func (h ServerHandler) DeleteBatch(w http.ResponseWriter, r *http.Request) {
 	// Парсим запрос и записываем результат в массив для разбора.
 	err = json.Unmarshal(body, &hashes)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 	// В отдельной горутине запускаем процесс удаления.
-	// Передаем горутине список и cookie.
-	go h.Storage.Delete(ctx, hashes, userid.Value)
+	// Удаление продолжается после ответа, поэтому его контекст не зависит от контекста запроса.
+	go func() {
+		ctx, cancel := repository.WithTimeout(context.Background(), h.Conf.DeleteTimeout)
+		defer cancel()
+		if err := h.Storage.Delete(ctx, hashes, userid); err != nil {
+			log.Printf("delete user URLs: %v", err)
+		}
+	}()
 	// Пишем ответ.
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -377,15 +625,13 @@ func (h ServerHandler) DeleteBatch(w http.ResponseWriter, r *http.Request) {
 // NotFound - обработчик неподдерживаемых маршрутов.
 func NotFound() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(400)
-		w.Write([]byte("route does not exist"))
+		writeProblem(w, r, http.StatusNotFound, "route does not exist")
 	}
 }
 
 // NotAllowed - обработчик неподдерживаемых методов.
 func NotAllowed() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(400)
-		w.Write([]byte("method does not allowed"))
+		writeProblem(w, r, http.StatusMethodNotAllowed, "method does not allowed")
 	}
 }
@@ -1,23 +1,37 @@
 package handler
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/events"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/idempotency"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/importer"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/openapi"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
 	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
 )
 
@@ -26,9 +40,25 @@ func TestNewRouter(t *testing.T) {
 		storage, err := repository.NewDataSource()
 		assert.NoError(t, err)
 		conf := config.NewConfig()
-		got := NewRouter(storage, conf)
+		got, err := NewRouter(storage, conf)
+		require.NoError(t, err)
 		require.NotNil(t, got)
 	})
+	t.Run("Invalid trusted proxies", func(t *testing.T) {
+		conf := *config.NewConfig()
+		conf.TrustedProxies = "not-a-network"
+		got, err := NewRouter(repository.NewStorage(&conf), &conf)
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+}
+
+// newRouter - создает роутер сервиса для теста, прерывая тест при ошибке настройки.
+func newRouter(t *testing.T, s repository.Storager, c *config.Config, options ...Option) chi.Router {
+	t.Helper()
+	r, err := NewRouter(s, c, options...)
+	require.NoError(t, err)
+	return r
 }
 
 func TestNewServerHandler(t *testing.T) {
@@ -38,7 +68,15 @@ func TestNewServerHandler(t *testing.T) {
 	}{
 		{
 			name: "Positive test",
-			want: &ServerHandler{Storage: repository.NewStorage(config.NewConfig()), Conf: config.NewConfig()},
+			want: &ServerHandler{
+				Storage:      repository.NewStorage(config.NewConfig()),
+				Conf:         config.NewConfig(),
+				attempts:     newAttemptLimiter(config.NewConfig().PasswordMaxAttempts, config.NewConfig().PasswordLockout),
+				linkAttempts: newAttemptLimiter(config.NewConfig().PasswordMaxLinkAttempts, config.NewConfig().PasswordLockout),
+				limiters:     ratelimit.NewLimiters(config.NewConfig()),
+				scans:        newAttemptLimiter(config.NewConfig().ScanMaxNotFound, config.NewConfig().ScanBan),
+				quota:        quota.New(config.NewConfig()),
+			},
 		},
 	}
 	for _, tt := range tests {
@@ -53,7 +91,7 @@ func TestServerHandler_FullURLHashBy(t *testing.T) {
 	t.Run("Positive test", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		hash, err := controller.InsertURL(context.Background(), "http://test.test/test", "sadASdQeAWDwdAs")
 		require.NoError(t, err)
 		assert.NotEmpty(t, hash)
@@ -77,7 +115,7 @@ func TestServerHandler_FullURLHashBy(t *testing.T) {
 	t.Run("Negative test with another method", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		hash, err := controller.InsertURL(context.Background(), "http://test.test/test", "sadASdQeAWDwdAs")
 		require.NoError(t, err)
 		ts := httptest.NewServer(r)
@@ -93,13 +131,16 @@ func TestServerHandler_FullURLHashBy(t *testing.T) {
 		body, err := io.ReadAll(resp.Body)
 		require.NoError(t, err)
 		defer resp.Body.Close()
-		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-		assert.Equal(t, "method does not allowed", string(body))
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+		assert.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+		var problem Problem
+		require.NoError(t, json.Unmarshal(body, &problem))
+		assert.Equal(t, "method does not allowed", problem.Detail)
 	})
 	t.Run("Negative without url in DB", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		req, err := http.NewRequest(http.MethodGet, ts.URL+"/0", nil)
@@ -114,7 +155,994 @@ func TestServerHandler_FullURLHashBy(t *testing.T) {
 		require.NoError(t, err)
 		defer resp.Body.Close()
 		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
-		assert.Equal(t, "NotExistURL\n", string(body))
+		assert.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+		var problem Problem
+		require.NoError(t, json.Unmarshal(body, &problem))
+		assert.Equal(t, Problem{
+			Type:      "about:blank",
+			Title:     "Not Found",
+			Status:    http.StatusNotFound,
+			Detail:    repository.ErrNotFoundURL.Error(),
+			Instance:  "/0",
+			Kind:      "not_found",
+			RequestID: problem.RequestID,
+		}, problem)
+		assert.NotEmpty(t, problem.RequestID)
+	})
+}
+
+func TestServerHandler_FullURLHashByRedirectCode(t *testing.T) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	t.Run("Per-link redirect code", func(t *testing.T) {
+		cnf := config.NewConfig()
+		controller := repository.NewStorage(cnf)
+		r := newRouter(t, controller, cnf)
+		hash, err := controller.InsertLink(context.Background(), "http://test.test/permanent", "sadASdQeAWDwdAs",
+			repository.LinkOptions{RedirectCode: http.StatusPermanentRedirect})
+		require.NoError(t, err)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+		resp, err := client.Get(ts.URL + "/" + hash)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+		assert.Equal(t, "public, max-age=86400", resp.Header.Get("Cache-Control"))
+	})
+	t.Run("Global redirect code", func(t *testing.T) {
+		cnf := config.NewConfig()
+		defer func(code int) { cnf.RedirectCode = code }(cnf.RedirectCode)
+		cnf.RedirectCode = http.StatusFound
+		controller := repository.NewStorage(cnf)
+		r := newRouter(t, controller, cnf)
+		hash, err := controller.InsertURL(context.Background(), "http://test.test/found", "sadASdQeAWDwdAs")
+		require.NoError(t, err)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+		resp, err := client.Get(ts.URL + "/" + hash)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, "private, no-cache", resp.Header.Get("Cache-Control"))
+	})
+	t.Run("HEAD request", func(t *testing.T) {
+		cnf := config.NewConfig()
+		controller := repository.NewStorage(cnf)
+		r := newRouter(t, controller, cnf)
+		hash, err := controller.InsertURL(context.Background(), "http://test.test/head", "sadASdQeAWDwdAs")
+		require.NoError(t, err)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+		req, err := http.NewRequest(http.MethodHead, ts.URL+"/"+hash, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, "http://test.test/head", resp.Header.Get("Location"))
+	})
+	t.Run("Negative invalid redirect code", func(t *testing.T) {
+		cnf := config.NewConfig()
+		controller := repository.NewStorage(cnf)
+		r := newRouter(t, controller, cnf)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+		b, err := json.Marshal(repository.FullURL{Full: "http://test.test/invalid", RedirectCode: http.StatusOK})
+		require.NoError(t, err)
+		resp, err := http.Post(ts.URL+"/api/shorten", "application/json", bytes.NewBuffer(b))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestServerHandler_FullURLHashByPassword(t *testing.T) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	b, err := json.Marshal(repository.FullURL{Full: "http://test.test/secret", Password: "qwerty"})
+	require.NoError(t, err)
+	resp, err := http.Post(ts.URL+"/api/shorten", "application/json", bytes.NewBuffer(b))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	// Защищенный URL не выдается при сокращении того же адреса, поэтому идентификатор берется из ответа.
+	var short repository.ShortURL
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&short))
+	hash := strings.TrimPrefix(short.Short, cnf.ExpShortURL(""))
+	_, err = controller.GetShortURL(context.Background(), "http://test.test/secret")
+	assert.Error(t, err)
+	get := func(password string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/"+hash, nil)
+		require.NoError(t, err)
+		if password != "" {
+			req.Header.Set(PasswordHeader, password)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	t.Run("Password form", func(t *testing.T) {
+		resp := get("")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	})
+	t.Run("Header password", func(t *testing.T) {
+		resp := get("qwerty")
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, "http://test.test/secret", resp.Header.Get("Location"))
+		assert.Equal(t, "private, no-store", resp.Header.Get("Cache-Control"))
+	})
+	t.Run("Form password", func(t *testing.T) {
+		resp, err := client.PostForm(ts.URL+"/"+hash+"/unlock", url.Values{"password": {"qwerty"}})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "http://test.test/secret", resp.Header.Get("Location"))
+	})
+	t.Run("Negative wrong password and lockout", func(t *testing.T) {
+		for i := 0; i < cnf.PasswordMaxAttempts; i++ {
+			assert.Equal(t, http.StatusForbidden, get("wrong").StatusCode)
+		}
+		resp := get("qwerty")
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	})
+}
+
+func TestServerHandler_PasswordLinkAttempts(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.TrustedProxies = "127.0.0.0/8, ::1"
+	cnf.PasswordMaxLinkAttempts = 3
+	controller := repository.NewStorage(&cnf)
+	passwordHash, err := repository.HashPassword("qwerty")
+	require.NoError(t, err)
+	hash, err := controller.InsertLink(context.Background(), "http://test.test/guarded", "sadASdQeAWDwdAs",
+		repository.LinkOptions{PasswordHash: passwordHash})
+	require.NoError(t, err)
+	ts := httptest.NewServer(newRouter(t, controller, &cnf))
+	defer ts.Close()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	get := func(ip, password string) int {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/"+hash, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", ip)
+		req.Header.Set(PasswordHeader, password)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// Каждая попытка приходит с нового адреса, но общее ограничение попыток для URL все равно срабатывает.
+	for i := 1; i <= cnf.PasswordMaxLinkAttempts; i++ {
+		assert.Equal(t, http.StatusForbidden, get("10.0.0."+strconv.Itoa(i), "wrong"))
+	}
+	// После ограничения проверки замедляются, но верный пароль по-прежнему открывает URL.
+	start := time.Now()
+	assert.Equal(t, http.StatusForbidden, get("10.0.1.1", "wrong"))
+	assert.GreaterOrEqual(t, time.Since(start), passwordDelayStep)
+	assert.Equal(t, http.StatusTemporaryRedirect, get("10.0.1.2", "qwerty"))
+}
+
+func TestServerHandler_FullURLHashByMaxClicks(t *testing.T) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	hash, err := controller.InsertLink(context.Background(), "http://test.test/invite", "sadASdQeAWDwdAs",
+		repository.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodHead, ts.URL+"/"+hash, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	resp, err = client.Get(ts.URL + "/" + hash)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "private, no-store", resp.Header.Get("Cache-Control"))
+	resp, err = client.Get(ts.URL + "/" + hash)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func TestServerHandler_FullURLHashBySchedule(t *testing.T) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name     string
+		fullURL  string
+		opts     repository.LinkOptions
+		status   int
+		location string
+		problem  string
+	}{
+		{
+			name:     "Not active with fallback",
+			fullURL:  "http://test.test/campaign",
+			opts:     repository.LinkOptions{NotBefore: &future, FallbackURL: "http://test.test/soon"},
+			status:   http.StatusFound,
+			location: "http://test.test/soon",
+		},
+		{
+			name:    "Not active without fallback",
+			fullURL: "http://test.test/campaign2",
+			opts:    repository.LinkOptions{NotBefore: &future},
+			status:  http.StatusForbidden,
+			problem: ProblemNotActive,
+		},
+		{
+			name:     "Active",
+			fullURL:  "http://test.test/campaign3",
+			opts:     repository.LinkOptions{NotBefore: &past, NotAfter: &future},
+			status:   http.StatusTemporaryRedirect,
+			location: "http://test.test/campaign3",
+		},
+		{
+			name:    "Expired",
+			fullURL: "http://test.test/campaign4",
+			opts:    repository.LinkOptions{NotAfter: &past},
+			status:  http.StatusGone,
+			problem: ProblemExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnf := config.NewConfig()
+			controller := repository.NewStorage(cnf)
+			r := newRouter(t, controller, cnf)
+			hash, err := controller.InsertLink(context.Background(), tt.fullURL, "sadASdQeAWDwdAs", tt.opts)
+			require.NoError(t, err)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+			resp, err := client.Get(ts.URL + "/" + hash)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+			if tt.problem != "" {
+				var problem Problem
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+				assert.Equal(t, tt.problem, problem.Type)
+			}
+		})
+	}
+}
+
+func TestServerHandler_FullURLHashByRules(t *testing.T) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	hash, err := controller.InsertLink(context.Background(), "http://test.test/app", "sadASdQeAWDwdAs",
+		repository.LinkOptions{Rules: []repository.RedirectRule{
+			{Device: repository.DeviceIOS, URL: "https://apps.apple.com/app"},
+			{Device: repository.DeviceAndroid, URL: "https://play.google.com/app"},
+			{Language: "ru", URL: "http://test.test/ru/app"},
+		}})
+	require.NoError(t, err)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	tests := []struct {
+		name      string
+		userAgent string
+		language  string
+		location  string
+	}{
+		{
+			name:      "iOS",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X) Mobile/15E148",
+			location:  "https://apps.apple.com/app",
+		},
+		{
+			name:      "Android",
+			userAgent: "Mozilla/5.0 (Linux; Android 13; Pixel 7) Mobile Safari/537.36",
+			location:  "https://play.google.com/app",
+		},
+		{
+			name:      "Language",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			language:  "ru-RU,ru;q=0.9,en;q=0.8",
+			location:  "http://test.test/ru/app",
+		},
+		{
+			name:      "Fallback",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			language:  "en-US,ru;q=0.5",
+			location:  "http://test.test/app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/"+hash, nil)
+			require.NoError(t, err)
+			req.Header.Set("User-Agent", tt.userAgent)
+			req.Header.Set("Accept-Language", tt.language)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+		})
+	}
+}
+
+func TestServerHandler_FullURLHashByQuery(t *testing.T) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	utm := &repository.UTM{Source: "newsletter", Medium: "email", Campaign: "spring"}
+	plain, err := controller.InsertLink(context.Background(), "http://test.test/plain?ref=site", "sadASdQeAWDwdAs",
+		repository.LinkOptions{})
+	require.NoError(t, err)
+	keep, err := controller.InsertLink(context.Background(), "http://test.test/keep?ref=site", "sadASdQeAWDwdAs",
+		repository.LinkOptions{Passthrough: true, UTM: utm})
+	require.NoError(t, err)
+	override, err := controller.InsertLink(context.Background(), "http://test.test/override?ref=site", "sadASdQeAWDwdAs",
+		repository.LinkOptions{Passthrough: true, QueryConflict: repository.QueryConflictOverride})
+	require.NoError(t, err)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	tests := []struct {
+		name     string
+		request  string
+		location string
+	}{
+		{
+			name:     "Without passthrough",
+			request:  "/" + plain + "?ref=newsletter",
+			location: "http://test.test/plain?ref=site",
+		},
+		{
+			name:     "Passthrough keep with UTM",
+			request:  "/" + keep + "?ref=newsletter&lang=ru",
+			location: "http://test.test/keep?lang=ru&ref=site&utm_campaign=spring&utm_medium=email&utm_source=newsletter",
+		},
+		{
+			name:     "Passthrough override",
+			request:  "/" + override + "?ref=newsletter",
+			location: "http://test.test/override?ref=newsletter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(ts.URL + tt.request)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+		})
+	}
+}
+
+func TestServerHandler_FullURLHashByWildcard(t *testing.T) {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	docs, err := controller.InsertLink(context.Background(), "https://test.test/docs/", "sadASdQeAWDwdAs",
+		repository.LinkOptions{Wildcard: true})
+	require.NoError(t, err)
+	plain, err := controller.InsertURL(context.Background(), "http://test.test/plain", "sadASdQeAWDwdAs")
+	require.NoError(t, err)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	tests := []struct {
+		name     string
+		request  string
+		status   int
+		location string
+	}{
+		{
+			name:     "Suffix",
+			request:  "/" + docs + "/getting-started",
+			status:   http.StatusTemporaryRedirect,
+			location: "https://test.test/docs/getting-started",
+		},
+		{
+			name:     "Encoded suffix",
+			request:  "/" + docs + "/guide//first%20steps/?lang=ru",
+			status:   http.StatusTemporaryRedirect,
+			location: "https://test.test/docs/guide/first%20steps/",
+		},
+		{
+			name:     "Without suffix",
+			request:  "/" + docs + "/",
+			status:   http.StatusTemporaryRedirect,
+			location: "https://test.test/docs/",
+		},
+		{
+			name:    "Negative path traversal",
+			request: "/" + docs + "/%2e%2e/admin",
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "Negative encoded separator",
+			request: "/" + docs + "/..%2Fadmin",
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:    "Negative without wildcard",
+			request: "/" + plain + "/getting-started",
+			status:  http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(ts.URL + tt.request)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+		})
+	}
+}
+
+func TestServerHandler_RateLimit(t *testing.T) {
+	cnf := config.NewConfig()
+	defer func(rate float64, burst int) {
+		cnf.RateLimitCreate, cnf.RateLimitCreateBurst = rate, burst
+	}(cnf.RateLimitCreate, cnf.RateLimitCreateBurst)
+	cnf.RateLimitCreate, cnf.RateLimitCreateBurst = 0.01, 2
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	post := func(i int) *http.Response {
+		resp, err := http.Post(ts.URL+"/", "text/plain", strings.NewReader("http://test.test/limit"+strconv.Itoa(i)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusCreated, post(i).StatusCode)
+	}
+	resp := post(2)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "100", resp.Header.Get("Retry-After"))
+	// Бюджет переходов не зависит от бюджета создания URL.
+	hash, err := controller.InsertURL(context.Background(), "http://test.test/limit", "sadASdQeAWDwdAs")
+	require.NoError(t, err)
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	resp, err = client.Get(ts.URL + "/" + hash)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+}
+
+func TestServerHandler_RateLimitKey(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.RateLimitCreate, cnf.RateLimitCreateBurst = 0.01, 1
+	cnf.APIKeys = "key"
+	n := 0
+	post := func(ts *httptest.Server, header, value string) int {
+		n++
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/", strings.NewReader("http://test.test/key"+strconv.Itoa(n)))
+		require.NoError(t, err)
+		req.Header.Set(header, value)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	t.Run("Forwarded address from untrusted client", func(t *testing.T) {
+		ts := httptest.NewServer(newRouter(t, repository.NewStorage(&cnf), &cnf))
+		defer ts.Close()
+		assert.Equal(t, http.StatusCreated, post(ts, "X-Forwarded-For", "10.0.0.1"))
+		assert.Equal(t, http.StatusTooManyRequests, post(ts, "X-Forwarded-For", "10.0.0.2"))
+		assert.Equal(t, http.StatusTooManyRequests, post(ts, "X-Real-IP", "10.0.0.3"))
+	})
+	t.Run("Forwarded address from trusted proxy", func(t *testing.T) {
+		trusted := cnf
+		trusted.TrustedProxies = "127.0.0.0/8, ::1"
+		ts := httptest.NewServer(newRouter(t, repository.NewStorage(&trusted), &trusted))
+		defer ts.Close()
+		assert.Equal(t, http.StatusCreated, post(ts, "X-Forwarded-For", "10.0.0.1"))
+		assert.Equal(t, http.StatusCreated, post(ts, "X-Forwarded-For", "10.0.0.2, 127.0.0.1"))
+		assert.Equal(t, http.StatusTooManyRequests, post(ts, "X-Forwarded-For", "10.0.0.2"))
+	})
+	t.Run("API keys", func(t *testing.T) {
+		keyed := cnf
+		keyed.RateLimitKey = ratelimit.KeyAPIKey
+		ts := httptest.NewServer(newRouter(t, repository.NewStorage(&keyed), &keyed))
+		defer ts.Close()
+		// Неизвестные API ключи учитываются по IP адресу и не дают нового бюджета.
+		assert.Equal(t, http.StatusCreated, post(ts, ratelimit.APIKeyHeader, "unknown1"))
+		assert.Equal(t, http.StatusTooManyRequests, post(ts, ratelimit.APIKeyHeader, "unknown2"))
+		assert.Equal(t, http.StatusCreated, post(ts, ratelimit.APIKeyHeader, "key"))
+		assert.Equal(t, http.StatusTooManyRequests, post(ts, ratelimit.APIKeyHeader, "key"))
+	})
+}
+
+func TestServerHandler_ScanGuard(t *testing.T) {
+	cnf := config.NewConfig()
+	defer func(max, after int, step time.Duration) {
+		cnf.ScanMaxNotFound, cnf.ScanSlowdownAfter, cnf.ScanSlowdownStep = max, after, step
+	}(cnf.ScanMaxNotFound, cnf.ScanSlowdownAfter, cnf.ScanSlowdownStep)
+	cnf.ScanMaxNotFound, cnf.ScanSlowdownAfter, cnf.ScanSlowdownStep = 3, 1, 50*time.Millisecond
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	hash, err := controller.InsertURL(context.Background(), "http://test.test/scan", "sadASdQeAWDwdAs")
+	require.NoError(t, err)
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	n := 0
+	get := func(path string) (*http.Response, time.Duration) {
+		// Клиент меняет адрес в заголовке X-Forwarded-For при каждом запросе, но учитывается адрес соединения.
+		n++
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", "10.0.0."+strconv.Itoa(n))
+		start := time.Now()
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp, time.Since(start)
+	}
+	resp, _ := get("/000001")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get("/000002")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	// После превышения порога ответы замедляются, в том числе для существующих URL.
+	resp, elapsed := get("/" + hash)
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+	resp, _ = get("/000003")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get("/" + hash)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+}
+
+func TestServerHandler_ShortURLJSONByPrivate(t *testing.T) {
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	b, err := json.Marshal(repository.FullURL{Full: "http://test.test/private", Private: true})
+	require.NoError(t, err)
+	resp, err := http.Post(ts.URL+"/api/shorten", "application/json", bytes.NewBuffer(b))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var short repository.ShortURL
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&short))
+	hash := short.Short[strings.LastIndex(short.Short, "/")+1:]
+	assert.Len(t, hash, 32)
+	link, err := controller.GetLink(context.Background(), hash)
+	require.NoError(t, err)
+	assert.True(t, link.Private)
+}
+
+func TestServerHandler_Quota(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.QuotaAnonymousDaily = 3
+	cnf.APIKeys = "key"
+	controller := repository.NewStorage(&cnf)
+	r := newRouter(t, controller, &cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := csrfClient(t, ts.URL)
+	post := func(body string) *http.Response {
+		resp, err := client.Post(ts.URL+"/", "text/plain", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	assert.Equal(t, http.StatusCreated, post("http://test.test/quota1").StatusCode)
+	// Повторное сокращение того же URL квоту не расходует.
+	assert.Equal(t, http.StatusConflict, post("http://test.test/quota1").StatusCode)
+	b, err := json.Marshal([]repository.FullBatch{
+		{CorID: "1", Full: "http://test.test/quota2"},
+		{CorID: "2", Full: "http://test.test/quota3"},
+		{CorID: "3", Full: "http://test.test/quota4"},
+	})
+	require.NoError(t, err)
+	resp, err := client.Post(ts.URL+"/api/shorten/batch", "application/json", bytes.NewBuffer(b))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	assert.Equal(t, http.StatusCreated, post("http://test.test/quota2").StatusCode)
+	resp, err = client.Get(ts.URL + "/api/user/quota")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var usage quota.Usage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&usage))
+	assert.Equal(t, quota.TierAnonymous, usage.Tier)
+	assert.Equal(t, 2, usage.Daily.Used)
+	assert.Equal(t, 1, usage.Daily.Remaining)
+	// Разрешенный API ключ расходует квоту своего уровня, неизвестный ключ - квоту пользователя.
+	usageOf := func(key string) quota.Usage {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/quota", nil)
+		require.NoError(t, err)
+		req.Header.Set(ratelimit.APIKeyHeader, key)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var usage quota.Usage
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&usage))
+		return usage
+	}
+	usage = usageOf("key")
+	assert.Equal(t, quota.TierAPIKey, usage.Tier)
+	assert.Equal(t, 0, usage.Daily.Used)
+	usage = usageOf("unknown")
+	assert.Equal(t, quota.TierAnonymous, usage.Tier)
+	assert.Equal(t, 2, usage.Daily.Used)
+	// Запросы без cookie расходуют общую квоту IP адреса, а не квоту каждой новой cookie.
+	for i, want := range []int{http.StatusCreated, http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests} {
+		resp, err := http.Post(ts.URL+"/", "text/plain", strings.NewReader(fmt.Sprintf("http://test.test/ip%d", i)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, want, resp.StatusCode)
+	}
+}
+
+func TestServerHandler_Idempotency(t *testing.T) {
+	cnf := config.NewConfig()
+	storage := repository.NewStorage(cnf)
+	r := newRouter(t, storage, cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := csrfClient(t, ts.URL)
+	post := func(path, key, body string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(idempotency.Header, key)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(b)
+	}
+	body := `{"url":"http://test.test/idempotent"}`
+	resp, first := post("/api/shorten", "key1", body)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(idempotency.ReplayedHeader))
+	// Повтор с тем же ключом возвращает первый ответ, а не 409.
+	resp, replayed := post("/api/shorten", "key1", body)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get(idempotency.ReplayedHeader))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, first, replayed)
+	resp, _ = post("/api/shorten", "", body)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	// Ключ с другим телом запроса отклоняется.
+	resp, _ = post("/api/shorten", "key1", `{"url":"http://test.test/another"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp, _ = post("/api/shorten", "bad\tkey", body)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	// Повтор пакета не создает URL заново.
+	batch := `[{"correlation_id":"1","original_url":"http://test.test/idempotent1"}]`
+	resp, first = post("/api/shorten/batch", "key1", batch)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, replayed = post("/api/shorten/batch", "key1", batch)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, first, replayed)
+	// Другой пользователь может использовать тот же ключ.
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/shorten", strings.NewReader(`{"url":"http://test.test/other"}`))
+	require.NoError(t, err)
+	req.Header.Set(idempotency.Header, "key1")
+	resp, err = csrfClient(t, ts.URL).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	// Без cookie пользователя ключ не к кому привязать: каждый повтор получил бы нового пользователя и создал URL
+	// заново, поэтому запрос отклоняется.
+	for i := 0; i < 2; i++ {
+		req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/shorten", strings.NewReader(`{"url":"http://test.test/anonymous"}`))
+		require.NoError(t, err)
+		req.Header.Set(idempotency.Header, "key2")
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+	}
+	_, err = storage.GetShortURL(context.Background(), "http://test.test/anonymous")
+	assert.Error(t, err)
+}
+
+func TestServerHandler_Links(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.ValidateRequests = true
+	r := newRouter(t, repository.NewStorage(&cnf), &cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := csrfClient(t, ts.URL)
+	do := func(method, path, body string, v interface{}) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp
+	}
+	var link repository.Link
+	resp := do(http.MethodPost, "/api/v2/links", `{"destination":"http://test.test/v2","code":"v2-link","tags":["a"]}`, &link)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "/api/v2/links/v2-link", resp.Header.Get("Location"))
+	assert.Equal(t, "v2-link", link.Code)
+	assert.Equal(t, cnf.ExpShortURL("v2-link"), link.ShortURL)
+	assert.Equal(t, "http://test.test/v2", link.Destination)
+	assert.Equal(t, []string{"a"}, link.Tags)
+	require.NotNil(t, link.CreatedAt)
+	assert.Equal(t, link.CreatedAt, link.UpdatedAt)
+	assert.Nil(t, link.ExpiresAt)
+	// Повторное сокращение того же адреса возвращает ресурс уже созданного URL.
+	var generated, again repository.Link
+	resp = do(http.MethodPost, "/api/v2/links", `{"destination":"http://test.test/v2"}`, &generated)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = do(http.MethodPost, "/api/v2/links", `{"destination":"http://test.test/v2"}`, &again)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, generated.Code, again.Code)
+	resp = do(http.MethodPost, "/api/v2/links", `{"url":"http://test.test/v2"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	// Изменяются только переданные поля, null снимает срок действия.
+	var updated repository.Link
+	resp = do(http.MethodPatch, "/api/v2/links/v2-link", `{"destination":"http://test.test/v2/new","expires_at":"2100-01-01T00:00:00Z"}`, &updated)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "http://test.test/v2/new", updated.Destination)
+	assert.Equal(t, []string{"a"}, updated.Tags)
+	require.NotNil(t, updated.ExpiresAt)
+	resp = do(http.MethodPatch, "/api/v2/links/v2-link", `{"expires_at":null}`, &updated)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, updated.ExpiresAt)
+	resp = do(http.MethodPatch, "/api/v2/links/"+generated.Code, `{"destination":"http://test.test/v2/new"}`, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	// Удаленный URL доступен по идентификатору и в списке по запросу.
+	resp = do(http.MethodDelete, "/api/v2/links/"+generated.Code, "", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	var deleted repository.Link
+	resp = do(http.MethodGet, "/api/v2/links/"+generated.Code, "", &deleted)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, deleted.Deleted)
+	var links []repository.Link
+	resp = do(http.MethodGet, "/api/v2/links", "", &links)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, links, 1)
+	assert.Equal(t, "v2-link", links[0].Code)
+	do(http.MethodGet, "/api/v2/links?include_deleted=true", "", &links)
+	assert.Len(t, links, 2)
+	resp = do(http.MethodGet, "/api/v2/links/missing", "", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	// Ресурс доступен только владельцу, v1 продолжает работать с тем же URL.
+	resp, err := http.Get(ts.URL + "/api/v2/links/v2-link")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	var sliced []repository.SlicedURL
+	resp = do(http.MethodGet, "/api/user/urls", "", &sliced)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, sliced, 1)
+}
+
+func TestServerHandler_GetEvents(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.EventsHeartbeat = 10 * time.Millisecond
+	bus := events.NewBus()
+	r := newRouter(t, repository.NewStorage(&cnf, repository.WithEvents(bus)), &cnf, WithEvents(bus))
+	ts := httptest.NewServer(r)
+	// Сервер закрывается после потоков событий, закрываемых в t.Cleanup.
+	t.Cleanup(ts.Close)
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Post(ts.URL+"/", "text/plain", strings.NewReader("http://test.test/events"))
+	require.NoError(t, err)
+	short, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	code := string(short[strings.LastIndex(string(short), "/")+1:])
+	subscribe := func(ctx context.Context, lastID string) *bufio.Reader {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/user/events", nil)
+		require.NoError(t, err)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, EventStreamContentType, resp.Header.Get("Content-Type"))
+		t.Cleanup(func() { resp.Body.Close() })
+		return bufio.NewReader(resp.Body)
+	}
+	// next - читает следующий блок потока: поля события или комментарий.
+	next := func(stream *bufio.Reader) map[string]string {
+		fields := make(map[string]string)
+		for {
+			line, err := stream.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return fields
+			}
+			name, value, _ := strings.Cut(line, ":")
+			fields[name] = strings.TrimSpace(value)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := subscribe(ctx, "")
+	// Пока событий нет, передается комментарий-пульс.
+	assert.Equal(t, map[string]string{"": "heartbeat"}, next(stream))
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = noRedirect.Get(ts.URL + "/" + code)
+	require.NoError(t, err)
+	resp.Body.Close()
+	fields := next(stream)
+	for fields["event"] == "" {
+		fields = next(stream)
+	}
+	assert.Equal(t, events.Clicked, fields["event"])
+	var event events.Event
+	require.NoError(t, json.Unmarshal([]byte(fields["data"]), &event))
+	assert.Equal(t, code, event.Code)
+	cancel()
+	// Переподключившийся клиент получает пропущенные события.
+	stream = subscribe(context.Background(), "1")
+	fields = next(stream)
+	assert.Equal(t, events.Created, fields["event"])
+	assert.NotEmpty(t, fields["id"])
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "last")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServerHandler_Variants(t *testing.T) {
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	b, err := json.Marshal(repository.FullURL{Full: "http://test.test/landing", Variants: []repository.Variant{
+		{ID: "a", URL: "http://test.test/landing-a", Weight: 1},
+		{ID: "b", URL: "http://test.test/landing-b", Weight: 1},
+	}})
+	require.NoError(t, err)
+	resp, err := http.Post(ts.URL+"/api/shorten", "application/json", bytes.NewBuffer(b))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var owner *http.Cookie
+	for _, v := range resp.Cookies() {
+		if v.Name == "shortener" {
+			owner = v
+		}
+	}
+	require.NotNil(t, owner)
+	hash, err := controller.GetShortURL(context.Background(), "http://test.test/landing")
+	require.NoError(t, err)
+	t.Run("Sticky variant", func(t *testing.T) {
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		client := &http.Client{
+			Jar: jar,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+		var first string
+		for i := 0; i < 5; i++ {
+			resp, err := client.Get(ts.URL + "/" + hash)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+			if first == "" {
+				first = resp.Header.Get("Location")
+			}
+			assert.Equal(t, first, resp.Header.Get("Location"))
+		}
+	})
+	t.Run("Variant cookie", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodHead, ts.URL+"/"+hash, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		resp, err := (&http.Transport{}).RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		var cookie *http.Cookie
+		for _, v := range resp.Cookies() {
+			if v.Name == variantCookiePrefix+hash {
+				cookie = v
+			}
+		}
+		require.NotNil(t, cookie)
+		assert.True(t, cookie.HttpOnly)
+		assert.True(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	})
+	t.Run("Stats", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/urls/"+hash+"/stats", nil)
+		require.NoError(t, err)
+		req.AddCookie(owner)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var stats repository.LinkStats
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+		assert.Equal(t, 5, stats.Clicks)
+		require.Len(t, stats.Variants, 2)
+		assert.Equal(t, 5, stats.Variants[0].Clicks+stats.Variants[1].Clicks)
+	})
+	t.Run("Update variants", func(t *testing.T) {
+		body := []byte(`[{"id":"c","url":"http://test.test/landing-c","weight":1}]`)
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/user/urls/"+hash+"/variants", bytes.NewBuffer(body))
+		require.NoError(t, err)
+		req.AddCookie(owner)
+		setCSRFToken(req)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		link, err := controller.GetLink(context.Background(), hash)
+		require.NoError(t, err)
+		assert.Equal(t, []repository.Variant{{ID: "c", URL: "http://test.test/landing-c", Weight: 1}}, link.Variants)
+	})
+	t.Run("Negative not owner", func(t *testing.T) {
+		body := []byte(`[]`)
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/api/user/urls/"+hash+"/variants", bytes.NewBuffer(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
 	})
 }
 
@@ -172,8 +1200,8 @@ func TestServerHandler_ShortURLTextBy(t *testing.T) {
 			method:  http.MethodGet,
 			reqBody: "http://www.test.net/test",
 			want: want{
-				respType:   "text/plain ; charset=utf-8",
-				statusCode: http.StatusBadRequest,
+				respType:   ProblemContentType,
+				statusCode: http.StatusMethodNotAllowed,
 			},
 			wantErr: true,
 		},
@@ -183,7 +1211,7 @@ func TestServerHandler_ShortURLTextBy(t *testing.T) {
 			method:  http.MethodPost,
 			reqBody: "",
 			want: want{
-				respType:   "text/plain ; charset=utf-8",
+				respType:   ProblemContentType,
 				statusCode: http.StatusBadRequest,
 			},
 			wantErr: true,
@@ -193,7 +1221,7 @@ func TestServerHandler_ShortURLTextBy(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cnf := config.NewConfig()
 			controller := repository.NewStorage(cnf)
-			r := NewRouter(controller, cnf)
+			r := newRouter(t, controller, cnf)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			req, err := http.NewRequest(tt.method, ts.URL+tt.request, bytes.NewBuffer([]byte(tt.reqBody)))
@@ -207,6 +1235,7 @@ func TestServerHandler_ShortURLTextBy(t *testing.T) {
 			}
 			if tt.wantErr {
 				assert.Equal(t, tt.want.statusCode, resp.StatusCode)
+				assert.Equal(t, tt.want.respType, resp.Header.Get("Content-Type"))
 			}
 		})
 	}
@@ -239,7 +1268,7 @@ func TestServerHandler_ShortURLJSONBy(t *testing.T) {
 	t.Run("Positive test", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		b, err := json.Marshal(repository.FullURL{
@@ -265,7 +1294,7 @@ func TestServerHandler_ShortURLJSONBy(t *testing.T) {
 	t.Run("Negative test with another method", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		b, err := json.Marshal(repository.FullURL{
@@ -280,12 +1309,12 @@ func TestServerHandler_ShortURLJSONBy(t *testing.T) {
 		resp, err := http.DefaultClient.Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
-		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
 	})
 	t.Run("Negative test with nil body", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		b, err := json.Marshal(repository.FullURL{
@@ -300,7 +1329,7 @@ func TestServerHandler_ShortURLJSONBy(t *testing.T) {
 		resp, err := http.DefaultClient.Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
-		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
 	})
 }
 
@@ -331,7 +1360,7 @@ func TestServerHandler_Ping(t *testing.T) {
 	t.Run("Ping", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		req, err := http.NewRequest(http.MethodGet, ts.URL+"/ping", bytes.NewBuffer([]byte("")))
@@ -341,13 +1370,34 @@ func TestServerHandler_Ping(t *testing.T) {
 		defer resp.Body.Close()
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 	})
+	t.Run("Timeout", func(t *testing.T) {
+		cnf := *config.NewConfig()
+		cnf.PingTimeout = 10 * time.Millisecond
+		r := newRouter(t, slowStorage{repository.NewStorage(&cnf)}, &cnf)
+		ts := httptest.NewServer(r)
+		defer ts.Close()
+		resp, err := http.Get(ts.URL + "/ping")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+}
+
+// slowStorage - хранилище, проверка доступности которого завершается только по отмене контекста.
+type slowStorage struct {
+	repository.Storager
+}
+
+func (s slowStorage) Ping(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
 }
 
 func TestServerHandler_GetAllUserURLs(t *testing.T) {
 	t.Run("Positive test", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		req, err := http.NewRequest(http.MethodPost, ts.URL+"/", bytes.NewBuffer([]byte("http://www.test.test/test")))
@@ -403,7 +1453,7 @@ func TestServerHandler_GetStats(t *testing.T) {
 	t.Run("Positive stats", func(t *testing.T) {
 		cnf := config.NewConfig()
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/internal/stats", nil)
@@ -427,7 +1477,7 @@ func TestServerHandler_GetStats(t *testing.T) {
 		cnf := config.NewConfig()
 		cnf.TrustedSubnet = "true"
 		controller := repository.NewStorage(cnf)
-		r := NewRouter(controller, cnf)
+		r := newRouter(t, controller, cnf)
 		ts := httptest.NewServer(r)
 		defer ts.Close()
 		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/internal/stats", nil)
@@ -451,3 +1501,571 @@ func TestGetIP(t *testing.T) {
 		assert.Equal(t, "ip is not real", err.Error())
 	})
 }
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		kind   string
+		detail string
+	}{
+		{name: "Not found", err: repository.ErrNotFoundURL, status: http.StatusNotFound, kind: "not_found",
+			detail: repository.ErrNotFoundURL.Error()},
+		{name: "Gone", err: repository.ErrDeletedURL, status: http.StatusGone, kind: "gone",
+			detail: repository.ErrDeletedURL.Error()},
+		{name: "Conflict", err: repository.ErrConflictInsert, status: http.StatusConflict, kind: "conflict",
+			detail: repository.ErrConflictInsert.Error()},
+		{name: "Invalid", err: repository.ErrInvalidVariant, status: http.StatusBadRequest, kind: "invalid",
+			detail: repository.ErrInvalidVariant.Error()},
+		{name: "Forbidden", err: repository.ErrNotOwnerURL, status: http.StatusForbidden, kind: "forbidden",
+			detail: repository.ErrNotOwnerURL.Error()},
+		{name: "Unavailable", err: context.DeadlineExceeded, status: http.StatusServiceUnavailable, kind: "unavailable",
+			detail: context.DeadlineExceeded.Error()},
+		{name: "Internal without detail", err: fmt.Errorf("pq: secret"), status: http.StatusInternalServerError,
+			kind: "internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest(http.MethodGet, "/abc", nil), tt.err)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+			var problem Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, Problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(tt.status),
+				Status:   tt.status,
+				Detail:   tt.detail,
+				Instance: "/abc",
+				Kind:     tt.kind,
+			}, problem)
+		})
+	}
+	t.Run("Missing cookie", func(t *testing.T) {
+		cnf := config.NewConfig()
+		h := newServerHandler(repository.NewStorage(cnf), cnf)
+		w := httptest.NewRecorder()
+		h.GetAllUserURLs(w, httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	})
+}
+
+func TestOpenAPI_Routes(t *testing.T) {
+	cnf := config.NewConfig()
+	r := newRouter(t, repository.NewStorage(cnf), cnf)
+	routes := make([]string, 0)
+	err := chi.Walk(r, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+openapi.PathFromRoute(route))
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(routes)
+	doc, err := openapi.Load()
+	require.NoError(t, err)
+	// Каждый маршрут роутера описан в спецификации, и каждая операция спецификации зарегистрирована в роутере.
+	assert.Equal(t, doc.Operations(), routes)
+}
+
+func TestServerHandler_ValidateRequest(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.ValidateRequests = true
+	r := newRouter(t, repository.NewStorage(&cnf), &cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	t.Run("Spec", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/api/openapi.json")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, openapi.Spec(), body)
+	})
+	t.Run("Valid", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/api/shorten", "application/json",
+			strings.NewReader(`{"url":"http://test.test/validated","max_clicks":3}`))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+	t.Run("Invalid body", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/api/shorten", "application/json", strings.NewReader(`{"url":"http://test.test","max_clicks":"3"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		var problem Problem
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+		assert.Equal(t, "body.max_clicks: expected integer", problem.Detail)
+	})
+	t.Run("Unsupported media type", func(t *testing.T) {
+		resp, err := http.Post(ts.URL+"/api/shorten/batch", "text/csv", strings.NewReader("url"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+}
+
+func TestServerHandler_PostStream(t *testing.T) {
+	cnf := config.NewConfig()
+	controller := repository.NewStorage(cnf)
+	r := newRouter(t, controller, cnf)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	hash, err := controller.InsertURL(context.Background(), "http://test.test/stream-existing", "sadASdQeAWDwdAs")
+	require.NoError(t, err)
+	t.Run("Results", func(t *testing.T) {
+		body := strings.Join([]string{
+			`{"correlation_id":"1","original_url":"http://test.test/stream1"}`,
+			``,
+			`{"correlation_id":"2","original_url":"http://test.test/stream-existing"}`,
+			`not json`,
+			`{"correlation_id":"4","original_url":""}`,
+		}, "\n")
+		resp, err := http.Post(ts.URL+"/api/shorten/stream", NDJSONContentType, strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, NDJSONContentType, resp.Header.Get("Content-Type"))
+		decoder := json.NewDecoder(resp.Body)
+		results := make([]streamResult, 0)
+		for decoder.More() {
+			var result streamResult
+			require.NoError(t, decoder.Decode(&result))
+			results = append(results, result)
+		}
+		require.Len(t, results, 4)
+		short, err := controller.GetShortURL(context.Background(), "http://test.test/stream1")
+		require.NoError(t, err)
+		assert.Equal(t, streamResult{ShortBatch: repository.ShortBatch{CorID: "1", Short: cnf.ExpShortURL(short)}, Line: 1}, results[0])
+		assert.Equal(t, streamResult{ShortBatch: repository.ShortBatch{CorID: "2", Short: cnf.ExpShortURL(hash)}, Line: 3}, results[1])
+		assert.Equal(t, 4, results[2].Line)
+		assert.NotEmpty(t, results[2].Error)
+		assert.Equal(t, streamResult{ShortBatch: repository.ShortBatch{CorID: "4"}, Line: 5,
+			Error: repository.ErrEmptyInsert.Error()}, results[3])
+	})
+	t.Run("Streams while reading", func(t *testing.T) {
+		in, writer := io.Pipe()
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/shorten/stream", in)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", NDJSONContentType)
+		go writer.Write([]byte(`{"correlation_id":"a","original_url":"http://test.test/duplex"}` + "\n"))
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		// Результат первой строки приходит до окончания запроса.
+		var result streamResult
+		decoder := json.NewDecoder(resp.Body)
+		require.NoError(t, decoder.Decode(&result))
+		assert.Equal(t, "a", result.CorID)
+		assert.NotEmpty(t, result.Short)
+		go func() {
+			writer.Write([]byte(`{"correlation_id":"b","original_url":"http://test.test/duplex2"}`))
+			writer.Close()
+		}()
+		require.NoError(t, decoder.Decode(&result))
+		assert.Equal(t, "b", result.CorID)
+		assert.False(t, decoder.More())
+	})
+}
+
+func TestServerHandler_CSV(t *testing.T) {
+	cnf := *config.NewConfig()
+	controller := repository.NewStorage(&cnf)
+	ts := httptest.NewServer(newRouter(t, controller, &cnf))
+	defer ts.Close()
+	client := csrfClient(t, ts.URL)
+	hash, err := controller.InsertURL(context.Background(), "http://test.test/csv-existing", "sadASdQeAWDwdAs")
+	require.NoError(t, err)
+	t.Run("Import", func(t *testing.T) {
+		body := strings.Join([]string{
+			`tags,URL,alias`,
+			`"news, go",http://test.test/csv1,csv-alias`,
+			`,http://test.test/csv-existing,`,
+			`,,`,
+			`a,"broken`,
+		}, "\n")
+		resp, err := client.Post(ts.URL+"/api/user/urls/import.csv", CSVContentType, strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, NDJSONContentType, resp.Header.Get("Content-Type"))
+		decoder := json.NewDecoder(resp.Body)
+		results := make([]importResult, 0)
+		for decoder.More() {
+			var result importResult
+			require.NoError(t, decoder.Decode(&result))
+			results = append(results, result)
+		}
+		require.Len(t, results, 4)
+		assert.Equal(t, importResult{Line: 2, URL: "http://test.test/csv1", Short: cnf.ExpShortURL("csv-alias")}, results[0])
+		assert.Equal(t, importResult{Line: 3, URL: "http://test.test/csv-existing", Short: cnf.ExpShortURL(hash)}, results[1])
+		assert.Equal(t, importResult{Line: 4, Error: "url is required"}, results[2])
+		assert.Equal(t, 5, results[3].Line)
+		assert.NotEmpty(t, results[3].Error)
+		link, err := controller.GetLink(context.Background(), "csv-alias")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"news", "go"}, link.Tags)
+	})
+	t.Run("Import without header", func(t *testing.T) {
+		body := "http://test.test/csv2\nhttp://test.test/csv3,csv-alias\n"
+		resp, err := client.Post(ts.URL+"/api/user/urls/import.csv", CSVContentType, strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(resp.Body)
+		var result importResult
+		require.NoError(t, decoder.Decode(&result))
+		assert.Equal(t, 1, result.Line)
+		assert.NotEmpty(t, result.Short)
+		var taken importResult
+		require.NoError(t, decoder.Decode(&taken))
+		assert.Equal(t, importResult{Line: 2, URL: "http://test.test/csv3", Error: repository.ErrAliasExists.Error()}, taken)
+	})
+	var exported []byte
+	t.Run("Export", func(t *testing.T) {
+		resp, err := client.Post(ts.URL+"/api/user/urls/import.csv", CSVContentType,
+			strings.NewReader("url,tags\nhttp://test.test/csv-formula,=1+1\n"))
+		require.NoError(t, err)
+		var formula importResult
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&formula))
+		resp.Body.Close()
+		require.Empty(t, formula.Error)
+		resp, err = client.Get(ts.URL + "/api/user/urls/export.csv")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+		exported, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		records, err := csv.NewReader(bytes.NewReader(exported)).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Equal(t, []string{"url", "alias", "tags", "short_url"}, records[0])
+		assert.Contains(t, records[1:], []string{"http://test.test/csv1", "csv-alias", "news,go", cnf.ExpShortURL("csv-alias")})
+		// Для URL со сгенерированным идентификатором колонка alias пустая, формулы экранируются.
+		assert.Contains(t, records[1:], []string{"http://test.test/csv-formula", "", "'=1+1", formula.Short})
+	})
+	t.Run("Import exported", func(t *testing.T) {
+		resp, err := client.Post(ts.URL+"/api/user/urls/import.csv", CSVContentType, bytes.NewReader(exported))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(resp.Body)
+		for decoder.More() {
+			var result importResult
+			require.NoError(t, decoder.Decode(&result))
+			assert.Empty(t, result.Error, result.URL)
+			assert.NotEmpty(t, result.Short, result.URL)
+		}
+		link, err := controller.GetLink(context.Background(), "csv-alias")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"news", "go"}, link.Tags)
+	})
+	t.Run("Export empty", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/api/user/urls/export.csv")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "url,alias,tags,short_url\n", string(data))
+	})
+}
+
+func TestServerHandler_PostImport(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.TrustedSubnet = ""
+	controller := repository.NewStorage(&cnf)
+	post := func(t *testing.T, cnf *config.Config, query string, body string) *http.Response {
+		ts := httptest.NewServer(newRouter(t, controller, cnf))
+		t.Cleanup(ts.Close)
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/internal/import?"+query, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-Real-IP", "127.0.0.1")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	t.Run("No trusted subnet", func(t *testing.T) {
+		resp := post(t, &cnf, "format=bitly", "")
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+	trusted := cnf
+	trusted.TrustedSubnet = "127.0.0.0/8"
+	t.Run("Unknown format", func(t *testing.T) {
+		resp := post(t, &trusted, "format=unknown&user=importer", "")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("Import", func(t *testing.T) {
+		body := `[{"keyword":"yrls","url":"http://test.test/yourls","timestamp":"2020-01-02 03:04:05","clicks":"3"},
+			{"keyword":"yrls","url":"http://test.test/yourls2"}]`
+		resp := post(t, &trusted, "format=yourls-json&user=importer", body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		decoder := json.NewDecoder(resp.Body)
+		var first, second importer.Result
+		var summary importer.Summary
+		require.NoError(t, decoder.Decode(&first))
+		require.NoError(t, decoder.Decode(&second))
+		require.NoError(t, decoder.Decode(&summary))
+		assert.Equal(t, importer.Result{Record: 1, Code: "yrls", URL: "http://test.test/yourls", Short: cnf.ExpShortURL("yrls")}, first)
+		assert.Equal(t, repository.ErrAliasExists.Error(), second.Error)
+		assert.Equal(t, importer.Summary{Imported: 1, Failed: 1}, summary)
+		link, err := controller.GetLink(context.Background(), "yrls")
+		require.NoError(t, err)
+		assert.Equal(t, "importer", link.UserID)
+		assert.Equal(t, 3, link.Clicks)
+	})
+}
+
+func TestReadLine(t *testing.T) {
+	in := bufio.NewReaderSize(strings.NewReader("a\r\n"+strings.Repeat("b", maxStreamLine+10)+"\nc"), 16)
+	line, err := readLine(in)
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(line))
+	_, err = readLine(in)
+	assert.EqualError(t, err, "line is longer than 65536 bytes")
+}
+
+func TestServerHandler_Web(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.ValidateRequests = true
+	ts := httptest.NewServer(newRouter(t, repository.NewStorage(&cnf), &cnf))
+	defer ts.Close()
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	csrfPattern := regexp.MustCompile(`name="csrf_token" value="([0-9a-f]+)"`)
+	// page - запрашивает страницу веб-интерфейса и возвращает ее текст.
+	page := func(path string, status int) string {
+		resp, err := client.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	body := page("/ui", http.StatusOK)
+	assert.Contains(t, body, "Ссылок пока нет.")
+	match := csrfPattern.FindStringSubmatch(body)
+	require.Len(t, match, 2)
+	token := match[1]
+	post := func(path string, form url.Values) *http.Response {
+		resp, err := client.PostForm(ts.URL+path, form)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	t.Run("Create", func(t *testing.T) {
+		resp := post("/ui/links", url.Values{"csrf_token": {token}, "url": {"http://test.test/web?a=<b>"}})
+		require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		location, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, "/ui", location.Path)
+		code := location.Query().Get("created")
+		body := page(location.String(), http.StatusOK)
+		assert.Contains(t, body, cnf.ExpShortURL(code))
+		// Адрес экранируется в разметке страницы.
+		assert.Contains(t, body, "http://test.test/web?a=&lt;b&gt;")
+		assert.NotContains(t, body, "<b>")
+		resp = post("/ui/links", url.Values{"csrf_token": {token}, "url": {"http://test.test/alias"}, "code": {"web-alias"}})
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		resp = post("/ui/links", url.Values{"csrf_token": {token}, "url": {"http://test.test/taken"}, "code": {"web-alias"}})
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+	t.Run("Search", func(t *testing.T) {
+		body := page("/ui?q=ALIAS", http.StatusOK)
+		assert.Contains(t, body, "/ui/links/web-alias")
+		assert.NotContains(t, body, "http://test.test/web?")
+		assert.Contains(t, page("/ui?q=missing", http.StatusOK), "Ничего не найдено.")
+	})
+	t.Run("Stats", func(t *testing.T) {
+		resp, err := client.Get(ts.URL + "/web-alias")
+		require.NoError(t, err)
+		resp.Body.Close()
+		body := page("/ui/links/web-alias", http.StatusOK)
+		assert.Contains(t, body, "http://test.test/alias")
+		assert.Contains(t, body, "<tr><th>Переходы</th><td>1</td></tr>")
+		page("/ui/links/missing", http.StatusNotFound)
+	})
+	t.Run("CSRF", func(t *testing.T) {
+		resp := post("/ui/links/web-alias/delete", url.Values{"csrf_token": {strings.Repeat("0", 32)}})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		// Без cookie с токеном форма отклоняется, даже если токен в форме верный.
+		resp, err := http.PostForm(ts.URL+"/ui/links", url.Values{"csrf_token": {token}, "url": {"http://test.test/csrf"}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+	t.Run("Delete", func(t *testing.T) {
+		resp := post("/ui/links/web-alias/delete", url.Values{"csrf_token": {token}})
+		require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "/ui", resp.Header.Get("Location"))
+		assert.NotContains(t, page("/ui", http.StatusOK), "web-alias")
+		// Повторное удаление не является ошибкой.
+		resp = post("/ui/links/web-alias/delete", url.Values{"csrf_token": {token}})
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	})
+}
+
+func TestServerHandler_CSRF(t *testing.T) {
+	cnf := *config.NewConfig()
+	cnf.APIKeys = "key"
+	ts := httptest.NewServer(newRouter(t, repository.NewStorage(&cnf), &cnf))
+	defer ts.Close()
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(ts.URL + "/api/user/quota")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Len(t, resp.Cookies(), 1)
+	cookie := resp.Cookies()[0]
+	assert.Equal(t, "shortener", cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.False(t, cookie.Secure)
+	// За прокси, завершающим TLS, cookie передается только по HTTPS.
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/csrf", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Len(t, resp.Cookies(), 2)
+	for _, cookie := range resp.Cookies() {
+		assert.True(t, cookie.Secure, cookie.Name)
+		assert.True(t, cookie.HttpOnly, cookie.Name)
+	}
+	del := func(header, value string) int {
+		req, err := http.NewRequest(http.MethodDelete, ts.URL+"/api/user/urls", strings.NewReader(`[]`))
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusForbidden, del("", ""))
+	assert.Equal(t, http.StatusForbidden, del(CSRFHeader, strings.Repeat("0a", csrfTokenSize)))
+	// Клиенты API с заголовком Authorization или разрешенным API ключом не проверяются, но токен в заголовке
+	// должен быть верным.
+	resp, err = client.Get(ts.URL + "/api/user/token")
+	require.NoError(t, err)
+	var user struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&user))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, del("Authorization", "Bearer "+user.Token))
+	assert.Equal(t, http.StatusUnauthorized, del("Authorization", "Bearer token"))
+	assert.Equal(t, http.StatusAccepted, del(ratelimit.APIKeyHeader, "key"))
+	assert.Equal(t, http.StatusForbidden, del(ratelimit.APIKeyHeader, "unknown"))
+	resp, err = client.Get(ts.URL + "/api/user/csrf")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body struct {
+		Token string `json:"csrf_token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, http.StatusAccepted, del(CSRFHeader, body.Token))
+	// Запрос без cookie пользователя не выполняется от его имени и не проверяется.
+	resp, err = http.Post(ts.URL+"/", "text/plain", strings.NewReader("http://test.test/csrf"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestServerHandler_GetToken(t *testing.T) {
+	cnf := config.NewConfig()
+	keys, err := auth.NewKeyring([]string{"test-secret-key-0123"}, time.Hour)
+	require.NoError(t, err)
+	ts := httptest.NewServer(newRouter(t, repository.NewStorage(cnf), cnf, WithKeyring(keys)))
+	defer ts.Close()
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Post(ts.URL+"/", "text/plain", strings.NewReader("http://test.test/token"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, err = client.Get(ts.URL + "/api/user/token")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	// Токен выпущен той же связкой ключей, что проверяет токены gRPC сервера.
+	claims, err := keys.Verify(body.Token)
+	require.NoError(t, err)
+	assert.True(t, claims.ExpiresAt.Equal(body.ExpiresAt))
+	list := func(authorization string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/user/urls", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", authorization)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	// Клиент без cookie с токеном в заголовке видит URL того же пользователя и не получает cookie.
+	resp = list("Bearer " + body.Token)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Cookies())
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "http://test.test/token")
+	resp = list("Bearer " + body.Token + "x")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, ProblemContentType, resp.Header.Get("Content-Type"))
+}
+
+// csrfTransport - транспорт HTTP клиента, передающий токен защиты от CSRF в заголовке запросов.
+type csrfTransport struct {
+	token string
+}
+
+// RoundTrip - реализует http.RoundTripper.
+func (c csrfTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(CSRFHeader, c.token)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// csrfClient - возвращает клиента с cookie пользователя и токеном защиты от CSRF, полученным от сервера serverURL.
+func csrfClient(t *testing.T, serverURL string) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	resp, err := client.Get(serverURL + "/api/user/csrf")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body struct {
+		Token string `json:"csrf_token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.NotEmpty(t, body.Token)
+	client.Transport = csrfTransport{token: body.Token}
+	return client
+}
+
+// setCSRFToken - добавляет в запрос одинаковый токен защиты от CSRF в cookie и заголовке.
+func setCSRFToken(r *http.Request) {
+	token := strings.Repeat("0a", csrfTokenSize)
+	r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: token})
+	r.Header.Set(CSRFHeader, token)
+}
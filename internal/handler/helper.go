@@ -1,16 +1,34 @@
 package handler
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
 )
 
+// connAddrKey - ключ контекста запроса с адресом соединения до его замены адресом клиента из заголовков прокси.
+type connAddrKey struct{}
+
+// keepConnAddr - middleware, сохраняющий адрес соединения до его замены адресом клиента из заголовков прокси,
+// чтобы GetIP мог сравнить его с заголовками запроса.
+func keepConnAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), connAddrKey{}, r.RemoteAddr)))
+	})
+}
+
 // GetIP - возвращает IP пользователя.
 func GetIP(r *http.Request) (net.IP, error) {
 	// получаем значения удаленного адреса пользователя из запроса
 	remoteAddr := r.RemoteAddr
+	if addr, ok := r.Context().Value(connAddrKey{}).(string); ok {
+		remoteAddr = addr
+	}
 	ip, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
 		return nil, err
@@ -34,3 +52,104 @@ func GetIP(r *http.Request) (net.IP, error) {
 	}
 	return nil, errors.New("ip is not real")
 }
+
+// parseProxies - разбирает адреса и подсети доверенных прокси через запятую.
+func parseProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, proxy := range strings.Split(s, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// trustedProxy - сообщает, входит ли ip в адреса доверенных прокси.
+func trustedProxy(ip net.IP, proxies []*net.IPNet) bool {
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP - middleware, заменяющая RemoteAddr запроса адресом клиента из заголовков X-Real-IP и X-Forwarded-For,
+// только если соединение установлено доверенным прокси. Заголовки остальных клиентов не учитываются: иначе клиент
+// мог бы подставить любой адрес и обойти ограничения, которые учитываются по IP.
+func (h ServerHandler) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err == nil && ip != nil && trustedProxy(ip, h.proxies) {
+			if forwarded := forwardedIP(r, h.proxies); forwarded != "" {
+				r.RemoteAddr = forwarded
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedIP - возвращает адрес клиента из заголовков доверенного прокси: X-Real-IP или ближайший к серверу
+// адрес X-Forwarded-For, который не принадлежит доверенным прокси.
+func forwardedIP(r *http.Request, proxies []*net.IPNet) string {
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if i == 0 || !trustedProxy(ip, proxies) {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// clientIP - возвращает IP пользователя из RemoteAddr запроса, который уже учитывает заголовки доверенных прокси.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// linkCacheControl - возвращает значение заголовка Cache-Control для перенаправления по URL.
+// Перенаправления, результат которых зависит от проверок при каждом переходе, не кэшируются.
+func linkCacheControl(link repository.URL, code int) string {
+	if !link.Cacheable() {
+		return "private, no-store"
+	}
+	return redirectCacheControl(code)
+}
+
+// redirectCacheControl - возвращает значение заголовка Cache-Control для кода перенаправления.
+// Постоянные перенаправления разрешено кэшировать, временные - нет.
+func redirectCacheControl(code int) string {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		return "public, max-age=86400"
+	}
+	return "private, no-cache"
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/idempotency"
+)
+
+// storedResponse - сохраненный ответ на запрос с ключом идемпотентности.
+type storedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// write - повторяет сохраненный ответ с заголовком Idempotent-Replayed.
+func (s storedResponse) write(w http.ResponseWriter) {
+	for name, values := range s.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set(idempotency.ReplayedHeader, "true")
+	w.WriteHeader(s.status)
+	w.Write(s.body)
+}
+
+// recordingWriter - http.ResponseWriter, передающий ответ клиенту и запоминающий его для повтора.
+// Заголовки, выставленные до обработчика (например, Set-Cookie), в сохраненный ответ не попадают.
+type recordingWriter struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// newRecordingWriter - конструктор recordingWriter.
+func newRecordingWriter(w http.ResponseWriter) *recordingWriter {
+	return &recordingWriter{ResponseWriter: w, header: make(http.Header)}
+}
+
+// Header - возвращает заголовки ответа обработчика.
+func (rw *recordingWriter) Header() http.Header {
+	return rw.header
+}
+
+// WriteHeader - запоминает код ответа и передает его клиенту вместе с заголовками обработчика.
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status != 0 {
+		return
+	}
+	rw.status = status
+	for name, values := range rw.header {
+		rw.ResponseWriter.Header()[name] = values
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write - запоминает тело ответа и передает его клиенту.
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// response - возвращает запомненный ответ.
+func (rw *recordingWriter) response() storedResponse {
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return storedResponse{status: status, header: rw.header.Clone(), body: rw.body.Bytes()}
+}
+
+// errIdempotencyUser - ошибка, показывающая, что ключ идемпотентности передан без cookie пользователя.
+var errIdempotencyUser = errors.New("idempotency key requires a user cookie or token, retry with the issued cookie")
+
+// idempotent - middleware, поддерживающая заголовок Idempotency-Key в запросах создания URL. Первый ответ на запрос
+// с ключом сохраняется для пользователя и эндпоинта и повторяется при повторе запроса с тем же ключом. Ключ,
+// использованный для запроса с другими параметрами или телом, отклоняется с ответом 422, а повтор запроса, который еще
+// выполняется, - с ответом 409. Ответы 429 и 5xx не сохраняются, такой запрос можно повторить с тем же ключом.
+// Запрос с ключом без cookie пользователя отклоняется с ответом 401: новый пользователь выдается на каждый такой запрос,
+// поэтому его повтор не нашел бы первый ответ. Запросы без заголовка, а так же при выключенной поддержке ключей,
+// передаются дальше без изменений.
+func (h ServerHandler) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(idempotency.Header)
+		if h.idempotency == nil || value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := idempotency.ValidKey(value); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if cookieIssued(r) {
+			writeProblem(w, r, http.StatusUnauthorized, errIdempotencyUser.Error())
+			return
+		}
+		userid, ok := userID(w, r)
+		if !ok {
+			return
+		}
+		// Тело запроса читается для отпечатка и возвращается обработчику.
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key := idempotency.Key{UserID: userid, Scope: r.Method + " " + r.URL.Path, Key: value}
+		fingerprint := idempotency.Fingerprint([]byte(r.URL.RawQuery), []byte(r.Header.Get("Content-Type")), body)
+		stored, replay, err := h.idempotency.Begin(key, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			writeProblem(w, r, http.StatusConflict, err.Error())
+			return
+		case errors.Is(err, idempotency.ErrMismatch):
+			writeProblem(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		case replay:
+			stored.write(w)
+			return
+		}
+		// Если ответ не сохранен (в том числе при панике обработчика), ключ освобождается.
+		completed := false
+		defer func() {
+			if !completed {
+				h.idempotency.Abort(key)
+			}
+		}()
+		rec := newRecordingWriter(w)
+		next.ServeHTTP(rec, r)
+		response := rec.response()
+		if response.status >= http.StatusInternalServerError || response.status == http.StatusTooManyRequests {
+			return
+		}
+		h.idempotency.Complete(key, response)
+		completed = true
+	})
+}
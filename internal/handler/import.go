@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/importer"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// errNoTrustedSubnet - ошибка, показывающая, что служебный эндпоинт недоступен без доверенной сети.
+var errNoTrustedSubnet = repository.NewError(repository.KindForbidden, "trusted subnet is not configured")
+
+// PostImport - обработчик эндпоинта POST /api/internal/import?format=<format>&user=<userid>, принимает в теле
+// запроса экспорт другого сервиса сокращения URL и сохраняет его URL пользователю user (по умолчанию - из cookie).
+// Доступен только из доверенной сети. Результаты записей возвращаются потоком NDJSON, последней строкой - итог.
+func (h ServerHandler) PostImport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if h.Conf.TrustedSubnet == "" {
+		writeError(w, r, errNoTrustedSubnet)
+		return
+	}
+	if !h.trusted(w, r) {
+		return
+	}
+	userid := r.URL.Query().Get("user")
+	if userid == "" {
+		var ok bool
+		if userid, ok = userID(w, r); !ok {
+			return
+		}
+	}
+	src, err := importer.NewReader(r.URL.Query().Get("format"), r.Body)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	im := importer.Importer{
+		Storage: h.Storage,
+		UserID:  userid,
+		Timeout: h.Conf.WriteTimeout,
+		Short:   h.Conf.ExpShortURL,
+	}
+	streamResponse(w, r, func(out *json.Encoder, flush func()) {
+		written := 0
+		summary, err := im.Run(r.Context(), src, func(result importer.Result) error {
+			if err := out.Encode(result); err != nil {
+				return err
+			}
+			if written++; written%streamFlushLines == 0 {
+				flush()
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, r.Context().Err()) {
+			out.Encode(importer.Result{Record: summary.Imported + summary.Failed + 1, Error: err.Error()})
+		}
+		out.Encode(summary)
+	})
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// linksPath - путь ресурса сокращенных URL в REST API v2.
+const linksPath = "/api/v2/links"
+
+// decodeStrict - десериализует тело запроса в v, отклоняя неизвестные поля.
+func decodeStrict(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// writeJSON - формирует ответ с кодом status и телом v в формате JSON.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// link - возвращает ресурс REST API v2 для записи URL.
+func (h ServerHandler) link(node repository.NodeURL) repository.Link {
+	return node.Link(h.Conf.ExpShortURL(node.Hash))
+}
+
+// GetLinks - обработчик эндпоинта GET /api/v2/links, возвращает ресурсы всех URL пользователя в порядке создания.
+// Удаленные URL возвращаются с параметром include_deleted=true.
+func (h ServerHandler) GetLinks(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	var deleted bool
+	if value := r.URL.Query().Get("include_deleted"); value != "" {
+		var err error
+		if deleted, err = strconv.ParseBool(value); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "include_deleted must be a boolean")
+			return
+		}
+	}
+	nodes, err := h.Storage.GetUserLinks(ctx, userid, deleted)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	links := make([]repository.Link, 0, len(nodes))
+	for _, node := range nodes {
+		links = append(links, h.link(node))
+	}
+	writeJSON(w, r, http.StatusOK, links)
+}
+
+// PostLink - обработчик эндпоинта POST /api/v2/links, создает URL и возвращает ответ 201 с его ресурсом и заголовком
+// Location. Если тот же адрес уже сокращен этим пользователем, то возвращается ответ 200 с ресурсом этого URL,
+// а если другим пользователем - 409, как в POST /api/shorten.
+func (h ServerHandler) PostLink(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	var input repository.LinkInput
+	if err := decodeStrict(r.Body, &input); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.Destination == "" {
+		writeProblem(w, r, http.StatusBadRequest, "destination is required")
+		return
+	}
+	// Расходуем квоту пользователя на создание URL.
+	id, ok := h.reserveQuota(w, r, 1)
+	if !ok {
+		return
+	}
+	code, status := input.Code, http.StatusCreated
+	var err error
+	if code != "" {
+		err = h.Storage.InsertAlias(ctx, code, input.Destination, userid, input.Options())
+	} else {
+		code, err = h.Storage.InsertLink(ctx, input.Destination, userid, input.Options())
+	}
+	if err != nil {
+		// URL не создан, возвращаем квоту.
+		h.quota.Release(id, 1)
+		if !errors.Is(err, repository.ErrConflictInsert) {
+			writeError(w, r, err)
+			return
+		}
+		status = http.StatusOK
+	}
+	node, err := h.Storage.GetUserLink(ctx, code, userid)
+	if errors.Is(err, repository.ErrNotOwnerURL) && status == http.StatusOK {
+		// Ресурс URL другого пользователя не выдается.
+		writeError(w, r, repository.ErrConflictInsert)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", linksPath+"/"+code)
+	writeJSON(w, r, status, h.link(node))
+}
+
+// GetLink - обработчик эндпоинта GET /api/v2/links/{code}, возвращает ресурс URL, в том числе удаленного.
+// Ресурс доступен только владельцу URL.
+func (h ServerHandler) GetLink(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	node, err := h.Storage.GetUserLink(ctx, chi.URLParam(r, "code"), userid)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, h.link(node))
+}
+
+// PatchLink - обработчик эндпоинта PATCH /api/v2/links/{code}, изменяет переданные поля destination, tags
+// и expires_at и возвращает измененный ресурс URL. Адрес можно изменить только у приватного URL или URL
+// с заданным пользователем идентификатором, иначе возвращается 409.
+func (h ServerHandler) PatchLink(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	var update repository.LinkUpdate
+	if err := decodeStrict(r.Body, &update); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	node, err := h.Storage.UpdateLink(ctx, chi.URLParam(r, "code"), userid, update)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, h.link(node))
+}
+
+// DeleteLink - обработчик эндпоинта DELETE /api/v2/links/{code}, помечает URL удаленным и возвращает ответ 204.
+// В отличие от DELETE /api/user/urls удаление выполняется до ответа, повторное удаление не является ошибкой.
+func (h ServerHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.DeleteTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	code := chi.URLParam(r, "code")
+	// Проверяем, что URL есть и принадлежит пользователю: Delete пропускает чужие URL без ошибки.
+	if _, err := h.Storage.GetUserLink(ctx, code, userid); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := h.Storage.Delete(ctx, []string{code}, userid); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
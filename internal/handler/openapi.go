@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/openapi"
+)
+
+// OpenAPI - обработчик эндпоинта GET /api/openapi.json, возвращает описание API в формате OpenAPI 3.
+func (h ServerHandler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openapi.Spec())
+}
+
+// validateRequest - middleware, проверяющая параметры и тело запроса по описанию API.
+// Запрос, не соответствующий описанию, отклоняется с ответом 400, а с неописанным типом содержимого - 415.
+// Если проверка выключена в конфигурации, то запрос передается дальше без проверки.
+func (h ServerHandler) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.validator == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path := openapi.PathFromRoute(chi.RouteContext(r.Context()).RoutePattern())
+		err := h.validator.Validate(r, path, func(name string) string {
+			if name == "path" {
+				return chi.URLParam(r, "*")
+			}
+			return chi.URLParam(r, name)
+		})
+		switch {
+		case errors.Is(err, openapi.ErrUnsupportedMediaType):
+			writeProblem(w, r, http.StatusUnsupportedMediaType, err.Error())
+		case err != nil:
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
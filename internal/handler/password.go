@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// PasswordHeader - заголовок, в котором API клиенты передают пароль защищенного URL.
+const PasswordHeader = "X-Link-Password"
+
+const (
+	// passwordDelayStep - замедление проверки пароля URL за каждую неудачную попытку сверх общего ограничения.
+	passwordDelayStep = 100 * time.Millisecond
+	// maxPasswordDelay - максимальное замедление проверки пароля URL.
+	maxPasswordDelay = 5 * time.Second
+)
+
+// passwordTemplate - HTML форма ввода пароля защищенного URL.
+var passwordTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Защищенная ссылка</title>
+</head>
+<body>
+<form method="post" action="/{{.Hash}}/unlock{{if .Query}}?{{.Query}}{{end}}">
+<p>Ссылка защищена паролем.</p>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Path}}<input type="hidden" name="path" value="{{.Path}}">{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Перейти</button>
+</form>
+</body>
+</html>
+`))
+
+// UnlockURL - обработчик эндпоинта POST /{hash}/unlock, принимает пароль защищенного URL из HTML формы.
+// Возвращает ответ с кодом 303 и оригинальным URL в HTTP-заголовке Location, если пароль верный.
+func (h ServerHandler) UnlockURL(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
+	defer cancel()
+	// Считываем hash сокращенного URL из параметров запроса.
+	shortURL := chi.URLParam(r, "hash")
+	link, err := h.Storage.GetLink(ctx, shortURL)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Путь после идентификатора для URL в режиме wildcard передается из формы.
+	suffix, err := cleanSuffix(r.PostFormValue("path"))
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if suffix != "" && !link.Wildcard {
+		writeError(w, r, repository.ErrNotFoundURL)
+		return
+	}
+	if !h.checkSchedule(w, r, link) {
+		return
+	}
+	// После отправки формы браузер должен перейти по URL методом GET, поэтому используем 303.
+	switch h.verifyPassword(w, r, shortURL, link, r.PostFormValue("password")) {
+	case http.StatusOK:
+		fullURL, variant := destination(w, r, shortURL, link)
+		fullURL = link.Location(fullURL, suffix, r.URL.Query(), h.Conf.QueryConflict)
+		if err = h.Storage.Click(ctx, shortURL, variant); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		redirect(w, link, fullURL, http.StatusSeeOther)
+	case http.StatusTooManyRequests:
+		passwordForm(w, shortURL, suffix, r.URL.Query(), http.StatusTooManyRequests, "Слишком много попыток, попробуйте позже.")
+	default:
+		passwordForm(w, shortURL, suffix, r.URL.Query(), http.StatusForbidden, "Неверный пароль.")
+	}
+}
+
+// verifyPassword - проверяет пароль URL с учетом ограничения неудачных попыток по URL и IP пользователя.
+// После PasswordMaxLinkAttempts неудачных попыток от всех клиентов проверки пароля URL замедляются (см. passwordDelay),
+// но не блокируются, чтобы перебор с разных адресов не закрывал URL для пользователей, знающих пароль.
+// Возвращает http.StatusOK, если пароль верный, http.StatusTooManyRequests, если попытки исчерпаны,
+// и http.StatusForbidden, если пароль неверный.
+func (h ServerHandler) verifyPassword(w http.ResponseWriter, r *http.Request, hash string, link repository.URL, password string) int {
+	key := hash + "|" + clientIP(r)
+	if left, blocked := h.attempts.Blocked(key); blocked {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(left.Seconds()))))
+		return http.StatusTooManyRequests
+	}
+	if delay := h.passwordDelay(h.linkAttempts.Count(hash)); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return http.StatusTooManyRequests
+		}
+	}
+	if !link.CheckPassword(password) {
+		h.attempts.Fail(key)
+		h.linkAttempts.Fail(hash)
+		return http.StatusForbidden
+	}
+	h.attempts.Reset(key)
+	return http.StatusOK
+}
+
+// passwordDelay - возвращает замедление проверки пароля URL, по которому count неудачных попыток от всех клиентов:
+// passwordDelayStep за каждую попытку сверх PasswordMaxLinkAttempts, но не более maxPasswordDelay.
+func (h ServerHandler) passwordDelay(count int) time.Duration {
+	if h.Conf.PasswordMaxLinkAttempts <= 0 || count < h.Conf.PasswordMaxLinkAttempts {
+		return 0
+	}
+	delay := time.Duration(count-h.Conf.PasswordMaxLinkAttempts+1) * passwordDelayStep
+	if delay > maxPasswordDelay {
+		return maxPasswordDelay
+	}
+	return delay
+}
+
+// passwordForm - формирует ответ с HTML формой ввода пароля.
+// Путь suffix и параметры запроса query сохраняются в форме, чтобы после ввода пароля они попали в адрес перенаправления.
+func passwordForm(w http.ResponseWriter, hash string, suffix string, query url.Values, statusCode int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(statusCode)
+	passwordTemplate.Execute(w, struct {
+		Hash    string
+		Path    string
+		Query   template.URL
+		Message string
+	}{Hash: hash, Path: suffix, Query: template.URL(query.Encode()), Message: message})
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// ProblemContentType - тип содержимого ответа с описанием ошибки (RFC 7807).
+const ProblemContentType = "application/problem+json"
+
+// Типы описания ошибок, по которым клиент отличает ответы с одинаковым кодом.
+const (
+	ProblemNotActive = "urn:shortener:problem:not-active" // срок действия URL еще не наступил.
+	ProblemExpired   = "urn:shortener:problem:expired"    // срок действия URL истек.
+)
+
+// errNoUserCookie - ошибка, показывающая, что в запросе нет cookie пользователя.
+var errNoUserCookie = errors.New("ErrNoUserCookie")
+
+// Problem - описание ошибки в формате RFC 7807.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// newProblem - конструктор описания ошибки с кодом ответа status для запроса r.
+func newProblem(r *http.Request, status int, detail string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// write - формирует ответ с описанием ошибки.
+func (p Problem) write(w http.ResponseWriter) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+// writeProblem - формирует ответ с кодом status и описанием ошибки detail.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	newProblem(r, status, detail).write(w)
+}
+
+// writeError - формирует ответ для ошибки err, код ответа выбирается по виду ошибки.
+// Текст внутренних ошибок не передается клиенту, а записывается в журнал.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	kind, detail := errorDetail(r, err)
+	p := newProblem(r, statusOf(kind), detail)
+	p.Kind = kind.String()
+	switch {
+	case errors.Is(err, repository.ErrNotActiveURL):
+		p.Type = ProblemNotActive
+	case errors.Is(err, repository.ErrExpiredURL):
+		p.Type = ProblemExpired
+	}
+	p.write(w)
+}
+
+// errorDetail - возвращает вид ошибки и ее текст для клиента. Текст внутренних ошибок записывается в журнал.
+func errorDetail(r *http.Request, err error) (repository.Kind, string) {
+	kind := repository.KindOf(err)
+	if kind == repository.KindInternal {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		return kind, ""
+	}
+	return kind, err.Error()
+}
+
+// statusOf - возвращает код HTTP ответа для вида ошибки.
+func statusOf(kind repository.Kind) int {
+	switch kind {
+	case repository.KindNotFound:
+		return http.StatusNotFound
+	case repository.KindGone:
+		return http.StatusGone
+	case repository.KindConflict:
+		return http.StatusConflict
+	case repository.KindInvalid:
+		return http.StatusBadRequest
+	case repository.KindForbidden, repository.KindNotActive:
+		return http.StatusForbidden
+	case repository.KindUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// userID - возвращает идентификатор пользователя из токена cookie. Если пользователь не определен, то формирует ответ 401.
+func userID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userid, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeProblem(w, r, http.StatusUnauthorized, errNoUserCookie.Error())
+		return "", false
+	}
+	return userid, true
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
+)
+
+// Option - функция, применяемая к контроллеру роутера при его создании.
+type Option func(*ServerHandler)
+
+// WithQuota - задает учет квот на создание URL, общий с другими серверами сервиса (например, gRPC).
+func WithQuota(q *quota.Quota) Option {
+	return func(h *ServerHandler) {
+		h.quota = q
+	}
+}
+
+// WithAPIKeys - задает разрешенные API ключи клиентов, общие с другими серверами сервиса (например, gRPC).
+func WithAPIKeys(keys auth.APIKeys) Option {
+	return func(h *ServerHandler) {
+		h.apiKeys = keys
+	}
+}
+
+// apiKey - возвращает идентификатор API ключа из заголовка запроса, если ключ разрешен.
+func (h ServerHandler) apiKey(r *http.Request) (string, bool) {
+	return h.apiKeys.Identify(r.Header.Get(ratelimit.APIKeyHeader))
+}
+
+// quotaIdentity - возвращает пользователя, на которого расходуется квота: разрешенный API ключ, если он передан,
+// иначе пользователь из cookie или токена. Запрос без cookie расходует квоту IP адреса клиента,
+// иначе каждый такой запрос получал бы новую cookie и полную квоту.
+func (h ServerHandler) quotaIdentity(r *http.Request) quota.Identity {
+	if key, ok := h.apiKey(r); ok {
+		return quota.Identity{Tier: quota.TierAPIKey, ID: key}
+	}
+	if cookieIssued(r) {
+		return quota.Identity{Tier: quota.TierAnonymous, ID: "ip:" + clientIP(r)}
+	}
+	id, _ := auth.FromContext(r.Context())
+	return quota.Identity{Tier: quota.TierAnonymous, ID: id}
+}
+
+// reserveQuota - расходует квоту пользователя на создание n URL. Если квота исчерпана, то формирует ответ:
+// 429 с заголовком Retry-After для суточной квоты и 403 для общей.
+func (h ServerHandler) reserveQuota(w http.ResponseWriter, r *http.Request, n int) (quota.Identity, bool) {
+	id := h.quotaIdentity(r)
+	err := h.quota.Reserve(id, n)
+	switch {
+	case err == nil:
+		return id, true
+	case errors.Is(err, quota.ErrDailyQuotaExceeded):
+		left := time.Until(quota.NextReset(time.Now()))
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(left.Seconds()))))
+		writeProblem(w, r, http.StatusTooManyRequests, err.Error())
+	default:
+		writeProblem(w, r, http.StatusForbidden, err.Error())
+	}
+	return id, false
+}
+
+// GetQuota - обработчик эндпоинта GET /api/user/quota, возвращает использование и остаток квот пользователя.
+func (h ServerHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	response, err := json.Marshal(h.quota.Usage(h.quotaIdentity(r)))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/auth"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/ratelimit"
+)
+
+// rateLimit - middleware, ограничивающая частоту запросов группы group по ключу клиента.
+// При превышении бюджета возвращает ответ 429 с заголовком Retry-After.
+func (h ServerHandler) rateLimit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := h.limiters.Allow(group, h.rateKey(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeProblem(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateKey - возвращает ключ, по которому учитываются запросы клиента: API ключ, идентификатор пользователя
+// или IP адрес, в зависимости от конфигурации. Если разрешенного API ключа или cookie пользователя нет,
+// то используется IP адрес.
+func (h ServerHandler) rateKey(r *http.Request) string {
+	switch h.Conf.RateLimitKey {
+	case ratelimit.KeyAPIKey:
+		if key, ok := h.apiKey(r); ok {
+			return "key:" + key
+		}
+	case ratelimit.KeyUser:
+		// Cookie, выданная в этом же запросе, не идентифицирует клиента: иначе клиент без cookie не ограничивался бы.
+		if userid, ok := auth.FromContext(r.Context()); ok && !cookieIssued(r) {
+			return "user:" + userid
+		}
+	}
+	return "ip:" + clientIP(r)
+}
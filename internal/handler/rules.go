@@ -0,0 +1,13 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// ruleContext - собирает из запроса сведения для проверки правил перенаправления.
+func ruleContext(r *http.Request) repository.RuleContext {
+	return repository.NewRuleContext(r.UserAgent(), r.Header.Get("Accept-Language"), time.Now())
+}
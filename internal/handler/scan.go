@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// maxScanDelay - максимальное замедление ответа клиенту, перебирающему сокращенные URL.
+const maxScanDelay = 5 * time.Second
+
+// scanGuard - middleware, защищающая маршрут перехода от перебора сокращенных URL.
+// Учитывает ответы 404 по IP клиента, который клиент не может подменить заголовками: адресу соединения или адресу
+// из заголовков доверенного прокси (см. realIP). После ScanSlowdownAfter ответов каждый следующий запрос замедляется
+// на ScanSlowdownStep за каждый лишний ответ, после ScanMaxNotFound ответов клиент блокируется на время ScanBan.
+func (h ServerHandler) scanGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientIP(r)
+		if left, blocked := h.scans.Blocked(key); blocked {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(left.Seconds()))))
+			writeProblem(w, r, http.StatusTooManyRequests, "too many requests to missing URLs")
+			return
+		}
+		if delay := h.scanDelay(h.scans.Count(key)); delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() == http.StatusNotFound {
+			h.scans.Fail(key)
+		}
+	})
+}
+
+// scanDelay - возвращает замедление ответа клиенту, получившему count ответов 404.
+func (h ServerHandler) scanDelay(count int) time.Duration {
+	if h.Conf.ScanSlowdownAfter <= 0 || count <= h.Conf.ScanSlowdownAfter {
+		return 0
+	}
+	delay := time.Duration(count-h.Conf.ScanSlowdownAfter) * h.Conf.ScanSlowdownStep
+	if delay > maxScanDelay {
+		return maxScanDelay
+	}
+	return delay
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// Настройки потокового создания сокращенных URL.
+const (
+	NDJSONContentType = "application/x-ndjson" // тип содержимого потоков JSON объектов, разделенных переводом строки.
+
+	maxStreamLine    = 64 << 10 // максимальная длина строки запроса в байтах.
+	streamFlushLines = 100      // количество строк ответа, после которого они отправляются клиенту.
+)
+
+// streamResult - строка ответа потокового создания сокращенных URL: сокращенный URL или ошибка обработки строки запроса.
+type streamResult struct {
+	repository.ShortBatch
+	Line  int    `json:"line,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// PostStream - обработчик эндпоинта POST /api/shorten/stream, принимает в теле запроса поток JSON объектов
+// {"correlation_id":"<some_id>","original_url":"<some_original_url>"}, разделенных переводом строки (NDJSON).
+// Строки обрабатываются по одной, а результаты возвращаются потоком NDJSON по мере обработки, поэтому память
+// не зависит от размера запроса. Ошибка обработки строки возвращается в поле error и не прерывает обработку,
+// исчерпание квоты или отмена запроса прерывают ее.
+func (h ServerHandler) PostStream(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	streamResponse(w, r, func(out *json.Encoder, flush func()) {
+		h.shortenStream(r, userid, bufio.NewReader(r.Body), out, flush)
+	})
+}
+
+// streamResponse - отправляет ответ потоком NDJSON, строки которого fn пишет в out по мере чтения тела запроса.
+// HTTP/1.1 по умолчанию не позволяет читать тело запроса после начала ответа. Если полнодуплексный режим
+// недоступен, то строки ответа накапливаются во временном файле и отправляются после чтения запроса.
+func streamResponse(w http.ResponseWriter, r *http.Request, fn func(out *json.Encoder, flush func())) {
+	out := io.Writer(w)
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	if r.ProtoMajor < 2 && !enableFullDuplex(w) {
+		spool, err := os.CreateTemp("", "shortener-stream-*")
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		buf := bufio.NewWriter(spool)
+		out, flush = buf, func() {}
+		defer func() {
+			if err = buf.Flush(); err == nil {
+				if _, err = spool.Seek(0, io.SeekStart); err == nil {
+					_, err = io.Copy(w, spool)
+				}
+			}
+			if err != nil {
+				log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			}
+		}()
+	}
+	w.Header().Set("Content-Type", NDJSONContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	fn(json.NewEncoder(out), flush)
+	flush()
+}
+
+// shortenStream - читает строки запроса из in, сохраняет URL и пишет результаты в out.
+func (h ServerHandler) shortenStream(r *http.Request, userid string, in *bufio.Reader, out *json.Encoder, flush func()) {
+	id := h.quotaIdentity(r)
+	for line, written := 1, 0; ; line++ {
+		data, err := readLine(in)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			out.Encode(streamResult{Line: line, Error: err.Error()})
+			return
+		}
+		if len(data) == 0 {
+			continue
+		}
+		var full repository.FullBatch
+		if err = json.Unmarshal(data, &full); err != nil {
+			out.Encode(streamResult{Line: line, Error: err.Error()})
+			continue
+		}
+		result := streamResult{ShortBatch: repository.ShortBatch{CorID: full.CorID}, Line: line}
+		// Квота расходуется на каждый URL, после ее исчерпания обработка прекращается.
+		if err = h.quota.Reserve(id, 1); err != nil {
+			result.Error = err.Error()
+			out.Encode(result)
+			return
+		}
+		result.Short, result.Error = h.streamInsert(r, id, func(ctx context.Context) (string, error) {
+			return h.Storage.InsertURL(ctx, full.Full, userid)
+		})
+		if err = out.Encode(result); err != nil || r.Context().Err() != nil {
+			return
+		}
+		// Результаты отправляются каждые streamFlushLines строк, а так же перед ожиданием следующих строк запроса.
+		if written++; written%streamFlushLines == 0 || in.Buffered() == 0 {
+			flush()
+		}
+	}
+}
+
+// streamInsert - сохраняет URL строки потокового запроса, на который уже зарезервирована квота. Возвращает
+// сокращенный URL, в том числе сохраненный ранее, или описание ошибки. Если новый URL не создан, квота возвращается.
+func (h ServerHandler) streamInsert(r *http.Request, id quota.Identity, insert func(ctx context.Context) (string, error)) (string, string) {
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
+	short, err := insert(ctx)
+	cancel()
+	if err == nil {
+		return h.Conf.ExpShortURL(short), ""
+	}
+	h.quota.Release(id, 1)
+	if errors.Is(err, repository.ErrConflictInsert) {
+		return h.Conf.ExpShortURL(short), ""
+	}
+	_, detail := errorDetail(r, err)
+	if detail == "" {
+		detail = repository.KindInternal.String()
+	}
+	return "", detail
+}
+
+// readLine - читает строку запроса без перевода строки. Строки длиннее maxStreamLine недопустимы.
+func readLine(in *bufio.Reader) ([]byte, error) {
+	line := make([]byte, 0)
+	for {
+		chunk, err := in.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxStreamLine+1 {
+			return nil, fmt.Errorf("line is longer than %d bytes", maxStreamLine)
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && len(line) > 0:
+			return trimLine(line), nil
+		case err != nil:
+			return nil, err
+		}
+		return trimLine(line), nil
+	}
+}
+
+// trimLine - отбрасывает перевод строки в конце строки запроса.
+func trimLine(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line
+}
+
+// enableFullDuplex - разрешает чтение тела запроса HTTP/1.1 после начала ответа, если сервер это поддерживает.
+// Обертки ResponseWriter, созданные middleware, пропускаются через метод Unwrap.
+func enableFullDuplex(w http.ResponseWriter) bool {
+	for {
+		switch rw := w.(type) {
+		case interface{ EnableFullDuplex() error }:
+			return rw.EnableFullDuplex() == nil
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false
+		}
+	}
+}
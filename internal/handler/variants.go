@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// variantCookiePrefix - префикс имени cookie, закрепляющей за пользователем вариант URL.
+const variantCookiePrefix = "shortener_variant_"
+
+// variantCookieAge - время, на которое вариант URL закрепляется за пользователем.
+const variantCookieAge = 30 * 24 * time.Hour
+
+// destination - возвращает адрес перенаправления по URL и идентификатор выбранного варианта.
+// Сначала проверяются правила перенаправления, затем варианты A/B теста, иначе используется оригинальный URL.
+// Выбранный вариант закрепляется за пользователем cookie, чтобы при повторном переходе он попал на тот же вариант.
+func destination(w http.ResponseWriter, r *http.Request, hash string, link repository.URL) (string, string) {
+	if rule, ok := link.MatchRule(ruleContext(r)); ok {
+		return rule.URL, ""
+	}
+	if len(link.Variants) == 0 {
+		return link.FURL, ""
+	}
+	name := variantCookiePrefix + hash
+	if cookie, err := r.Cookie(name); err == nil {
+		if variant, ok := link.Variant(cookie.Value); ok {
+			return variant.URL, variant.ID
+		}
+	}
+	variant := link.PickVariant()
+	// Cookie выдается с теми же ограничениями, что и cookie пользователя.
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    variant.ID,
+		Path:     "/" + hash,
+		MaxAge:   int(variantCookieAge.Seconds()),
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return variant.URL, variant.ID
+}
+
+// SetVariants - обработчик эндпоинта PUT /api/user/urls/{hash}/variants, принимает в теле запроса массив JSON
+// с вариантами URL и их весами. Заменяет варианты URL пользователя, пустой массив отключает A/B тест.
+func (h ServerHandler) SetVariants(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
+	defer cancel()
+	// Читаем тело запроса.
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Считываем cookie пользователя.
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	var variants []repository.Variant
+	if err = json.Unmarshal(body, &variants); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	err = h.Storage.SetVariants(ctx, chi.URLParam(r, "hash"), userid, variants)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetLinkStats - обработчик эндпоинта GET /api/user/urls/{hash}/stats, возвращает статистику переходов
+// по URL пользователя и по каждому его варианту.
+func (h ServerHandler) GetLinkStats(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
+	defer cancel()
+	// Считываем cookie пользователя.
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	stats, err := h.Storage.GetLinkStats(ctx, chi.URLParam(r, "hash"), userid)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response, err := json.Marshal(stats)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
@@ -0,0 +1,265 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/quota"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// webPath - путь веб-интерфейса управления URL пользователя.
+const webPath = "/ui"
+
+// webCSP - политика безопасности содержимого страниц веб-интерфейса: страницы не используют JavaScript
+// и не встраиваются в страницы других сайтов.
+const webCSP = "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'"
+
+// webFS - шаблоны страниц веб-интерфейса.
+//
+//go:embed web/*.html
+var webFS embed.FS
+
+// webPages - страницы веб-интерфейса, каждая собирается из общего макета и своего содержимого.
+var webPages = map[string]*template.Template{
+	"links": webTemplate("links.html"),
+	"link":  webTemplate("link.html"),
+	"error": webTemplate("error.html"),
+}
+
+// webTemplate - разбирает шаблон страницы name вместе с общим макетом.
+func webTemplate(name string) *template.Template {
+	funcs := template.FuncMap{"join": strings.Join}
+	return template.Must(template.New(name).Funcs(funcs).ParseFS(webFS, "web/layout.html", "web/"+name))
+}
+
+// webPage - данные страницы веб-интерфейса.
+type webPage struct {
+	Title   string
+	Message string
+	// CSRF - токен защиты от CSRF для форм страницы.
+	CSRF string
+	// Query - строка поиска по URL пользователя.
+	Query string
+	// URL и Code - значения формы сокращения URL, сохраняемые при ошибке.
+	URL  string
+	Code string
+	// Created - сокращенный URL, созданный формой сокращения.
+	Created string
+	Links   []repository.Link
+	Link    repository.Link
+	Stats   repository.LinkStats
+}
+
+// renderPage - формирует ответ с кодом status и страницей веб-интерфейса name.
+func renderPage(w http.ResponseWriter, r *http.Request, name string, status int, page webPage) {
+	var buf bytes.Buffer
+	if err := webPages[name].ExecuteTemplate(&buf, "layout", page); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Content-Security-Policy", webCSP)
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// webError - формирует страницу веб-интерфейса с описанием ошибки err, код ответа выбирается по виду ошибки.
+func webError(w http.ResponseWriter, r *http.Request, err error) {
+	kind, detail := errorDetail(r, err)
+	webProblem(w, r, statusOf(kind), detail)
+}
+
+// webProblem - формирует страницу веб-интерфейса с кодом status и описанием ошибки detail.
+func webProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	if detail == "" {
+		detail = http.StatusText(status)
+	}
+	renderPage(w, r, "error", status, webPage{Title: "Ошибка", Message: detail})
+}
+
+// webCSRF - проверяет токен защиты от CSRF из формы. Если токен неверный, то формирует ответ 403.
+func webCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if checkCSRF(r, r.PostFormValue(CSRFField)) {
+		return true
+	}
+	webProblem(w, r, http.StatusForbidden, "Форма устарела, обновите страницу и отправьте ее снова.")
+	return false
+}
+
+// matchLink - сообщает, содержат ли идентификатор, адрес или метки URL строку поиска query без учета регистра.
+func matchLink(node repository.NodeURL, query string) bool {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return true
+	}
+	contains := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), query)
+	}
+	if contains(node.Hash) || contains(node.FURL) {
+		return true
+	}
+	for _, tag := range node.Tags {
+		if contains(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderLinks - формирует страницу со списком URL пользователя, отобранных строкой поиска, и формой сокращения URL.
+func (h ServerHandler) renderLinks(ctx context.Context, w http.ResponseWriter, r *http.Request, userid string, status int, page webPage) {
+	token, err := csrfToken(w, r)
+	if err != nil {
+		webError(w, r, err)
+		return
+	}
+	nodes, err := h.Storage.GetUserLinks(ctx, userid, false)
+	if err != nil {
+		webError(w, r, err)
+		return
+	}
+	for _, node := range nodes {
+		if matchLink(node, page.Query) {
+			page.Links = append(page.Links, h.link(node))
+		}
+	}
+	page.Title = "Мои ссылки"
+	page.CSRF = token
+	renderPage(w, r, "links", status, page)
+}
+
+// WebLinks - обработчик эндпоинта GET /ui, возвращает страницу с формой сокращения URL и списком URL пользователя.
+// Параметр q отбирает URL по идентификатору, адресу или метке.
+func (h ServerHandler) WebLinks(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	page := webPage{Query: r.URL.Query().Get("q")}
+	if created := r.URL.Query().Get("created"); created != "" {
+		page.Created = h.Conf.ExpShortURL(created)
+	}
+	h.renderLinks(ctx, w, r, userid, http.StatusOK, page)
+}
+
+// WebCreateLink - обработчик эндпоинта POST /ui/links, сокращает URL из формы и перенаправляет на список URL
+// с ответом 303. Если URL не создан, то возвращает страницу списка с описанием ошибки и значениями формы.
+func (h ServerHandler) WebCreateLink(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.WriteTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok || !webCSRF(w, r) {
+		return
+	}
+	page := webPage{
+		URL:  strings.TrimSpace(r.PostFormValue("url")),
+		Code: strings.TrimSpace(r.PostFormValue("code")),
+	}
+	if page.URL == "" {
+		page.Message = "Укажите адрес для сокращения."
+		h.renderLinks(ctx, w, r, userid, http.StatusBadRequest, page)
+		return
+	}
+	// Расходуем квоту пользователя на создание URL.
+	id := h.quotaIdentity(r)
+	if err := h.quota.Reserve(id, 1); err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, quota.ErrDailyQuotaExceeded) {
+			status = http.StatusTooManyRequests
+		}
+		page.Message = err.Error()
+		h.renderLinks(ctx, w, r, userid, status, page)
+		return
+	}
+	code := page.Code
+	var err error
+	if code != "" {
+		err = h.Storage.InsertAlias(ctx, code, page.URL, userid, repository.LinkOptions{})
+	} else {
+		code, err = h.Storage.InsertLink(ctx, page.URL, userid, repository.LinkOptions{})
+	}
+	if err != nil {
+		// URL не создан, возвращаем квоту.
+		h.quota.Release(id, 1)
+		// Уже сокращенный адрес не является ошибкой: показываем его сокращенный URL.
+		if !errors.Is(err, repository.ErrConflictInsert) {
+			kind, detail := errorDetail(r, err)
+			if detail == "" {
+				detail = http.StatusText(statusOf(kind))
+			}
+			page.Message = detail
+			h.renderLinks(ctx, w, r, userid, statusOf(kind), page)
+			return
+		}
+	}
+	// После отправки формы браузер должен перейти на список методом GET, поэтому используем 303.
+	http.Redirect(w, r, webPath+"?created="+url.QueryEscape(code), http.StatusSeeOther)
+}
+
+// WebLink - обработчик эндпоинта GET /ui/links/{code}, возвращает страницу URL пользователя со статистикой переходов.
+func (h ServerHandler) WebLink(w http.ResponseWriter, r *http.Request) {
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.ReadTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok {
+		return
+	}
+	code := chi.URLParam(r, "code")
+	stats, err := h.Storage.GetLinkStats(ctx, code, userid)
+	if err != nil {
+		webError(w, r, err)
+		return
+	}
+	node, err := h.Storage.GetUserLink(ctx, code, userid)
+	if err != nil {
+		webError(w, r, err)
+		return
+	}
+	token, err := csrfToken(w, r)
+	if err != nil {
+		webError(w, r, err)
+		return
+	}
+	renderPage(w, r, "link", http.StatusOK, webPage{Title: "Ссылка " + code, CSRF: token, Link: h.link(node), Stats: stats})
+}
+
+// WebDeleteLink - обработчик эндпоинта POST /ui/links/{code}/delete, удаляет URL пользователя до ответа
+// и перенаправляет на список URL с ответом 303.
+func (h ServerHandler) WebDeleteLink(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	// Инициализируем контекст на основе контекста запроса.
+	ctx, cancel := repository.WithTimeout(r.Context(), h.Conf.DeleteTimeout)
+	defer cancel()
+	userid, ok := userID(w, r)
+	if !ok || !webCSRF(w, r) {
+		return
+	}
+	code := chi.URLParam(r, "code")
+	// Проверяем, что URL есть и принадлежит пользователю: Delete пропускает чужие URL без ошибки.
+	if _, err := h.Storage.GetUserLink(ctx, code, userid); err != nil {
+		webError(w, r, err)
+		return
+	}
+	if err := h.Storage.Delete(ctx, []string{code}, userid); err != nil {
+		webError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, webPath, http.StatusSeeOther)
+}
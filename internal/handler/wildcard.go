@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errInvalidPathSuffix - ошибка, показывающая, что путь после идентификатора сокращенного URL недопустим.
+var errInvalidPathSuffix = errors.New("ErrInvalidPathSuffix")
+
+// pathSuffix - возвращает путь запроса после идентификатора сокращенного URL, например "getting-started"
+// для запроса /docs/getting-started. Путь возвращается в экранированном виде.
+func pathSuffix(r *http.Request) (string, error) {
+	escaped := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	i := strings.Index(escaped, "/")
+	if i < 0 {
+		return "", nil
+	}
+	return cleanSuffix(escaped[i+1:])
+}
+
+// cleanSuffix - проверяет путь, добавляемый к адресу перенаправления, и заново экранирует его сегменты.
+// Пустые сегменты отбрасываются, сегменты "." и "..", а так же закодированные разделители пути
+// и управляющие символы недопустимы, чтобы путь не мог выйти за пределы адреса перенаправления.
+func cleanSuffix(escaped string) (string, error) {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(escaped, "/") {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", errInvalidPathSuffix
+		}
+		if decoded == "" {
+			continue
+		}
+		if decoded == "." || decoded == ".." || strings.ContainsAny(decoded, "/\\") {
+			return "", errInvalidPathSuffix
+		}
+		for _, c := range decoded {
+			if c < 0x20 || c == 0x7f {
+				return "", errInvalidPathSuffix
+			}
+		}
+		segments = append(segments, url.PathEscape(decoded))
+	}
+	if len(segments) == 0 {
+		return "", nil
+	}
+	suffix := strings.Join(segments, "/")
+	if strings.HasSuffix(escaped, "/") {
+		suffix += "/"
+	}
+	return suffix, nil
+}
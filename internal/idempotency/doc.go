@@ -0,0 +1,4 @@
+// Package idempotency - internal package, хранящий ответы на запросы создания URL по ключу идемпотентности
+// (заголовок Idempotency-Key, в gRPC - метаданные idempotency-key). Повтор запроса с тем же ключом получает
+// сохраненный ответ, а не создает URL заново. Ответы хранятся в памяти процесса в течение заданного времени.
+package idempotency
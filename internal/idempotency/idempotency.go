@@ -0,0 +1,145 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Названия ключа идемпотентности в запросах.
+const (
+	Header   = "Idempotency-Key" // заголовок HTTP запроса.
+	Metadata = "idempotency-key" // метаданные gRPC запроса.
+
+	// ReplayedHeader - заголовок (в gRPC - метаданные) ответа, отмечающий повтор сохраненного ответа.
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// MaxKeyLength - максимальная длина ключа идемпотентности.
+const MaxKeyLength = 255
+
+// ErrInvalidKey - ошибка, показывающая, что ключ идемпотентности задан неверно.
+var ErrInvalidKey = errors.New("idempotency key must be 1-255 printable ASCII characters")
+
+// ErrInProgress - ошибка, показывающая, что запрос с тем же ключом еще выполняется.
+var ErrInProgress = errors.New("request with this idempotency key is in progress")
+
+// ErrMismatch - ошибка, показывающая, что ключ уже использован для другого запроса.
+var ErrMismatch = errors.New("idempotency key is already used for a different request")
+
+// Key - ключ сохраненного ответа: ключ идемпотентности действует в пределах пользователя и эндпоинта (метода).
+type Key struct {
+	UserID string
+	Scope  string
+	Key    string
+}
+
+// Store - хранилище ответов по ключам идемпотентности.
+type Store[T any] struct {
+	ttl     time.Duration
+	entries map[Key]*entry[T]
+	sweep   time.Time
+	sync.Mutex
+}
+
+// entry - запрос с ключом идемпотентности: выполняемый или завершенный с сохраненным ответом.
+type entry[T any] struct {
+	fingerprint string
+	done        bool
+	value       T
+	expires     time.Time
+}
+
+// New - конструктор хранилища, хранящего ответы в течение ttl.
+func New[T any](ttl time.Duration) *Store[T] {
+	return &Store[T]{
+		ttl:     ttl,
+		entries: make(map[Key]*entry[T]),
+	}
+}
+
+// ValidKey - проверяет ключ идемпотентности.
+func ValidKey(key string) error {
+	if key == "" || len(key) > MaxKeyLength {
+		return ErrInvalidKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// Fingerprint - возвращает отпечаток запроса по его частям, по которому повтор отличается от другого запроса.
+func Fingerprint(parts ...[]byte) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(part)))
+		hash.Write(size[:])
+		hash.Write(part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Begin - начинает запрос с ключом key и отпечатком fingerprint. Если ответ на запрос уже сохранен, то возвращает
+// его и replay. Если запрос с тем же ключом еще выполняется - ErrInProgress, если ключ использован для запроса
+// с другим отпечатком - ErrMismatch. Иначе запрос отмечается выполняемым до вызова Complete или Abort.
+func (s *Store[T]) Begin(key Key, fingerprint string) (value T, replay bool, err error) {
+	return s.begin(key, fingerprint, time.Now())
+}
+
+// begin - реализация Begin для момента now.
+func (s *Store[T]) begin(key Key, fingerprint string, now time.Time) (value T, replay bool, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.removeExpired(now)
+	e, ok := s.entries[key]
+	if ok && now.Before(e.expires) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return value, false, ErrMismatch
+		case !e.done:
+			return value, false, ErrInProgress
+		}
+		return e.value, true, nil
+	}
+	s.entries[key] = &entry[T]{fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	return value, false, nil
+}
+
+// Complete - сохраняет ответ value на запрос с ключом key на время ttl.
+func (s *Store[T]) Complete(key Key, value T) {
+	s.Lock()
+	defer s.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.done = true
+		e.value = value
+		e.expires = time.Now().Add(s.ttl)
+	}
+}
+
+// Abort - освобождает ключ запроса, ответ на который не сохраняется (например, при ошибке сервиса),
+// чтобы повтор запроса выполнился заново.
+func (s *Store[T]) Abort(key Key) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.entries, key)
+}
+
+// removeExpired - удаляет просроченные ответы, не чаще раза в ttl. Вызывается под блокировкой хранилища.
+func (s *Store[T]) removeExpired(now time.Time) {
+	if now.Before(s.sweep) {
+		return
+	}
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+	s.sweep = now.Add(s.ttl)
+}
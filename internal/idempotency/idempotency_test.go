@@ -0,0 +1,61 @@
+package idempotency
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Begin(t *testing.T) {
+	store := New[string](time.Hour)
+	now := time.Now()
+	key := Key{UserID: "user", Scope: "POST /api/shorten", Key: "key"}
+	_, replay, err := store.begin(key, "a", now)
+	require.NoError(t, err)
+	assert.False(t, replay)
+	// Пока запрос выполняется, повтор отклоняется.
+	_, _, err = store.begin(key, "a", now)
+	assert.ErrorIs(t, err, ErrInProgress)
+	store.Complete(key, "response")
+	value, replay, err := store.begin(key, "a", now)
+	require.NoError(t, err)
+	assert.True(t, replay)
+	assert.Equal(t, "response", value)
+	// Ключ с другим запросом отклоняется, а у другого пользователя - независим.
+	_, _, err = store.begin(key, "b", now)
+	assert.ErrorIs(t, err, ErrMismatch)
+	_, replay, err = store.begin(Key{UserID: "another", Scope: key.Scope, Key: key.Key}, "b", now)
+	require.NoError(t, err)
+	assert.False(t, replay)
+	// После ttl ключ можно использовать заново.
+	_, replay, err = store.begin(key, "b", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, replay)
+	assert.Len(t, store.entries, 1)
+}
+
+func TestStore_Abort(t *testing.T) {
+	store := New[string](time.Hour)
+	key := Key{UserID: "user", Key: "key"}
+	_, _, err := store.Begin(key, "a")
+	require.NoError(t, err)
+	store.Abort(key)
+	_, replay, err := store.Begin(key, "b")
+	require.NoError(t, err)
+	assert.False(t, replay)
+}
+
+func TestValidKey(t *testing.T) {
+	assert.NoError(t, ValidKey("8e03978e-40d5-43e8-bc93-6894a57f9324"))
+	assert.ErrorIs(t, ValidKey(""), ErrInvalidKey)
+	assert.ErrorIs(t, ValidKey("key\n"), ErrInvalidKey)
+	assert.ErrorIs(t, ValidKey(strings.Repeat("k", MaxKeyLength+1)), ErrInvalidKey)
+}
+
+func TestFingerprint(t *testing.T) {
+	assert.Equal(t, Fingerprint([]byte("a"), []byte("b")), Fingerprint([]byte("a"), []byte("b")))
+	assert.NotEqual(t, Fingerprint([]byte("ab"), []byte("")), Fingerprint([]byte("a"), []byte("b")))
+}
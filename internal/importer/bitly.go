@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// bitlyColumns - названия колонок CSV экспорта Bitly для каждого поля URL. Названия сравниваются
+// без учета регистра, пробелы и дефисы считаются подчеркиваниями.
+var bitlyColumns = map[string][]string{
+	"url":     {"long_url", "destination_url", "original_url", "url"},
+	"code":    {"custom_bitlinks", "bitlink", "link", "short_url", "id", "backhalf"},
+	"created": {"created_at", "created", "date_created", "creation_date"},
+	"clicks":  {"clicks", "total_clicks", "user_clicks", "link_clicks"},
+	"tags":    {"tags", "tag"},
+}
+
+// bitlyReader - Reader CSV экспорта Bitly. Колонки определяются по заголовку в первой строке.
+type bitlyReader struct {
+	csv     *csv.Reader
+	columns map[string][]int
+	record  int
+}
+
+// newBitlyReader - конструктор Reader CSV экспорта Bitly.
+func newBitlyReader(r io.Reader) *bitlyReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	return &bitlyReader{csv: reader}
+}
+
+// Read - возвращает следующий URL экспорта.
+func (b *bitlyReader) Read() (Link, error) {
+	if b.columns == nil {
+		header, err := b.csv.Read()
+		if err != nil {
+			return Link{}, err
+		}
+		if b.columns, err = bitlyHeader(header); err != nil {
+			return Link{}, err
+		}
+	}
+	record, err := b.csv.Read()
+	if errors.Is(err, io.EOF) {
+		return Link{}, err
+	}
+	b.record++
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Link{}, &RecordError{Record: b.record, Err: parseErr.Err}
+	}
+	if err != nil {
+		return Link{}, err
+	}
+	link := Link{
+		URL:  b.value(record, "url"),
+		Tags: repository.ParseTags(b.value(record, "tags")),
+	}
+	// В колонке может быть несколько сокращенных URL, сохраняется первый.
+	if codes := strings.FieldsFunc(b.value(record, "code"), isSeparator); len(codes) > 0 {
+		link.Code = codeOf(codes[0])
+	}
+	if link.CreatedAt, err = parseTime(b.value(record, "created")); err != nil {
+		return link, &RecordError{Record: b.record, Err: err}
+	}
+	if link.Clicks, err = parseClicks(b.value(record, "clicks")); err != nil {
+		return link, &RecordError{Record: b.record, Err: err}
+	}
+	return link, nil
+}
+
+// value - возвращает первое непустое значение колонок поля name записи.
+func (b *bitlyReader) value(record []string, name string) string {
+	for _, i := range b.columns[name] {
+		if i < len(record) && strings.TrimSpace(record[i]) != "" {
+			return strings.TrimSpace(record[i])
+		}
+	}
+	return ""
+}
+
+// isSeparator - разделитель нескольких сокращенных URL в одной колонке.
+func isSeparator(r rune) bool {
+	return r == ',' || r == ';' || r == ' '
+}
+
+// bitlyHeader - определяет номера колонок полей URL по заголовку экспорта в порядке их приоритета.
+// Колонка URL обязательна.
+func bitlyHeader(header []string) (map[string][]int, error) {
+	names := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(name)))
+		if _, ok := names[name]; !ok {
+			names[name] = i
+		}
+	}
+	columns := make(map[string][]int)
+	for field, candidates := range bitlyColumns {
+		for _, name := range candidates {
+			if i, ok := names[name]; ok {
+				columns[field] = append(columns[field], i)
+			}
+		}
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("bitly export has no long_url column")
+	}
+	return columns, nil
+}
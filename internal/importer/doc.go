@@ -0,0 +1,4 @@
+// Package importer - internal package, переносящий URL из экспортов других сервисов сокращения URL:
+// CSV экспорта Bitly, SQL дампа и JSON выгрузки YOURLS. Экспорты читаются потоком, запись за записью,
+// исходные идентификаторы сохраняются как заданные пользователем, вместе с датой создания и количеством переходов.
+package importer
@@ -0,0 +1,213 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// Поддерживаемые форматы экспорта.
+const (
+	FormatBitly      = "bitly"       // CSV экспорт Bitly.
+	FormatYOURLSSQL  = "yourls-sql"  // SQL дамп таблицы URL YOURLS.
+	FormatYOURLSJSON = "yourls-json" // JSON выгрузка YOURLS (ответ API stats или массив записей).
+)
+
+// Formats - список поддерживаемых форматов экспорта.
+var Formats = []string{FormatBitly, FormatYOURLSSQL, FormatYOURLSJSON}
+
+// ErrUnknownFormat - ошибка, показывающая, что формат экспорта не поддерживается.
+var ErrUnknownFormat error = repository.NewError(repository.KindInvalid,
+	"format must be one of "+strings.Join(Formats, ", "))
+
+// Link - URL из экспорта другого сервиса сокращения URL.
+type Link struct {
+	Code      string
+	URL       string
+	CreatedAt time.Time
+	Clicks    int
+	Tags      []string
+}
+
+// Reader - читает URL из экспорта по одному. По окончании экспорта возвращает io.EOF.
+// Ошибка записи возвращается как *RecordError и не мешает читать следующие записи.
+type Reader interface {
+	Read() (Link, error)
+}
+
+// RecordError - ошибка разбора записи экспорта.
+type RecordError struct {
+	Record int
+	Err    error
+}
+
+// Error - возвращает текст ошибки с номером записи.
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+// Unwrap - возвращает исходную ошибку.
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// CheckFormat - проверяет, что формат экспорта поддерживается.
+func CheckFormat(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return ErrUnknownFormat
+}
+
+// NewReader - возвращает Reader экспорта формата format, читающий из r.
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatBitly:
+		return newBitlyReader(r), nil
+	case FormatYOURLSSQL:
+		return newYOURLSSQLReader(r), nil
+	case FormatYOURLSJSON:
+		return newYOURLSJSONReader(r), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Result - результат импорта записи экспорта.
+type Result struct {
+	Record int    `json:"record"`
+	Code   string `json:"code,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Short  string `json:"short_url,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Summary - итог импорта.
+type Summary struct {
+	Imported int `json:"imported"`
+	Failed   int `json:"failed"`
+}
+
+// Importer - сохраняет URL из экспорта в хранилище сервиса от имени пользователя UserID.
+type Importer struct {
+	Storage repository.Storager
+	UserID  string
+	// Timeout - время на сохранение одного URL, если не задано - не ограничено.
+	Timeout time.Duration
+	// Short - формирует сокращенный URL по идентификатору, если не задана - возвращается идентификатор.
+	Short func(hash string) string
+}
+
+// Run - читает экспорт из src и сохраняет URL по одному, передавая результат каждой записи в report.
+// Ошибки записей учитываются в итоге и не прерывают импорт, его прерывают ошибка чтения экспорта,
+// ошибка report или отмена ctx.
+func (im Importer) Run(ctx context.Context, src Reader, report func(Result) error) (Summary, error) {
+	var summary Summary
+	for record := 1; ; record++ {
+		link, err := src.Read()
+		if errors.Is(err, io.EOF) {
+			return summary, nil
+		}
+		var recErr *RecordError
+		if err != nil && !errors.As(err, &recErr) {
+			return summary, err
+		}
+		result := Result{Record: record, Code: link.Code, URL: link.URL}
+		if err == nil {
+			result.Short, err = im.save(ctx, link)
+		}
+		if err != nil {
+			summary.Failed++
+			result.Error = err.Error()
+		} else {
+			summary.Imported++
+		}
+		if err = report(result); err != nil {
+			return summary, err
+		}
+		if err = ctx.Err(); err != nil {
+			return summary, err
+		}
+	}
+}
+
+// save - сохраняет URL в хранилище и возвращает сокращенный URL.
+func (im Importer) save(ctx context.Context, link Link) (string, error) {
+	ctx, cancel := repository.WithTimeout(ctx, im.Timeout)
+	defer cancel()
+	hash, err := im.Storage.ImportURL(ctx, repository.ImportedURL{
+		Code:        link.Code,
+		FURL:        link.URL,
+		UserID:      im.UserID,
+		CreatedAt:   link.CreatedAt,
+		Clicks:      link.Clicks,
+		LinkOptions: repository.LinkOptions{Tags: link.Tags},
+	})
+	if err != nil {
+		return "", err
+	}
+	if im.Short != nil {
+		return im.Short(hash), nil
+	}
+	return hash, nil
+}
+
+// timeLayouts - форматы дат в экспортах. Даты без часового пояса считаются датами UTC.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseTime - разбирает дату создания URL. Пустая строка означает, что дата неизвестна.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	// Unix время в секундах.
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseClicks - разбирает количество переходов. Пустая строка означает ноль переходов.
+func parseClicks(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	clicks, err := strconv.Atoi(s)
+	if err != nil || clicks < 0 {
+		return 0, fmt.Errorf("invalid clicks %q", s)
+	}
+	return clicks, nil
+}
+
+// codeOf - возвращает идентификатор из сокращенного URL (https://bit.ly/abc или bit.ly/abc) или сам идентификатор.
+func codeOf(short string) string {
+	short = strings.TrimSpace(short)
+	if !strings.Contains(short, "://") && strings.Contains(short, "/") {
+		short = "//" + short
+	}
+	if u, err := url.Parse(short); err == nil && u.Host != "" {
+		short = u.Path
+	}
+	return strings.Trim(short, "/")
+}
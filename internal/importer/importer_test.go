@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/repository"
+)
+
+// readAll - читает все URL экспорта, ошибки записей возвращаются вместе с URL.
+func readAll(t *testing.T, r Reader) ([]Link, []error) {
+	var links []Link
+	var errs []error
+	for {
+		link, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return links, errs
+		}
+		var recErr *RecordError
+		if err != nil && !errors.As(err, &recErr) {
+			require.NoError(t, err)
+		}
+		links = append(links, link)
+		errs = append(errs, err)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	_, err := NewReader("unknown", strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	assert.ErrorIs(t, CheckFormat("unknown"), ErrUnknownFormat)
+	for _, format := range Formats {
+		_, err = NewReader(format, strings.NewReader(""))
+		assert.NoError(t, err, format)
+		assert.NoError(t, CheckFormat(format), format)
+	}
+}
+
+func TestBitlyReader(t *testing.T) {
+	export := strings.Join([]string{
+		`Title,Long URL,Bitlink,Custom Bitlinks,Created,Clicks,Tags`,
+		`Docs,https://example.com/docs,bit.ly/3abcDEF,"bit.ly/docs, bit.ly/docs2",2021-03-04T05:06:07+0000,42,"go, docs"`,
+		`,https://example.com/x,https://bit.ly/3xyz,,2021-03-04 05:06:07,,`,
+		`,https://example.com/bad,bit.ly/bad,,yesterday,1,`,
+	}, "\n")
+	links, errs := readAll(t, newBitlyReader(strings.NewReader(export)))
+	require.Len(t, links, 3)
+	assert.Equal(t, Link{
+		Code:      "docs",
+		URL:       "https://example.com/docs",
+		CreatedAt: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Clicks:    42,
+		Tags:      []string{"go", "docs"},
+	}, links[0].utc())
+	assert.NoError(t, errs[0])
+	assert.Equal(t, Link{Code: "3xyz", URL: "https://example.com/x", CreatedAt: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)}, links[1])
+	assert.EqualError(t, errs[2], `record 3: invalid date "yesterday"`)
+
+	_, err := newBitlyReader(strings.NewReader("title,link\n")).Read()
+	assert.EqualError(t, err, "bitly export has no long_url column")
+}
+
+func TestYOURLSSQLReader(t *testing.T) {
+	dump := `-- MySQL dump
+/*!40101 SET NAMES utf8mb4 */;
+CREATE TABLE ` + "`yourls_url`" + ` (
+  ` + "`keyword`" + ` varchar(100) NOT NULL, -- "code"; with separator
+  PRIMARY KEY (` + "`keyword`" + `)
+);
+INSERT INTO ` + "`yourls_options`" + ` VALUES (1,'version','1.9');
+INSERT INTO ` + "`db`.`yourls_url`" + ` VALUES ('abc','https://example.com/a?x=1;y=2','It\'s ''quoted''','2020-01-02 03:04:05','127.0.0.1',5),
+('def','https://example.com/d',NULL,'2020-01-02 03:04:05','127.0.0.1',0);
+# comment
+INSERT IGNORE INTO yourls_url (url, keyword, clicks) VALUES ('https://example.com/g','ghi','7');
+INSERT INTO yourls_url (url, keyword) VALUES ('https://example.com/bad');
+`
+	links, errs := readAll(t, newYOURLSSQLReader(strings.NewReader(dump)))
+	require.Len(t, links, 4)
+	assert.Equal(t, Link{Code: "abc", URL: "https://example.com/a?x=1;y=2", CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Clicks: 5}, links[0])
+	assert.Equal(t, "def", links[1].Code)
+	assert.Equal(t, Link{Code: "ghi", URL: "https://example.com/g", Clicks: 7}, links[2])
+	assert.EqualError(t, errs[3], "record 4: 1 values for 2 columns")
+
+	_, err := newYOURLSSQLReader(strings.NewReader(`INSERT INTO yourls_url VALUES ('abc`)).Read()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestYOURLSJSONReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		export string
+	}{
+		{
+			name: "API stats",
+			export: `{"stats":{"total_links":"2"},"links":{
+				"link_1":{"shorturl":"https://sho.rt/abc","url":"https://example.com/a","timestamp":"2020-01-02 03:04:05","clicks":"5"},
+				"link_2":{"shorturl":"https://sho.rt/def","url":"https://example.com/d","timestamp":"2020-01-02 03:04:05","clicks":0}},
+				"statusCode":200}`,
+		},
+		{
+			name: "Array",
+			export: `[{"keyword":"abc","url":"https://example.com/a","timestamp":"2020-01-02 03:04:05","clicks":5},
+				{"keyword":"def","url":"https://example.com/d","timestamp":"2020-01-02 03:04:05","clicks":null}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, errs := readAll(t, newYOURLSJSONReader(strings.NewReader(tt.export)))
+			require.Len(t, links, 2)
+			assert.Equal(t, Link{Code: "abc", URL: "https://example.com/a", CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Clicks: 5}, links[0])
+			assert.Equal(t, "def", links[1].Code)
+			assert.Equal(t, []error{nil, nil}, errs)
+		})
+	}
+}
+
+func TestImporter_Run(t *testing.T) {
+	cnf := config.NewConfig()
+	storage := repository.NewStorage(cnf)
+	im := Importer{Storage: storage, UserID: "importer", Short: cnf.ExpShortURL}
+	export := "long_url,link,created_at,clicks\n" +
+		"https://example.com/a,bit.ly/abc,2020-01-02,5\n" +
+		"https://example.com/b,bit.ly/not valid,,\n" +
+		"https://example.com/c,bit.ly/abc,,\n" +
+		",bit.ly/empty,,\n"
+	var results []Result
+	summary, err := im.Run(context.Background(), newBitlyReader(strings.NewReader(export)), func(r Result) error {
+		results = append(results, r)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Imported: 2, Failed: 2}, summary)
+	require.Len(t, results, 4)
+	assert.Equal(t, Result{Record: 1, Code: "abc", URL: "https://example.com/a", Short: cnf.ExpShortURL("abc")}, results[0])
+	// Недопустимый идентификатор заменяется сгенерированным.
+	assert.NotEmpty(t, results[1].Short)
+	assert.Empty(t, results[1].Error)
+	assert.Equal(t, repository.ErrAliasExists.Error(), results[2].Error)
+	assert.Equal(t, repository.ErrEmptyInsert.Error(), results[3].Error)
+	link, err := storage.GetLink(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, 5, link.Clicks)
+	assert.Equal(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), link.CreatedAt)
+	assert.True(t, link.Alias)
+}
+
+// utc - возвращает URL с датой создания в UTC для сравнения.
+func (l Link) utc() Link {
+	l.CreatedAt = l.CreatedAt.UTC()
+	return l
+}
@@ -0,0 +1,512 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// yourlsColumns - колонки таблицы URL YOURLS в порядке по умолчанию, если в INSERT не указан их список.
+var yourlsColumns = []string{"keyword", "url", "title", "timestamp", "ip", "clicks"}
+
+// maxSQLToken - максимальная длина строки или идентификатора SQL дампа в байтах.
+const maxSQLToken = 1 << 20
+
+// yourlsLink - возвращает URL по значениям полей записи YOURLS.
+func yourlsLink(record int, fields map[string]string) (Link, error) {
+	link := Link{URL: fields["url"], Code: fields["keyword"]}
+	if link.Code == "" {
+		link.Code = codeOf(fields["shorturl"])
+	}
+	var err error
+	if link.CreatedAt, err = parseTime(fields["timestamp"]); err != nil {
+		return link, &RecordError{Record: record, Err: err}
+	}
+	if link.Clicks, err = parseClicks(fields["clicks"]); err != nil {
+		return link, &RecordError{Record: record, Err: err}
+	}
+	return link, nil
+}
+
+// yourlsSQLReader - Reader SQL дампа YOURLS (mysqldump). Читаются только INSERT в таблицу URL (yourls_url),
+// остальные выражения пропускаются.
+type yourlsSQLReader struct {
+	lexer   *sqlLexer
+	columns []string
+	insert  bool
+	record  int
+}
+
+// newYOURLSSQLReader - конструктор Reader SQL дампа YOURLS.
+func newYOURLSSQLReader(r io.Reader) *yourlsSQLReader {
+	return &yourlsSQLReader{lexer: &sqlLexer{in: bufio.NewReader(r)}}
+}
+
+// Read - возвращает следующий URL дампа.
+func (y *yourlsSQLReader) Read() (Link, error) {
+	for !y.insert {
+		if err := y.nextInsert(); err != nil {
+			return Link{}, err
+		}
+	}
+	values, err := y.tuple()
+	if err != nil {
+		return Link{}, err
+	}
+	y.record++
+	if len(values) != len(y.columns) {
+		return Link{}, &RecordError{Record: y.record,
+			Err: fmt.Errorf("%d values for %d columns", len(values), len(y.columns))}
+	}
+	fields := make(map[string]string, len(values))
+	for i, column := range y.columns {
+		fields[strings.ToLower(column)] = values[i]
+	}
+	return yourlsLink(y.record, fields)
+}
+
+// nextInsert - читает выражение дампа до списка значений INSERT в таблицу URL или пропускает его.
+func (y *yourlsSQLReader) nextInsert() error {
+	tok, err := y.lexer.next()
+	if err != nil {
+		return err
+	}
+	if !tok.is("INSERT") {
+		return y.skipStatement(tok)
+	}
+	for {
+		if tok, err = y.lexer.next(); err != nil {
+			return err
+		}
+		if tok.is("INTO") {
+			break
+		}
+		if !tok.is("IGNORE") && !tok.is("LOW_PRIORITY") && !tok.is("DELAYED") && !tok.is("HIGH_PRIORITY") {
+			return y.skipStatement(tok)
+		}
+	}
+	// Имя таблицы может быть указано вместе с базой данных: `db`.`yourls_url`.
+	var table string
+	for {
+		if tok, err = y.lexer.next(); err != nil {
+			return err
+		}
+		if tok.kind != tokWord && tok.kind != tokIdent {
+			return y.skipStatement(tok)
+		}
+		table = tok.text
+		if tok, err = y.lexer.next(); err != nil {
+			return err
+		}
+		if !tok.isPunct('.') {
+			break
+		}
+	}
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		table = table[i+1:]
+	}
+	if table = strings.ToLower(table); table != "url" && !strings.HasSuffix(table, "_url") {
+		return y.skipStatement(tok)
+	}
+	y.columns = yourlsColumns
+	if tok.isPunct('(') {
+		if y.columns, err = y.list(); err != nil {
+			return err
+		}
+		if tok, err = y.lexer.next(); err != nil {
+			return err
+		}
+	}
+	if !tok.is("VALUES") && !tok.is("VALUE") {
+		return y.skipStatement(tok)
+	}
+	y.insert = true
+	return nil
+}
+
+// tuple - читает очередной кортеж значений INSERT и разделитель после него.
+func (y *yourlsSQLReader) tuple() ([]string, error) {
+	tok, err := y.lexer.next()
+	if err != nil {
+		return nil, err
+	}
+	if !tok.isPunct('(') {
+		return nil, fmt.Errorf("sql: unexpected %q in VALUES", tok.text)
+	}
+	values, err := y.list()
+	if err != nil {
+		return nil, err
+	}
+	tok, err = y.lexer.next()
+	switch {
+	case errors.Is(err, io.EOF):
+		y.insert = false
+	case err != nil:
+		return nil, err
+	case tok.isPunct(','):
+	case tok.isPunct(';'):
+		y.insert = false
+	default:
+		// Например, ON DUPLICATE KEY UPDATE.
+		y.insert = false
+		if err = y.skipStatement(tok); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// list - читает список значений или имен колонок до закрывающей скобки. NULL считается пустым значением.
+func (y *yourlsSQLReader) list() ([]string, error) {
+	var values []string
+	for {
+		tok, err := y.lexer.next()
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tok.isPunct(')') && len(values) == 0:
+			return values, nil
+		case tok.is("NULL"):
+			values = append(values, "")
+		case tok.kind == tokWord || tok.kind == tokIdent || tok.kind == tokString:
+			values = append(values, tok.text)
+		default:
+			return nil, fmt.Errorf("sql: unexpected %q in list", tok.text)
+		}
+		if tok, err = y.lexer.next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if tok.isPunct(')') {
+			return values, nil
+		}
+		if !tok.isPunct(',') {
+			return nil, fmt.Errorf("sql: unexpected %q in list", tok.text)
+		}
+	}
+}
+
+// skipStatement - пропускает выражение дампа до точки с запятой, начиная с уже прочитанного tok.
+func (y *yourlsSQLReader) skipStatement(tok sqlToken) error {
+	for !tok.isPunct(';') {
+		var err error
+		if tok, err = y.lexer.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Виды лексем SQL дампа.
+const (
+	tokWord   = iota // ключевое слово, имя или число.
+	tokIdent         // имя в обратных кавычках.
+	tokString        // строка в одинарных или двойных кавычках.
+	tokPunct         // знак пунктуации.
+)
+
+// sqlToken - лексема SQL дампа.
+type sqlToken struct {
+	kind int
+	text string
+}
+
+// is - сообщает, что лексема - ключевое слово word.
+func (t sqlToken) is(word string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+// isPunct - сообщает, что лексема - знак пунктуации p.
+func (t sqlToken) isPunct(p byte) bool {
+	return t.kind == tokPunct && len(t.text) == 1 && t.text[0] == p
+}
+
+// sqlLexer - разбивает SQL дамп MySQL на лексемы, пропуская комментарии.
+type sqlLexer struct {
+	in *bufio.Reader
+}
+
+// next - возвращает следующую лексему или io.EOF.
+func (l *sqlLexer) next() (sqlToken, error) {
+	for {
+		r, _, err := l.in.ReadRune()
+		if err != nil {
+			return sqlToken{}, err
+		}
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case r == '#':
+			if err = l.skipLine(); err != nil {
+				return sqlToken{}, err
+			}
+			continue
+		case r == '-' && l.peek("- ") || r == '-' && l.peek("-\n"):
+			if err = l.skipLine(); err != nil {
+				return sqlToken{}, err
+			}
+			continue
+		case r == '/' && l.peek("*"):
+			if err = l.skipComment(); err != nil {
+				return sqlToken{}, err
+			}
+			continue
+		case r == '\'' || r == '"':
+			text, err := l.quoted(byte(r), true)
+			return sqlToken{kind: tokString, text: text}, err
+		case r == '`':
+			text, err := l.quoted('`', false)
+			return sqlToken{kind: tokIdent, text: text}, err
+		case isWordRune(r) && r != '.' || r == '-' && l.peekDigit():
+			text, err := l.word(r)
+			return sqlToken{kind: tokWord, text: text}, err
+		}
+		return sqlToken{kind: tokPunct, text: string(r)}, nil
+	}
+}
+
+// peek - сообщает, что следующие байты дампа - prefix, не читая их.
+func (l *sqlLexer) peek(prefix string) bool {
+	b, _ := l.in.Peek(len(prefix))
+	return string(b) == prefix
+}
+
+// peekDigit - сообщает, что следующий байт дампа - цифра.
+func (l *sqlLexer) peekDigit() bool {
+	b, _ := l.in.Peek(1)
+	return len(b) == 1 && b[0] >= '0' && b[0] <= '9'
+}
+
+// skipLine - пропускает однострочный комментарий.
+func (l *sqlLexer) skipLine() error {
+	_, err := l.in.ReadString('\n')
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// skipComment - пропускает многострочный комментарий, в том числе /*!40101 ... */.
+func (l *sqlLexer) skipComment() error {
+	if _, err := l.in.ReadByte(); err != nil {
+		return err
+	}
+	for {
+		if _, err := l.in.ReadString('*'); err != nil {
+			return unexpectedEOF(err)
+		}
+		if l.peek("/") {
+			_, err := l.in.ReadByte()
+			return err
+		}
+	}
+}
+
+// quoted - читает строку до закрывающей кавычки quote. Удвоенная кавычка означает саму кавычку,
+// в строках так же поддерживаются экранирующие последовательности MySQL.
+func (l *sqlLexer) quoted(quote byte, escapes bool) (string, error) {
+	var buf bytes.Buffer
+	for {
+		if buf.Len() > maxSQLToken {
+			return "", fmt.Errorf("sql: token is longer than %d bytes", maxSQLToken)
+		}
+		c, err := l.in.ReadByte()
+		if err != nil {
+			return "", unexpectedEOF(err)
+		}
+		switch {
+		case c == quote && l.peek(string(quote)):
+			l.in.ReadByte()
+			buf.WriteByte(quote)
+		case c == quote:
+			return buf.String(), nil
+		case c == '\\' && escapes:
+			if c, err = l.in.ReadByte(); err != nil {
+				return "", unexpectedEOF(err)
+			}
+			buf.WriteByte(unescape(c))
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+// word - читает ключевое слово, имя или число, начинающееся с first.
+func (l *sqlLexer) word(first rune) (string, error) {
+	var buf strings.Builder
+	buf.WriteRune(first)
+	for {
+		r, _, err := l.in.ReadRune()
+		if errors.Is(err, io.EOF) {
+			return buf.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !isWordRune(r) {
+			return buf.String(), l.in.UnreadRune()
+		}
+		buf.WriteRune(r)
+	}
+}
+
+// isWordRune - сообщает, что символ может входить в ключевое слово, имя или число.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$' || r == '.'
+}
+
+// unescape - возвращает символ экранирующей последовательности MySQL \c.
+func unescape(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'Z':
+		return 0x1a
+	}
+	return c
+}
+
+// unexpectedEOF - заменяет io.EOF внутри лексемы на io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// yourlsJSONReader - Reader JSON выгрузки YOURLS: ответа API stats {"links":{"link_1":{...}}}
+// (links может быть и массивом) или массива записей [{...}].
+type yourlsJSONReader struct {
+	dec    *json.Decoder
+	start  bool
+	done   bool
+	keyed  bool
+	record int
+}
+
+// yourlsRecord - запись URL выгрузки YOURLS. Числа в выгрузке могут быть строками.
+type yourlsRecord struct {
+	Keyword   jsonText `json:"keyword"`
+	ShortURL  jsonText `json:"shorturl"`
+	URL       jsonText `json:"url"`
+	Timestamp jsonText `json:"timestamp"`
+	Clicks    jsonText `json:"clicks"`
+}
+
+// newYOURLSJSONReader - конструктор Reader JSON выгрузки YOURLS.
+func newYOURLSJSONReader(r io.Reader) *yourlsJSONReader {
+	return &yourlsJSONReader{dec: json.NewDecoder(r)}
+}
+
+// Read - возвращает следующий URL выгрузки.
+func (y *yourlsJSONReader) Read() (Link, error) {
+	if !y.start {
+		y.start = true
+		if err := y.open(); err != nil {
+			return Link{}, err
+		}
+	}
+	if y.done || !y.dec.More() {
+		y.done = true
+		return Link{}, io.EOF
+	}
+	// В ответе API stats записи - значения объекта с ключами link_1, link_2 и т.д.
+	if y.keyed {
+		if _, err := y.dec.Token(); err != nil {
+			return Link{}, err
+		}
+	}
+	var record yourlsRecord
+	if err := y.dec.Decode(&record); err != nil {
+		return Link{}, err
+	}
+	y.record++
+	return yourlsLink(y.record, map[string]string{
+		"keyword":   string(record.Keyword),
+		"shorturl":  string(record.ShortURL),
+		"url":       string(record.URL),
+		"timestamp": string(record.Timestamp),
+		"clicks":    string(record.Clicks),
+	})
+}
+
+// open - находит в выгрузке начало списка записей.
+func (y *yourlsJSONReader) open() error {
+	tok, err := y.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('['):
+		return nil
+	case json.Delim('{'):
+	default:
+		return errors.New("yourls export must be a JSON object or array")
+	}
+	for y.dec.More() {
+		key, err := y.dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "links" {
+			var skip json.RawMessage
+			if err = y.dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if tok, err = y.dec.Token(); err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('['):
+			return nil
+		case json.Delim('{'):
+			y.keyed = true
+			return nil
+		}
+		return errors.New("yourls export links must be a JSON object or array")
+	}
+	y.done = true
+	return nil
+}
+
+// jsonText - значение JSON, которое может быть строкой, числом или null.
+type jsonText string
+
+// UnmarshalJSON - сохраняет строку, текст числа или пустую строку для null.
+func (t *jsonText) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*t = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*t = jsonText(s)
+		return nil
+	}
+	*t = jsonText(data)
+	return nil
+}
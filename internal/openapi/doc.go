@@ -0,0 +1,4 @@
+// Package openapi - internal package, содержащий описание REST API сервиса в формате OpenAPI 3.
+// Описание встраивается в бинарный файл и выдается клиентам, по нему же проверяются параметры и тела запросов.
+// Проверка схем поддерживает подмножество JSON Schema, используемое в описании сервиса.
+package openapi
@@ -0,0 +1,130 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// spec - описание API в формате OpenAPI 3.
+//
+//go:embed openapi.json
+var spec []byte
+
+// Spec - возвращает описание API в формате JSON.
+func Spec() []byte {
+	return spec
+}
+
+// Document - описание API.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Components - переиспользуемые части описания API.
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+}
+
+// PathItem - операции одного пути API.
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Head       *Operation   `json:"head"`
+	Post       *Operation   `json:"post"`
+	Put        *Operation   `json:"put"`
+	Patch      *Operation   `json:"patch"`
+	Delete     *Operation   `json:"delete"`
+}
+
+// Operation - операция API.
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+// Parameter - параметр операции в пути, запросе или заголовке.
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody - тело запроса операции по типам содержимого.
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// MediaType - схема тела запроса одного типа содержимого.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Load - разбирает встроенное описание API.
+func Load() (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Operation - возвращает операцию метода method пути path или nil, если она не описана.
+func (d *Document) Operation(method string, path string) *Operation {
+	item, ok := d.Paths[path]
+	if !ok {
+		return nil
+	}
+	return item.operations()[method]
+}
+
+// Operations - возвращает отсортированный список описанных операций в виде "<метод> <путь>".
+func (d *Document) Operations() []string {
+	result := make([]string, 0)
+	for path, item := range d.Paths {
+		for method := range item.operations() {
+			result = append(result, method+" "+path)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// operations - возвращает описанные операции пути по HTTP методам.
+func (p *PathItem) operations() map[string]*Operation {
+	result := make(map[string]*Operation)
+	for method, op := range map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodHead:   p.Head,
+		http.MethodPost:   p.Post,
+		http.MethodPut:    p.Put,
+		http.MethodPatch:  p.Patch,
+		http.MethodDelete: p.Delete,
+	} {
+		if op != nil {
+			result[method] = op
+		}
+	}
+	return result
+}
+
+// PathFromRoute - преобразует шаблон маршрута chi в путь OpenAPI: шаблон "/{hash}/*" соответствует пути
+// "/{hash}/{path}", где параметр path может содержать символ "/".
+func PathFromRoute(route string) string {
+	if route != "/" {
+		route = strings.TrimSuffix(route, "/")
+	}
+	if strings.HasSuffix(route, "/*") {
+		return strings.TrimSuffix(route, "*") + "{path}"
+	}
+	return route
+}
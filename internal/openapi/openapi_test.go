@@ -0,0 +1,169 @@
+package openapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	doc, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	// Идентификаторы операций уникальны, а ссылки на схемы и параметры разрешаются.
+	v := &Validator{doc: doc}
+	ids := make(map[string]bool)
+	for _, item := range doc.Paths {
+		for _, op := range item.operations() {
+			require.NotEmpty(t, op.OperationID)
+			assert.False(t, ids[op.OperationID], op.OperationID)
+			ids[op.OperationID] = true
+			for _, p := range append(append([]*Parameter(nil), item.Parameters...), op.Parameters...) {
+				if p.Ref != "" {
+					assert.NotNil(t, doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")], p.Ref)
+				}
+			}
+		}
+	}
+	for name, schema := range doc.Components.Schemas {
+		for property, s := range schema.Properties {
+			if s.Ref != "" {
+				assert.NotEqual(t, &Schema{}, v.resolve(s), name+"."+property)
+			}
+		}
+	}
+}
+
+func TestValidator_Validate(t *testing.T) {
+	v, err := NewValidator()
+	require.NoError(t, err)
+	params := map[string]string{"hash": "abc", "path": "docs/start"}
+	param := func(name string) string {
+		return params[name]
+	}
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantErr     string
+	}{
+		{
+			name:        "Valid JSON",
+			method:      http.MethodPost,
+			path:        "/api/shorten",
+			contentType: "application/json",
+			body:        `{"url":"http://test.test","redirect_code":308,"rules":[{"device":"ios","url":"http://test.test/ios"}]}`,
+		},
+		{
+			name:        "Missing property",
+			method:      http.MethodPost,
+			path:        "/api/shorten",
+			contentType: "application/json",
+			body:        `{"redirect_code":308}`,
+			wantErr:     "body: property url is required",
+		},
+		{
+			name:        "Wrong type",
+			method:      http.MethodPost,
+			path:        "/api/shorten",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"url":1}`,
+			wantErr:     "body.url: expected string",
+		},
+		{
+			name:        "Not allowed value",
+			method:      http.MethodPost,
+			path:        "/api/shorten",
+			contentType: "application/json",
+			body:        `{"url":"http://test.test","redirect_code":200}`,
+			wantErr:     "body.redirect_code: value is not one of allowed values",
+		},
+		{
+			name:        "Nested array item",
+			method:      http.MethodPost,
+			path:        "/api/shorten/batch",
+			contentType: "application/json",
+			body:        `[{"correlation_id":"1","original_url":"http://test.test"},{"correlation_id":"2"}]`,
+			wantErr:     "body[1]: property original_url is required",
+		},
+		{
+			name:        "Date-time",
+			method:      http.MethodPost,
+			path:        "/api/shorten",
+			contentType: "application/json",
+			body:        `{"url":"http://test.test","not_after":"tomorrow"}`,
+			wantErr:     "body.not_after: expected RFC 3339 date-time",
+		},
+		{
+			name:        "Unsupported media type",
+			method:      http.MethodPost,
+			path:        "/api/shorten",
+			contentType: "text/plain",
+			body:        `http://test.test`,
+			wantErr:     "unsupported media type: text/plain",
+		},
+		{
+			name:        "Empty text",
+			method:      http.MethodPost,
+			path:        "/",
+			contentType: "text/plain",
+			wantErr:     "body: expected at least 1 characters",
+		},
+		{
+			name:        "Form without password",
+			method:      http.MethodPost,
+			path:        "/{hash}/unlock",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `path=docs`,
+			wantErr:     "body: property password is required",
+		},
+		{
+			name:   "Wildcard path",
+			method: http.MethodGet,
+			path:   "/{hash}/{path}",
+		},
+		{
+			name:    "Not described operation",
+			method:  http.MethodPatch,
+			path:    "/api/shorten",
+			wantErr: "operation PATCH /api/shorten is not described",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			err := v.Validate(r, tt.path, param)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+	t.Run("Body is kept for handler", func(t *testing.T) {
+		body := `{"url":"http://test.test"}`
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		require.NoError(t, v.Validate(r, "/api/shorten", param))
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, body, string(data))
+	})
+}
+
+func TestPathFromRoute(t *testing.T) {
+	assert.Equal(t, "/", PathFromRoute("/"))
+	assert.Equal(t, "/api/shorten", PathFromRoute("/api/shorten/"))
+	assert.Equal(t, "/{hash}/{path}", PathFromRoute("/{hash}/*"))
+}
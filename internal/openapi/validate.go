@@ -0,0 +1,307 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedMediaType - ошибка, показывающая, что тип содержимого запроса не описан для операции.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Schema - схема значения (подмножество JSON Schema, используемое в описании API).
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Enum       []interface{}      `json:"enum"`
+	Properties map[string]*Schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *Schema            `json:"items"`
+	Minimum    *float64           `json:"minimum"`
+	Maximum    *float64           `json:"maximum"`
+	MinLength  *int               `json:"minLength"`
+	MaxLength  *int               `json:"maxLength"`
+	MinItems   *int               `json:"minItems"`
+	MaxItems   *int               `json:"maxItems"`
+}
+
+// Validator - проверяет запросы по описанию API.
+type Validator struct {
+	doc *Document
+}
+
+// NewValidator - конструктор Validator по встроенному описанию API.
+func NewValidator() (*Validator, error) {
+	doc, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{doc: doc}, nil
+}
+
+// Validate - проверяет запрос r к пути path описания API: обязательные параметры, их схемы и тело запроса.
+// Значения параметров пути возвращает функция param. Тело запроса в формате JSON или текста читается целиком
+// и заменяется копией, чтобы его мог прочитать обработчик.
+func (v *Validator) Validate(r *http.Request, path string, param func(name string) string) error {
+	item, ok := v.doc.Paths[path]
+	if !ok {
+		return fmt.Errorf("path %s is not described", path)
+	}
+	op := item.operations()[r.Method]
+	if op == nil {
+		return fmt.Errorf("operation %s %s is not described", r.Method, path)
+	}
+	for _, p := range append(append([]*Parameter(nil), item.Parameters...), op.Parameters...) {
+		if err := v.validateParameter(r, p, param); err != nil {
+			return err
+		}
+	}
+	if op.RequestBody == nil {
+		return nil
+	}
+	return v.validateBody(r, op.RequestBody)
+}
+
+// validateParameter - проверяет параметр запроса.
+func (v *Validator) validateParameter(r *http.Request, p *Parameter, param func(name string) string) error {
+	if p.Ref != "" {
+		p = v.doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+		if p == nil {
+			return fmt.Errorf("unknown parameter reference")
+		}
+	}
+	var value string
+	switch p.In {
+	case "path":
+		value = param(p.Name)
+	case "query":
+		value = r.URL.Query().Get(p.Name)
+	case "header":
+		value = r.Header.Get(p.Name)
+	}
+	if value == "" {
+		if p.Required {
+			return fmt.Errorf("%s parameter %s is required", p.In, p.Name)
+		}
+		return nil
+	}
+	if p.Schema == nil {
+		return nil
+	}
+	var decoded interface{} = value
+	if schema := v.resolve(p.Schema); schema.Type == "integer" || schema.Type == "number" {
+		decoded = json.Number(value)
+	}
+	return v.validate(p.Schema, decoded, p.In+" parameter "+p.Name)
+}
+
+// validateBody - проверяет тело запроса.
+func (v *Validator) validateBody(r *http.Request, body *RequestBody) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		if body.Required {
+			return fmt.Errorf("%w: missing Content-Type", ErrUnsupportedMediaType)
+		}
+		return nil
+	}
+	content, ok := body.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+	if content.Schema == nil {
+		return nil
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		data, err := v.readBody(r)
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			if body.Required {
+				return errors.New("request body is required")
+			}
+			return nil
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var value interface{}
+		if err = decoder.Decode(&value); err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+		return v.validate(content.Schema, value, "body")
+	case strings.HasPrefix(mediaType, "text/"):
+		data, err := v.readBody(r)
+		if err != nil {
+			return err
+		}
+		return v.validate(content.Schema, string(data), "body")
+	case mediaType == "application/x-www-form-urlencoded":
+		if err = r.ParseForm(); err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+		return v.validate(content.Schema, formValue(r.PostForm), "body")
+	}
+	// Тела остальных типов (например, потоковые) не проверяются, чтобы не читать их целиком.
+	return nil
+}
+
+// readBody - читает тело запроса и заменяет его копией.
+func (v *Validator) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// formValue - преобразует поля формы в объект для проверки по схеме, используется первое значение поля.
+func formValue(form url.Values) map[string]interface{} {
+	result := make(map[string]interface{}, len(form))
+	for key, values := range form {
+		if len(values) > 0 {
+			result[key] = values[0]
+		}
+	}
+	return result
+}
+
+// resolve - возвращает схему, на которую ссылается schema, или саму schema.
+func (v *Validator) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = v.doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	if schema == nil {
+		return &Schema{}
+	}
+	return schema
+}
+
+// validate - проверяет значение value по схеме schema, at - положение значения в запросе для текста ошибки.
+func (v *Validator) validate(schema *Schema, value interface{}, at string) error {
+	schema = v.resolve(schema)
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		return fmt.Errorf("%s: value is not one of allowed values", at)
+	}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object", at)
+		}
+		for _, name := range schema.Required {
+			if _, ok = object[name]; !ok {
+				return fmt.Errorf("%s: property %s is required", at, name)
+			}
+		}
+		for name, property := range schema.Properties {
+			if field, ok := object[name]; ok && field != nil {
+				if err := v.validate(property, field, at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array", at)
+		}
+		if schema.MinItems != nil && len(array) < *schema.MinItems {
+			return fmt.Errorf("%s: expected at least %d items", at, *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(array) > *schema.MaxItems {
+			return fmt.Errorf("%s: expected at most %d items", at, *schema.MaxItems)
+		}
+		for i, item := range array {
+			if err := v.validate(schema.Items, item, at+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", at)
+		}
+		return validateString(schema, s, at)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected %s", at, schema.Type)
+		}
+		return validateNumber(schema, n, at)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", at)
+		}
+	}
+	return nil
+}
+
+// validateString - проверяет длину и формат строки.
+func validateString(schema *Schema, s string, at string) error {
+	length := len([]rune(s))
+	if schema.MinLength != nil && length < *schema.MinLength {
+		return fmt.Errorf("%s: expected at least %d characters", at, *schema.MinLength)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		return fmt.Errorf("%s: expected at most %d characters", at, *schema.MaxLength)
+	}
+	if schema.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return fmt.Errorf("%s: expected RFC 3339 date-time", at)
+		}
+	}
+	return nil
+}
+
+// validateNumber - проверяет тип и границы числа.
+func validateNumber(schema *Schema, n json.Number, at string) error {
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("%s: expected %s", at, schema.Type)
+	}
+	if schema.Type == "integer" {
+		if _, err = n.Int64(); err != nil {
+			return fmt.Errorf("%s: expected integer", at)
+		}
+	}
+	if schema.Minimum != nil && f < *schema.Minimum {
+		return fmt.Errorf("%s: expected at least %v", at, *schema.Minimum)
+	}
+	if schema.Maximum != nil && f > *schema.Maximum {
+		return fmt.Errorf("%s: expected at most %v", at, *schema.Maximum)
+	}
+	return nil
+}
+
+// inEnum - сообщает, входит ли значение в список допустимых значений. Числа сравниваются по значению.
+func inEnum(enum []interface{}, value interface{}) bool {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return false
+		}
+		value = f
+	}
+	for _, allowed := range enum {
+		if reflect.DeepEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,4 @@
+// Package quota - internal package, отвечающий за квоты пользователей на создание сокращенных URL.
+// Квоты задаются в конфигурации для каждого уровня (анонимный пользователь с cookie или токеном, API ключ)
+// и ограничивают количество созданных URL за сутки (UTC) и всего. Счетчики хранятся в памяти процесса.
+package quota
@@ -0,0 +1,189 @@
+package quota
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+)
+
+// Уровни пользователей, для каждого из которых задаются свои квоты.
+const (
+	TierAnonymous = "anonymous" // пользователь, идентифицируемый cookie (в gRPC - токеном).
+	TierAPIKey    = "api_key"   // клиент, передающий разрешенный API ключ.
+)
+
+// ErrDailyQuotaExceeded - ошибка, показывающая, что суточная квота на создание URL исчерпана.
+var ErrDailyQuotaExceeded = errors.New("daily quota exceeded")
+
+// ErrTotalQuotaExceeded - ошибка, показывающая, что общая квота на создание URL исчерпана.
+var ErrTotalQuotaExceeded = errors.New("total quota exceeded")
+
+// Identity - пользователь, на которого расходуется квота.
+type Identity struct {
+	Tier string
+	ID   string
+}
+
+// Limits - квоты уровня пользователей, 0 - без ограничения.
+type Limits struct {
+	Daily int
+	Total int
+}
+
+// Allowance - использование квоты и ее остаток.
+type Allowance struct {
+	Limit     int        `json:"limit"`
+	Used      int        `json:"used"`
+	Remaining int        `json:"remaining"`
+	Unlimited bool       `json:"unlimited,omitempty"`
+	Reset     *time.Time `json:"reset,omitempty"`
+}
+
+// Usage - использование квот пользователя.
+type Usage struct {
+	Tier  string    `json:"tier"`
+	Daily Allowance `json:"daily"`
+	Total Allowance `json:"total"`
+}
+
+// Quota - учет квот пользователей на создание URL. Счетчики, в том числе общей квоты, хранятся в памяти процесса:
+// они сбрасываются при перезапуске и не разделяются между экземплярами сервиса.
+type Quota struct {
+	limits   map[string]Limits
+	counters map[Identity]*counter
+	// day - сутки (UTC), в которые счетчики прошлых суток последний раз очищались.
+	day string
+	sync.Mutex
+}
+
+// counter - счетчики созданных пользователем URL.
+type counter struct {
+	day   string
+	daily int
+	total int
+}
+
+// New - конструктор учета квот с квотами уровней из конфигурации.
+func New(c *config.Config) *Quota {
+	return &Quota{
+		limits: map[string]Limits{
+			TierAnonymous: {Daily: c.QuotaAnonymousDaily, Total: c.QuotaAnonymousTotal},
+			TierAPIKey:    {Daily: c.QuotaAPIKeyDaily, Total: c.QuotaAPIKeyTotal},
+		},
+		counters: make(map[Identity]*counter),
+	}
+}
+
+// Reserve - расходует квоту пользователя на создание n URL. Если квоты не хватает, то ничего не расходует
+// и возвращает ErrDailyQuotaExceeded или ErrTotalQuotaExceeded.
+func (q *Quota) Reserve(id Identity, n int) error {
+	return q.reserve(id, n, time.Now())
+}
+
+// reserve - реализация Reserve для момента времени now.
+func (q *Quota) reserve(id Identity, n int, now time.Time) error {
+	q.Lock()
+	defer q.Unlock()
+	limits := q.limits[id.Tier]
+	c := q.counter(id, now)
+	if limits.Total > 0 && c.total+n > limits.Total {
+		return ErrTotalQuotaExceeded
+	}
+	if limits.Daily > 0 && c.daily+n > limits.Daily {
+		return ErrDailyQuotaExceeded
+	}
+	c.daily += n
+	c.total += n
+	return nil
+}
+
+// Release - возвращает пользователю квоту на n URL, которые не были созданы (например, URL уже был сохранен ранее).
+func (q *Quota) Release(id Identity, n int) {
+	q.Lock()
+	defer q.Unlock()
+	c := q.counter(id, time.Now())
+	c.daily -= n
+	if c.daily < 0 {
+		c.daily = 0
+	}
+	c.total -= n
+	if c.total < 0 {
+		c.total = 0
+	}
+}
+
+// Usage - возвращает использование квот пользователя.
+func (q *Quota) Usage(id Identity) Usage {
+	q.Lock()
+	defer q.Unlock()
+	limits := q.limits[id.Tier]
+	now := time.Now()
+	// Запрос использования не создает счетчиков, иначе запросы с новыми идентификаторами занимали бы память.
+	var daily, total int
+	if c, ok := q.counters[id]; ok {
+		if c.day == day(now) {
+			daily = c.daily
+		}
+		total = c.total
+	}
+	reset := NextReset(now)
+	return Usage{
+		Tier:  id.Tier,
+		Daily: allowance(limits.Daily, daily, &reset),
+		Total: allowance(limits.Total, total, nil),
+	}
+}
+
+// NextReset - возвращает время ближайшего после now сброса суточных квот (полночь UTC).
+func NextReset(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+}
+
+// counter - возвращает счетчики пользователя, сбрасывая суточный счетчик в начале новых суток.
+func (q *Quota) counter(id Identity, now time.Time) *counter {
+	today := day(now)
+	if q.day != today {
+		q.sweep(today)
+	}
+	c, ok := q.counters[id]
+	if !ok {
+		c = &counter{day: today}
+		q.counters[id] = c
+	}
+	if c.day != today {
+		c.day = today
+		c.daily = 0
+	}
+	return c
+}
+
+// sweep - удаляет счетчики прошлых суток, которые больше не нужны: без общей квоты уровня пользователя
+// или без созданных URL. Счетчики с общей квотой сохраняются, иначе общая квота сбрасывалась бы каждые сутки.
+func (q *Quota) sweep(day string) {
+	q.day = day
+	for id, c := range q.counters {
+		if c.day != day && (q.limits[id.Tier].Total <= 0 || c.total == 0) {
+			delete(q.counters, id)
+		}
+	}
+}
+
+// day - возвращает сутки (UTC) момента времени now.
+func day(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+// allowance - формирует использование квоты limit при использованных used.
+func allowance(limit int, used int, reset *time.Time) Allowance {
+	if limit <= 0 {
+		return Allowance{Used: used, Unlimited: true, Reset: reset}
+	}
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Allowance{Limit: limit, Used: used, Remaining: remaining, Reset: reset}
+}
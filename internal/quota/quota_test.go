@@ -0,0 +1,85 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+)
+
+func TestQuota_Reserve(t *testing.T) {
+	c := *config.NewConfig()
+	c.QuotaAnonymousDaily, c.QuotaAnonymousTotal = 3, 5
+	c.QuotaAPIKeyDaily, c.QuotaAPIKeyTotal = 0, 0
+	q := New(&c)
+	user := Identity{Tier: TierAnonymous, ID: "user"}
+	day := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	t.Run("Daily limit", func(t *testing.T) {
+		require.NoError(t, q.reserve(user, 2, day))
+		assert.ErrorIs(t, q.reserve(user, 2, day), ErrDailyQuotaExceeded)
+		require.NoError(t, q.reserve(user, 1, day))
+		assert.ErrorIs(t, q.reserve(user, 1, day), ErrDailyQuotaExceeded)
+		// Другой пользователь расходует свою квоту.
+		require.NoError(t, q.reserve(Identity{Tier: TierAnonymous, ID: "another"}, 3, day))
+	})
+	t.Run("Total limit on the next day", func(t *testing.T) {
+		next := day.Add(24 * time.Hour)
+		require.NoError(t, q.reserve(user, 2, next))
+		assert.ErrorIs(t, q.reserve(user, 1, next), ErrTotalQuotaExceeded)
+		q.Release(user, 1)
+		q.Lock()
+		assert.Equal(t, 4, q.counters[user].total)
+		q.Unlock()
+	})
+	t.Run("Unlimited tier", func(t *testing.T) {
+		key := Identity{Tier: TierAPIKey, ID: "key"}
+		require.NoError(t, q.reserve(key, 1000, day))
+		usage := q.Usage(key)
+		assert.True(t, usage.Daily.Unlimited)
+		assert.True(t, usage.Total.Unlimited)
+	})
+}
+
+func TestQuota_Usage(t *testing.T) {
+	q := New(config.NewConfig())
+	user := Identity{Tier: TierAnonymous, ID: "user"}
+	require.NoError(t, q.Reserve(user, 3))
+	usage := q.Usage(user)
+	assert.Equal(t, TierAnonymous, usage.Tier)
+	assert.Equal(t, Allowance{Limit: config.QuotaAnonymousTotal, Used: 3, Remaining: config.QuotaAnonymousTotal - 3}, usage.Total)
+	assert.Equal(t, config.QuotaAnonymousDaily-3, usage.Daily.Remaining)
+	require.NotNil(t, usage.Daily.Reset)
+	assert.Equal(t, NextReset(time.Now()), *usage.Daily.Reset)
+}
+
+func TestQuota_Sweep(t *testing.T) {
+	c := *config.NewConfig()
+	c.QuotaAnonymousTotal, c.QuotaAPIKeyTotal = 5, 0
+	q := New(&c)
+	day := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	user := Identity{Tier: TierAnonymous, ID: "user"}
+	empty := Identity{Tier: TierAnonymous, ID: "empty"}
+	key := Identity{Tier: TierAPIKey, ID: "key"}
+	require.NoError(t, q.reserve(user, 2, day))
+	require.NoError(t, q.reserve(empty, 0, day))
+	require.NoError(t, q.reserve(key, 1, day))
+	// Запрос использования не создает счетчик.
+	q.Usage(Identity{Tier: TierAnonymous, ID: "unknown"})
+	q.Lock()
+	assert.Len(t, q.counters, 3)
+	q.Unlock()
+	// В новые сутки остается только счетчик, нужный для общей квоты.
+	require.NoError(t, q.reserve(Identity{Tier: TierAnonymous, ID: "another"}, 1, day.Add(24*time.Hour)))
+	q.Lock()
+	defer q.Unlock()
+	assert.Len(t, q.counters, 2)
+	assert.Equal(t, 2, q.counters[user].total)
+}
+
+func TestNextReset(t *testing.T) {
+	now := time.Date(2026, 10, 19, 23, 59, 0, 0, time.FixedZone("MSK", 3*60*60))
+	assert.Equal(t, time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC), NextReset(now))
+}
@@ -0,0 +1,4 @@
+// Package ratelimit - internal package, отвечающий за ограничение частоты запросов к сервису.
+// Описан интерфейс Limiter и его реализация по умолчанию - алгоритм token bucket,
+// хранящий корзины токенов в памяти процесса, разделенной на независимо блокируемые шарды.
+package ratelimit
@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+)
+
+// Limiter - интерфейс ограничителя частоты запросов.
+type Limiter interface {
+	// Allow - расходует один токен ключа key. Если токенов нет, возвращает false и время до появления токена.
+	Allow(key string) (bool, time.Duration)
+}
+
+// Budget - бюджет запросов: Rate токенов в секунду пополняют корзину емкостью Burst токенов.
+type Budget struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled - сообщает, задано ли ограничение.
+func (b Budget) Enabled() bool {
+	return b.Rate > 0 && b.Burst > 0
+}
+
+// TokenBucket - реализация Limiter по алгоритму token bucket, хранящая корзины ключей в памяти процесса.
+// Корзины распределены по шардам по хэшу ключа, чтобы запросы разных ключей не конкурировали за одну блокировку.
+type TokenBucket struct {
+	budget Budget
+	shards []*shard
+}
+
+// shard - часть корзин ограничителя со своей блокировкой.
+type shard struct {
+	buckets   map[string]*bucket
+	nextSweep time.Time
+	sync.Mutex
+}
+
+// bucket - корзина токенов ключа.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket - конструктор ограничителя с бюджетом budget и количеством шардов shards.
+// Если бюджет не задан, то ограничитель пропускает все запросы.
+func NewTokenBucket(budget Budget, shards int) *TokenBucket {
+	if shards <= 0 {
+		shards = 1
+	}
+	l := &TokenBucket{
+		budget: budget,
+		shards: make([]*shard, shards),
+	}
+	for i := range l.shards {
+		l.shards[i] = &shard{buckets: make(map[string]*bucket)}
+	}
+	return l
+}
+
+// Allow - расходует один токен ключа key. Если токенов нет, возвращает false и время до появления токена.
+func (l *TokenBucket) Allow(key string) (bool, time.Duration) {
+	return l.allow(key, time.Now())
+}
+
+// allow - реализация Allow для момента времени now.
+func (l *TokenBucket) allow(key string, now time.Time) (bool, time.Duration) {
+	if !l.budget.Enabled() {
+		return true, 0
+	}
+	s := l.shard(key)
+	s.Lock()
+	defer s.Unlock()
+	if now.After(s.nextSweep) {
+		s.sweep(now, l.budget)
+		s.nextSweep = now.Add(l.fill())
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.budget.Burst), last: now}
+		s.buckets[key] = b
+	}
+	b.refill(now, l.budget)
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.budget.Rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// shard - возвращает шард, в котором хранится корзина ключа.
+func (l *TokenBucket) shard(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return l.shards[h.Sum32()%uint32(len(l.shards))]
+}
+
+// fill - время полного пополнения корзины.
+func (l *TokenBucket) fill() time.Duration {
+	return time.Duration(float64(l.budget.Burst) / l.budget.Rate * float64(time.Second))
+}
+
+// refill - пополняет корзину токенами за время, прошедшее с прошлого обращения.
+func (b *bucket) refill(now time.Time, budget Budget) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * budget.Rate
+		if b.tokens > float64(budget.Burst) {
+			b.tokens = float64(budget.Burst)
+		}
+		b.last = now
+	}
+}
+
+// sweep - удаляет полностью пополнившиеся корзины, чтобы хранилище не росло бесконечно.
+func (s *shard) sweep(now time.Time, budget Budget) {
+	for k, b := range s.buckets {
+		b.refill(now, budget)
+		if b.tokens >= float64(budget.Burst) {
+			delete(s.buckets, k)
+		}
+	}
+}
+
+// Группы запросов, для каждой из которых задается свой бюджет.
+const (
+	Create   = "create"   // создание сокращенных URL.
+	Redirect = "redirect" // переходы по сокращенным URL.
+	Admin    = "admin"    // управление URL пользователя и служебные запросы.
+)
+
+// Способы определения ключа, по которому учитываются запросы клиента.
+const (
+	KeyIP     = "ip"      // IP адрес клиента.
+	KeyUser   = "user"    // идентификатор пользователя, без него - IP адрес.
+	KeyAPIKey = "api_key" // API ключ клиента, без него - IP адрес.
+)
+
+// APIKeyHeader - заголовок (в gRPC - ключ метаданных), в котором клиент передает API ключ.
+const APIKeyHeader = "X-Api-Key"
+
+// Limiters - ограничители частоты запросов по группам запросов.
+type Limiters map[string]Limiter
+
+// NewLimiters - создает ограничители групп запросов с бюджетами из конфигурации.
+func NewLimiters(c *config.Config) Limiters {
+	return Limiters{
+		Create:   NewTokenBucket(Budget{Rate: c.RateLimitCreate, Burst: c.RateLimitCreateBurst}, c.RateLimitShards),
+		Redirect: NewTokenBucket(Budget{Rate: c.RateLimitRedirect, Burst: c.RateLimitRedirectBurst}, c.RateLimitShards),
+		Admin:    NewTokenBucket(Budget{Rate: c.RateLimitAdmin, Burst: c.RateLimitAdminBurst}, c.RateLimitShards),
+	}
+}
+
+// Allow - расходует токен ключа key в группе group. Запросы групп без ограничителя пропускаются.
+func (l Limiters) Allow(group string, key string) (bool, time.Duration) {
+	limiter, ok := l[group]
+	if !ok {
+		return true, 0
+	}
+	return limiter.Allow(group + "|" + key)
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+)
+
+func TestTokenBucket_Allow(t *testing.T) {
+	t.Run("Burst and refill", func(t *testing.T) {
+		l := NewTokenBucket(Budget{Rate: 2, Burst: 3}, 4)
+		now := time.Now()
+		for i := 0; i < 3; i++ {
+			ok, _ := l.allow("client", now)
+			assert.True(t, ok)
+		}
+		ok, wait := l.allow("client", now)
+		assert.False(t, ok)
+		assert.Equal(t, 500*time.Millisecond, wait)
+		ok, _ = l.allow("another", now)
+		assert.True(t, ok)
+		ok, _ = l.allow("client", now.Add(500*time.Millisecond))
+		assert.True(t, ok)
+		ok, _ = l.allow("client", now.Add(500*time.Millisecond))
+		assert.False(t, ok)
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		l := NewTokenBucket(Budget{}, 4)
+		for i := 0; i < 100; i++ {
+			ok, _ := l.Allow("client")
+			assert.True(t, ok)
+		}
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		l := NewTokenBucket(Budget{Rate: 0.001, Burst: 10}, 8)
+		var wg sync.WaitGroup
+		var allowed int32
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if ok, _ := l.Allow("client" + strconv.Itoa(i%2)); ok {
+					atomic.AddInt32(&allowed, 1)
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.Equal(t, int32(20), allowed)
+	})
+	t.Run("Sweep", func(t *testing.T) {
+		l := NewTokenBucket(Budget{Rate: 10, Burst: 1}, 1)
+		now := time.Now()
+		l.allow("client", now)
+		l.allow("another", now.Add(time.Second))
+		assert.Len(t, l.shards[0].buckets, 1)
+	})
+}
+
+func TestLimiters_Allow(t *testing.T) {
+	l := NewLimiters(config.NewConfig())
+	for i := 0; i < config.RateLimitAdminBurst; i++ {
+		ok, _ := l.Allow(Admin, "client")
+		assert.True(t, ok)
+	}
+	ok, wait := l.Allow(Admin, "client")
+	assert.False(t, ok)
+	assert.Greater(t, wait, time.Duration(0))
+	ok, _ = l.Allow(Create, "client")
+	assert.True(t, ok)
+	ok, _ = l.Allow("unknown", "client")
+	assert.True(t, ok)
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"regexp"
+	"time"
+)
+
+// aliasPattern - допустимый формат идентификатора сокращенного URL, заданного пользователем.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// reservedAliases - идентификаторы, совпадающие с путями эндпоинтов сервиса.
+var reservedAliases = map[string]bool{
+	"api":  true,
+	"ping": true,
+	"ui":   true,
+}
+
+// ErrInvalidAlias - ошибка, показывающая, что идентификатор сокращенного URL задан неверно.
+var ErrInvalidAlias error = NewError(KindInvalid, "alias must be 1-64 latin letters, digits, '-' or '_'")
+
+// ErrAliasExists - ошибка, показывающая, что идентификатор сокращенного URL уже занят.
+var ErrAliasExists error = NewError(KindConflict, "alias is already taken")
+
+// ValidateAlias - проверяет, что идентификатор сокращенного URL, заданный пользователем, допустим.
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) || reservedAliases[alias] {
+		return ErrInvalidAlias
+	}
+	return nil
+}
+
+// hash - проверяет импортируемый URL и возвращает его идентификатор: исходный, если он допустим, иначе сгенерированный.
+// Если дата создания неизвестна, то ею считается текущее время.
+func (l *ImportedURL) hash() (string, error) {
+	if err := l.Validate(); err != nil {
+		return "", err
+	}
+	if l.FURL == "" || l.UserID == "" {
+		return "", ErrEmptyInsert
+	}
+	if l.Clicks < 0 {
+		l.Clicks = 0
+	}
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+	if ValidateAlias(l.Code) == nil {
+		return l.Code, nil
+	}
+	return newHash(l.FURL, l.UserID, LinkOptions{})
+}
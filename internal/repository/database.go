@@ -2,27 +2,34 @@ package repository
 
 import (
 	"context"
-	"crypto/md5"
 	"database/sql"
-	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib"
 
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
 )
 
+// uniqueViolation - код ошибки PostgreSQL о нарушении ограничения уникальности.
+const uniqueViolation = "23505"
+
 // Database - структура базы данных SQL.
 type Database struct {
 	DB *sql.DB
+	notifier
 	sync.Mutex
 }
 
 // NewDatabaseDSN - конструктор базы данных на основе SQL, возвращает интерфейс.
-func NewDatabaseDSN(conf *config.Config) (Storager, error) {
+func NewDatabaseDSN(conf *config.Config, options ...Option) (Storager, error) {
 	s := &Database{}
+	for _, opt := range options {
+		opt(&s.notifier)
+	}
 	err := s.Connect(conf)
 	if err != nil {
 		return nil, err
@@ -35,17 +42,64 @@ func NewDatabaseDSN(conf *config.Config) (Storager, error) {
 	return s, nil
 }
 
+// sharedCondition - условие SQL для URL, которые выдаются всем пользователям, сокращающим тот же адрес
+// (см. LinkOptions.Shared).
+const sharedCondition = `NOT private AND NOT alias AND password_hash = '' AND max_clicks = 0
+	AND not_before IS NULL AND not_after IS NULL AND fallback_url = ''`
+
 // Bootstrap - метод, создающий рабочую таблицу в БД.
 func (d *Database) Bootstrap() (err error) {
 	//Подготавливаем SQL запрос на создание таблицы, если ее нет.
 	// Выполняем SQL запрос.
 	_, err = d.DB.Exec(`CREATE TABLE IF NOT EXISTS shortener (hashid TEXT UNIQUE PRIMARY KEY NOT NULL,
-													url TEXT UNIQUE NOT NULL,
+													url TEXT NOT NULL,
 													userid TEXT NOT NULL,
 													is_deleted BOOLEAN NOT NULL)`)
 	if err != nil {
 		return err
 	}
+	// Добавляем колонки настроек сокращенного URL в ранее созданную таблицу. Время создания записей,
+	// сохраненных до появления колонки created_at, неизвестно и остается пустым.
+	_, err = d.DB.Exec(`ALTER TABLE shortener ADD COLUMN IF NOT EXISTS redirect_code INTEGER NOT NULL DEFAULT 0,
+													ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '',
+													ADD COLUMN IF NOT EXISTS max_clicks INTEGER NOT NULL DEFAULT 0,
+													ADD COLUMN IF NOT EXISTS clicks INTEGER NOT NULL DEFAULT 0,
+													ADD COLUMN IF NOT EXISTS not_before TIMESTAMPTZ,
+													ADD COLUMN IF NOT EXISTS not_after TIMESTAMPTZ,
+													ADD COLUMN IF NOT EXISTS fallback_url TEXT NOT NULL DEFAULT '',
+													ADD COLUMN IF NOT EXISTS rules JSONB NOT NULL DEFAULT '[]',
+													ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '[]',
+													ADD COLUMN IF NOT EXISTS passthrough BOOLEAN NOT NULL DEFAULT false,
+													ADD COLUMN IF NOT EXISTS utm JSONB,
+													ADD COLUMN IF NOT EXISTS query_conflict TEXT NOT NULL DEFAULT '',
+													ADD COLUMN IF NOT EXISTS wildcard BOOLEAN NOT NULL DEFAULT false,
+													ADD COLUMN IF NOT EXISTS private BOOLEAN NOT NULL DEFAULT false,
+													ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]',
+													ADD COLUMN IF NOT EXISTS alias BOOLEAN NOT NULL DEFAULT false,
+													ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ,
+													ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ`)
+	if err != nil {
+		return err
+	}
+	// Уникальным должен быть только общий URL: приватные URL, URL с заданным пользователем идентификатором
+	// и URL с настройками (см. LinkOptions.Shared) с тем же адресом сохраняются отдельно. Ограничение уникальности
+	// адреса из таблиц, созданных прежними версиями, заменяется частичным индексом.
+	_, err = d.DB.Exec(`ALTER TABLE shortener DROP CONSTRAINT IF EXISTS shortener_url_key`)
+	if err != nil {
+		return err
+	}
+	_, err = d.DB.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS shortener_shared_url_idx ON shortener (url) WHERE ` + sharedCondition)
+	if err != nil {
+		return err
+	}
+	// Создаем таблицу счетчиков переходов по вариантам URL.
+	_, err = d.DB.Exec(`CREATE TABLE IF NOT EXISTS shortener_variants (hashid TEXT NOT NULL,
+													variant TEXT NOT NULL,
+													clicks INTEGER NOT NULL DEFAULT 0,
+													PRIMARY KEY (hashid, variant))`)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -86,7 +140,7 @@ func (d *Database) GetCountURL(ctx context.Context) (int, error) {
 func (d *Database) GetShortURL(ctx context.Context, fullURL string) (string, error) {
 	var hash string
 	// Готовим SQL запрос и выполняем.
-	err := d.DB.QueryRowContext(ctx, `SELECT hashid FROM shortener WHERE url = $1 AND is_deleted = false`, fullURL).Scan(&hash)
+	err := d.DB.QueryRowContext(ctx, `SELECT hashid FROM shortener WHERE url = $1 AND is_deleted = false AND `+sharedCondition, fullURL).Scan(&hash)
 	if err != nil {
 		return "", err
 	}
@@ -112,26 +166,263 @@ func (d *Database) GetFullURL(ctx context.Context, hash string) (string, error)
 	return fullURL, nil
 }
 
-// InsertURL - метод, который сохраняет original_url,user_id и hash в базу данных.
-func (d *Database) saveData(ctx context.Context, fullURL string, userid string, hash string) error {
+// linkColumns - колонки таблицы, из которых собирается запись сокращенного URL.
+// У записей, созданных до появления колонки updated_at, временем изменения считается время создания,
+// а у записей, созданных до появления колонки created_at, оба времени пустые.
+const linkColumns = `url, userid, is_deleted, clicks,
+	redirect_code, password_hash, max_clicks, not_before, not_after, fallback_url, rules, variants,
+	passthrough, utm, query_conflict, wildcard, private, tags, alias, created_at, COALESCE(updated_at, created_at)`
+
+// scanLink - сканирует строку с колонками linkColumns в запись сокращенного URL.
+// Значения колонок, выбранных после linkColumns, сканируются в extra.
+func scanLink(row interface{ Scan(dest ...any) error }, extra ...any) (URL, error) {
+	var link URL
+	var notBefore, notAfter, createdAt, updatedAt sql.NullTime
+	var rules, variants, utm, tags []byte
+	dest := []any{&link.FURL, &link.UserID, &link.Delete, &link.Clicks,
+		&link.RedirectCode, &link.PasswordHash, &link.MaxClicks, &notBefore, &notAfter, &link.FallbackURL, &rules, &variants,
+		&link.Passthrough, &utm, &link.QueryConflict, &link.Wildcard, &link.Private, &tags, &link.Alias, &createdAt,
+		&updatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return URL{}, err
+	}
+	link.CreatedAt, link.UpdatedAt = createdAt.Time, updatedAt.Time
+	if err = json.Unmarshal(rules, &link.Rules); err != nil {
+		return URL{}, err
+	}
+	if err = json.Unmarshal(variants, &link.Variants); err != nil {
+		return URL{}, err
+	}
+	if err = json.Unmarshal(tags, &link.Tags); err != nil {
+		return URL{}, err
+	}
+	if len(utm) > 0 {
+		if err = json.Unmarshal(utm, &link.UTM); err != nil {
+			return URL{}, err
+		}
+	}
+	if notBefore.Valid {
+		link.NotBefore = &notBefore.Time
+	}
+	if notAfter.Valid {
+		link.NotAfter = &notAfter.Time
+	}
+	return link, nil
+}
+
+// jsonArray - сериализует срез в JSON массив для хранения в колонке JSONB, пустой срез - в "[]".
+func jsonArray[T any](v []T) (string, error) {
+	if len(v) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// GetLink - метод, возвращающий сохраненную запись сокращенного URL вместе с ее настройками.
+func (d *Database) GetLink(ctx context.Context, hash string) (URL, error) {
+	// Готовим SQL запрос и выполняем.
+	link, err := scanLink(d.DB.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM shortener WHERE hashid = $1`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return URL{}, ErrNotFoundURL
+	}
+	if err != nil {
+		return URL{}, err
+	}
+	if link.Delete {
+		return URL{}, ErrDeletedURL
+	}
+	if link.Exhausted() {
+		return URL{}, ErrExhaustedURL
+	}
+	return link, nil
+}
+
+// Click - метод, учитывающий переход по сокращенному URL и, если задан, по его варианту.
+// Проверка лимита переходов и увеличение счетчика выполняются атомарно одним запросом UPDATE ... RETURNING.
+func (d *Database) Click(ctx context.Context, hash string, variant string) error {
+	// Объявляем начало транзакции.
+	tr, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tr.Rollback()
+	var clicks, maxClicks int
+	var userID string
+	err = tr.QueryRowContext(ctx, `UPDATE shortener SET clicks = clicks + 1
+		WHERE hashid = $1 AND is_deleted = false AND (max_clicks = 0 OR clicks < max_clicks)
+		RETURNING clicks, max_clicks, userid`, hash).Scan(&clicks, &maxClicks, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Строка не обновлена: определяем причину - URL отсутствует, удален или лимит исчерпан.
+		if _, err = d.GetLink(ctx, hash); err != nil {
+			return err
+		}
+		return ErrExhaustedURL
+	}
+	if err != nil {
+		return err
+	}
+	// Учитываем переход по варианту URL.
+	if variant != "" {
+		_, err = tr.ExecContext(ctx, `INSERT INTO shortener_variants (hashid, variant, clicks) VALUES ($1, $2, 1)
+			ON CONFLICT (hashid, variant) DO UPDATE SET clicks = shortener_variants.clicks + 1`, hash, variant)
+		if err != nil {
+			return err
+		}
+	}
+	if err = tr.Commit(); err != nil {
+		return err
+	}
+	d.clicked(hash, userID, variant, clicks, maxClicks)
+	return nil
+}
+
+// SetVariants - метод, заменяющий варианты URL для A/B тестирования. Изменить варианты может только владелец URL.
+func (d *Database) SetVariants(ctx context.Context, hash string, userID string, variants []Variant) error {
+	if err := validateVariants(variants); err != nil {
+		return err
+	}
+	data, err := jsonArray(variants)
+	if err != nil {
+		return err
+	}
+	res, err := d.DB.ExecContext(ctx, `UPDATE shortener SET variants = $1, updated_at = now()
+		WHERE hashid = $2 AND userid = $3 AND is_deleted = false`, data, hash, userID)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		// Строка не обновлена: определяем причину - URL отсутствует или принадлежит другому пользователю.
+		var owner string
+		err = d.DB.QueryRowContext(ctx, `SELECT userid FROM shortener WHERE hashid = $1 AND is_deleted = false`, hash).
+			Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFoundURL
+		}
+		if err != nil {
+			return err
+		}
+		return ErrNotOwnerURL
+	}
+	return nil
+}
+
+// GetLinkStats - метод, возвращающий статистику переходов по URL и его вариантам. Доступен только владельцу URL.
+func (d *Database) GetLinkStats(ctx context.Context, hash string, userID string) (LinkStats, error) {
+	link, err := scanLink(d.DB.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM shortener
+		WHERE hashid = $1 AND is_deleted = false`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return LinkStats{}, ErrNotFoundURL
+	}
+	if err != nil {
+		return LinkStats{}, err
+	}
+	if link.UserID != userID {
+		return LinkStats{}, ErrNotOwnerURL
+	}
+	rows, err := d.DB.QueryContext(ctx, `SELECT variant, clicks FROM shortener_variants WHERE hashid = $1`, hash)
+	if err != nil {
+		return LinkStats{}, err
+	}
+	defer rows.Close()
+	variantClicks := make(map[string]int)
+	for rows.Next() {
+		var variant string
+		var clicks int
+		if err = rows.Scan(&variant, &clicks); err != nil {
+			return LinkStats{}, err
+		}
+		variantClicks[variant] = clicks
+	}
+	if err = rows.Err(); err != nil {
+		return LinkStats{}, err
+	}
+	return link.stats(variantClicks), nil
+}
+
+// saveData - метод, который сохраняет original_url,user_id,hash и настройки в базу данных.
+func (d *Database) saveData(ctx context.Context, fullURL string, userid string, hash string, opts LinkOptions) error {
 	// Проверяем полученные данные.
 	if fullURL == "" || fullURL == " " || userid == "" || userid == " " || hash == "" || hash == " " {
-		return errors.New("ErrNoEmptyInsert")
+		return ErrEmptyInsert
+	}
+	return d.create(ctx, hash, URL{
+		UserID:      userid,
+		FURL:        fullURL,
+		CreatedAt:   time.Now(),
+		LinkOptions: opts,
+	})
+}
+
+// create - метод, который сохраняет новый сокращенный URL и публикует событие его создания.
+func (d *Database) create(ctx context.Context, hash string, link URL) error {
+	if err := d.insert(ctx, hash, link); err != nil {
+		return err
+	}
+	d.created(hash, link)
+	return nil
+}
+
+// insert - метод, который сохраняет запись сокращенного URL в базу данных.
+func (d *Database) insert(ctx context.Context, hash string, link URL) error {
+	opts := link.LinkOptions
+	// Новая запись считается измененной в момент создания.
+	if link.UpdatedAt.IsZero() {
+		link.UpdatedAt = link.CreatedAt
+	}
+	// Правила перенаправления, варианты URL и метки храним в JSON.
+	rules, err := jsonArray(opts.Rules)
+	if err != nil {
+		return err
+	}
+	variants, err := jsonArray(opts.Variants)
+	if err != nil {
+		return err
+	}
+	tags, err := jsonArray(opts.Tags)
+	if err != nil {
+		return err
+	}
+	// Шаблон UTM меток храним в JSON, если он не задан - NULL.
+	var utm sql.NullString
+	if opts.UTM != nil {
+		data, err := json.Marshal(opts.UTM)
+		if err != nil {
+			return err
+		}
+		utm = sql.NullString{String: string(data), Valid: true}
 	}
 	// Объявляем начало транзакции.
-	tr, err := d.DB.Begin()
+	tr, err := d.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tr.Rollback()
 	// Подготавливаем стейтмент для БД.
-	st, err := tr.Prepare(`INSERT INTO shortener(hashid,url,userid,is_deleted)VALUES ($1,$2,$3,false)`)
+	st, err := tr.PrepareContext(ctx, `INSERT INTO shortener(hashid,url,userid,is_deleted,clicks,created_at,updated_at,
+									redirect_code,password_hash,max_clicks,not_before,not_after,fallback_url,rules,variants,
+									passthrough,utm,query_conflict,wildcard,private,tags,alias)
+									VALUES ($1,$2,$3,false,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21)`)
 	if err != nil {
 		return err
 	}
 	defer st.Close()
 	// Выполняем стейтмент.
-	_, err = st.ExecContext(ctx, hash, fullURL, userid)
+	_, err = st.ExecContext(ctx, hash, link.FURL, link.UserID, link.Clicks, link.CreatedAt, link.UpdatedAt,
+		opts.RedirectCode, opts.PasswordHash, opts.MaxClicks, opts.NotBefore, opts.NotAfter, opts.FallbackURL, rules, variants,
+		opts.Passthrough, utm, opts.QueryConflict, opts.Wildcard, opts.Private, tags, opts.Alias)
+	// Идентификатор URL, который не выдается при сокращении того же адреса, может быть занят только другим URL.
+	if isUniqueViolation(err) && !opts.Shared() {
+		return ErrAliasExists
+	}
 	if err != nil {
 		return err
 	}
@@ -145,22 +436,69 @@ func (d *Database) saveData(ctx context.Context, fullURL string, userid string,
 
 // InsertURL - метод ,который генерирует hash для ключа,передает hash+url+userid хранилищу,возвращает сокращенный url.
 func (d *Database) InsertURL(ctx context.Context, fullURL string, userID string) (string, error) {
-	// Генерируем hash.
-	hasher := md5.Sum([]byte(fullURL + userID))
-	hash := hex.EncodeToString(hasher[:len(hasher)/5])
-	// Проверяем есть ли в хранилище такой url.
-	okHash, err := d.GetShortURL(ctx, fullURL)
-	// Если нет, то вставляем новые данные.
-	if err != nil {
-		err = d.saveData(ctx, fullURL, userID, hash)
-		if err != nil {
-			return "", err
+	return d.InsertLink(ctx, fullURL, userID, LinkOptions{})
+}
+
+// InsertLink - метод, аналогичный InsertURL, но сохраняющий вместе с URL его дополнительные настройки.
+func (d *Database) InsertLink(ctx context.Context, fullURL string, userID string, opts LinkOptions) (string, error) {
+	// Проверяем настройки.
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	// Публичный URL, который уже есть в хранилище, возвращаем вместе с ошибкой. Остальные URL (см. LinkOptions.Shared)
+	// сохраняем отдельно, не выдавая чужие идентификаторы и не теряя настройки.
+	if opts.Shared() {
+		if okHash, err := d.GetShortURL(ctx, fullURL); err == nil {
+			return okHash, ErrConflictInsert
 		}
-		// Возвращаем сгенерированный hash.
-		return hash, nil
 	}
-	// Если есть, возвращаем hash и ошибку.
-	return okHash, ErrConflictInsert
+	// Генерируем hash и сохраняем данные.
+	return insertHash(fullURL, userID, opts, func(hash string) error {
+		return d.saveData(ctx, fullURL, userID, hash, opts)
+	})
+}
+
+// InsertAlias - метод, сохраняющий URL с идентификатором alias, заданным пользователем.
+// Возвращает ErrAliasExists, если идентификатор уже занят, в том числе удаленным URL.
+func (d *Database) InsertAlias(ctx context.Context, alias string, fullURL string, userID string, opts LinkOptions) error {
+	// Проверяем идентификатор и настройки.
+	if err := ValidateAlias(alias); err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	// Занятость идентификатора проверяет первичный ключ таблицы.
+	opts.Alias = true
+	return d.saveData(ctx, fullURL, userID, alias, opts)
+}
+
+// ImportURL - метод, сохраняющий URL из другого сервиса сокращения URL, возвращает его идентификатор.
+// Исходный идентификатор сохраняется, если он допустим, иначе генерируется новый. Занятый идентификатор
+// не заменяется, а возвращается ErrAliasExists, поэтому повторный импорт не создает копий URL.
+func (d *Database) ImportURL(ctx context.Context, link ImportedURL) (string, error) {
+	hash, err := link.hash()
+	if err != nil {
+		return "", err
+	}
+	link.LinkOptions.Alias = true
+	err = d.create(ctx, hash, URL{
+		UserID:      link.UserID,
+		FURL:        link.FURL,
+		Clicks:      link.Clicks,
+		CreatedAt:   link.CreatedAt,
+		LinkOptions: link.LinkOptions,
+	})
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// isUniqueViolation - сообщает, что запрос нарушил ограничение уникальности таблицы.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
 }
 
 // GetAllUserURLs - метод возвращающий массив со всеми original_url+hash сохраненными пользователем.
@@ -168,9 +506,11 @@ func (d *Database) GetAllUserURLs(ctx context.Context, userid string) ([]SlicedU
 	// Объявляем переменные и массив с результатом.
 	var hash string
 	var url string
+	var tags []byte
+	var alias bool
 	result := make([]SlicedURL, 0)
 	// Подготавливаем/выполняем запрос базе данных.
-	rows, err := d.DB.QueryContext(ctx, `SELECT hashid , url FROM shortener WHERE userid = $1 AND is_deleted = false`, userid)
+	rows, err := d.DB.QueryContext(ctx, `SELECT hashid , url, tags, alias FROM shortener WHERE userid = $1 AND is_deleted = false`, userid)
 	// Проверяем обе ошибки.
 	if err != nil || rows.Err() != nil {
 		return nil, err
@@ -179,24 +519,116 @@ func (d *Database) GetAllUserURLs(ctx context.Context, userid string) ([]SlicedU
 	// Итерируемся внутри полученного курсора.
 	for rows.Next() {
 		// Сканируем строку в переменные.
-		err = rows.Scan(&hash, &url)
+		err = rows.Scan(&hash, &url, &tags, &alias)
 		if err != nil {
 			return nil, err
 		}
 		// Заполняем массив с результатом.
-		result = append(result, SlicedURL{
+		link := SlicedURL{
 			Short: hash,
 			Full:  url,
-		})
+			Alias: alias,
+		}
+		if err = json.Unmarshal(tags, &link.Tags); err != nil {
+			return nil, err
+		}
+		result = append(result, link)
+	}
+	return result, nil
+}
+
+// GetUserLinks - метод, возвращающий все записи URL пользователя, упорядоченные по времени создания.
+// Удаленные URL возвращаются, если задан deleted. Если URL нет, то возвращается пустой массив.
+func (d *Database) GetUserLinks(ctx context.Context, userID string, deleted bool) ([]NodeURL, error) {
+	return d.queryNodes(ctx, `SELECT `+linkColumns+`, hashid FROM shortener
+		WHERE userid = $1 AND ($2 OR is_deleted = false) ORDER BY created_at NULLS FIRST, hashid`, userID, deleted)
+}
+
+// queryNodes - выполняет запрос с колонками linkColumns и hashid и возвращает записи URL.
+func (d *Database) queryNodes(ctx context.Context, query string, args ...any) ([]NodeURL, error) {
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]NodeURL, 0)
+	for rows.Next() {
+		var hash string
+		link, err := scanLink(rows, &hash)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *link.node(hash))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
 	return result, nil
 }
 
+// GetUserLink - метод, возвращающий запись URL, в том числе удаленного. Доступен только владельцу URL.
+func (d *Database) GetUserLink(ctx context.Context, hash string, userID string) (NodeURL, error) {
+	link, err := scanLink(d.DB.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM shortener WHERE hashid = $1`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return NodeURL{}, ErrNotFoundURL
+	}
+	if err != nil {
+		return NodeURL{}, err
+	}
+	if link.UserID != userID {
+		return NodeURL{}, ErrNotOwnerURL
+	}
+	return *link.node(hash), nil
+}
+
+// UpdateLink - метод, изменяющий адрес, метки и срок действия URL, возвращает измененную запись.
+// Изменить URL может только его владелец, удаленный URL не изменяется. Запись блокируется до конца транзакции.
+func (d *Database) UpdateLink(ctx context.Context, hash string, userID string, update LinkUpdate) (NodeURL, error) {
+	// Объявляем начало транзакции.
+	tr, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return NodeURL{}, err
+	}
+	defer tr.Rollback()
+	link, err := scanLink(tr.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM shortener WHERE hashid = $1 FOR UPDATE`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return NodeURL{}, ErrNotFoundURL
+	}
+	if err != nil {
+		return NodeURL{}, err
+	}
+	if link.UserID != userID {
+		return NodeURL{}, ErrNotOwnerURL
+	}
+	if link.Delete {
+		return NodeURL{}, ErrDeletedURL
+	}
+	if err = update.apply(&link, time.Now()); err != nil {
+		return NodeURL{}, err
+	}
+	tags, err := jsonArray(link.Tags)
+	if err != nil {
+		return NodeURL{}, err
+	}
+	_, err = tr.ExecContext(ctx, `UPDATE shortener SET url = $1, tags = $2, not_after = $3, updated_at = $4 WHERE hashid = $5`,
+		link.FURL, tags, link.NotAfter, link.UpdatedAt, hash)
+	if err != nil {
+		return NodeURL{}, err
+	}
+	if err = tr.Commit(); err != nil {
+		return NodeURL{}, err
+	}
+	return *link.node(hash), nil
+}
+
+// ExpiredLinks - метод, возвращающий неудаленные URL, срок действия которых закончился после from и не позже to.
+func (d *Database) ExpiredLinks(ctx context.Context, from time.Time, to time.Time) ([]NodeURL, error) {
+	return d.queryNodes(ctx, `SELECT `+linkColumns+`, hashid FROM shortener
+		WHERE is_deleted = false AND not_after > $1 AND not_after <= $2`, from, to)
+}
+
 // Ping - возвращает ответ от БД Ping.
 func (d *Database) Ping(ctx context.Context) error {
-	// Задаем контекст на основе переданного из запроса.
-	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
-	defer cancel()
 	return d.DB.PingContext(ctx)
 }
 
@@ -204,27 +636,38 @@ func (d *Database) Ping(ctx context.Context) error {
 func (d *Database) Delete(ctx context.Context, hashes []string, userID string) error {
 	d.Lock()
 	defer d.Unlock()
-	// Инициализируем контекст с таймаутом.
-	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
-	defer cancel()
 	// Объявляем начало транзакции.
-	tr, err := d.DB.Begin()
+	tr, err := d.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tr.Rollback()
-	// Подготавливаем стейтмент для БД.
-	st, err := tr.Prepare(`update shortener set is_deleted=true WHERE hashid = any ($1) and userid = $2`)
+	// Выполняем запрос, получая идентификаторы удаленных URL.
+	rows, err := tr.QueryContext(ctx, `update shortener set is_deleted=true, updated_at=now()
+		WHERE hashid = any ($1) and userid = $2 and is_deleted = false RETURNING hashid`, hashes, userID)
 	if err != nil {
 		return err
 	}
-	defer st.Close()
-	// Выполняем транзакцию.
-	if _, err = st.ExecContext(ctx, hashes, userID); err != nil {
+	defer rows.Close()
+	deleted := make([]string, 0, len(hashes))
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			return err
+		}
+		deleted = append(deleted, hash)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	// Подтверждаем транзакцию и публикуем события удаления.
+	if err = tr.Commit(); err != nil {
 		return err
 	}
-	// Возвращаем результат транзакции.
-	return tr.Commit()
+	for _, hash := range deleted {
+		d.deleted(hash, userID)
+	}
+	return nil
 }
 
 // clearTable - хелпер-метод, очищающий поля таблицы.
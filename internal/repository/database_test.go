@@ -61,11 +61,11 @@ func TestDatabase_InsertURL(t *testing.T) {
 			assert.NoError(t, err)
 			_ = db.clearTable()
 			if !tt.wantErr {
-				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash)
+				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash, LinkOptions{})
 				require.NoError(t, err)
 			}
 			if tt.wantErr {
-				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash)
+				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash, LinkOptions{})
 				require.ErrorContains(t, err, "ErrNoEmptyInsert")
 			}
 		})
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+)
+
+// Kind - вид ошибки сервиса, по которому транспорт (HTTP, gRPC) выбирает код ответа.
+type Kind int
+
+// Виды ошибок сервиса.
+const (
+	KindInternal    Kind = iota // внутренняя ошибка сервиса.
+	KindNotFound                // запрашиваемый объект не найден.
+	KindGone                    // объект больше не доступен: удален, истек срок действия или исчерпан лимит.
+	KindConflict                // объект уже существует.
+	KindInvalid                 // запрос или настройки заданы неверно.
+	KindForbidden               // у пользователя нет прав на операцию.
+	KindUnavailable             // хранилище временно недоступно или не успело ответить.
+	KindNotActive               // срок действия объекта еще не наступил.
+)
+
+// String - возвращает машиночитаемое название вида ошибки.
+func (k Kind) String() string {
+	switch k {
+	case KindNotFound:
+		return "not_found"
+	case KindGone:
+		return "gone"
+	case KindConflict:
+		return "conflict"
+	case KindInvalid:
+		return "invalid"
+	case KindForbidden:
+		return "forbidden"
+	case KindUnavailable:
+		return "unavailable"
+	case KindNotActive:
+		return "not_active"
+	}
+	return "internal"
+}
+
+// Error - типизированная ошибка сервиса.
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+// NewError - конструктор ошибки вида kind с сообщением message.
+func NewError(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Wrap - оборачивает ошибку err в ошибку вида kind, сохраняя ее для errors.Is и errors.As.
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Error - возвращает текст ошибки.
+func (e *Error) Error() string {
+	switch {
+	case e.Message != "" && e.Err != nil:
+		return e.Message + ": " + e.Err.Error()
+	case e.Err != nil:
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap - возвращает обернутую ошибку.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf - возвращает вид ошибки. Ошибки без вида классифицируются по известным ошибкам контекста и базы данных,
+// остальные считаются внутренними.
+func KindOf(err error) Kind {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.Kind
+	case errors.Is(err, sql.ErrNoRows):
+		return KindNotFound
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled), errors.Is(err, driver.ErrBadConn):
+		return KindUnavailable
+	}
+	return KindInternal
+}
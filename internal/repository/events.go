@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/events"
+)
+
+// Option - функция, применяемая к хранилищу при его создании.
+type Option func(*notifier)
+
+// WithEvents - публикует события URL пользователей в шину bus.
+func WithEvents(bus *events.Bus) Option {
+	return func(n *notifier) {
+		n.bus = bus
+	}
+}
+
+// notifier - публикация событий хранилища в шину, встраивается в хранилища. Без шины события не публикуются.
+type notifier struct {
+	bus *events.Bus
+}
+
+// created - публикует событие создания URL.
+func (n notifier) created(hash string, link URL) {
+	n.bus.Publish(events.Event{Type: events.Created, UserID: link.UserID, Code: hash, URL: link.FURL, Time: link.CreatedAt})
+}
+
+// deleted - публикует событие удаления URL.
+func (n notifier) deleted(hash string, userID string) {
+	n.bus.Publish(events.Event{Type: events.Deleted, UserID: userID, Code: hash})
+}
+
+// clicked - публикует событие перехода по URL и, если переход исчерпал лимит переходов, событие окончания действия.
+func (n notifier) clicked(hash string, userID string, variant string, clicks int, maxClicks int) {
+	n.bus.Publish(events.Event{Type: events.Clicked, UserID: userID, Code: hash, Variant: variant})
+	if maxClicks > 0 && clicks >= maxClicks {
+		n.bus.Publish(events.Event{Type: events.Expired, UserID: userID, Code: hash, Reason: events.ReasonClicks})
+	}
+}
+
+// WatchExpired - каждые interval публикует в шину bus события окончания срока действия URL, пока не отменен ctx.
+// Окончание срока действия ничем не вызывается, поэтому хранилище проверяется периодически.
+func WatchExpired(ctx context.Context, s Storager, bus *events.Bus, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	from := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case to := <-ticker.C:
+			links, err := s.ExpiredLinks(ctx, from, to)
+			if err != nil {
+				// Период не сдвигается, события опубликуются при следующей проверке.
+				log.Printf("watch expired URLs: %v", err)
+				continue
+			}
+			for _, link := range links {
+				bus.Publish(events.Event{Type: events.Expired, UserID: link.UserID, Code: link.Hash,
+					Reason: events.ReasonSchedule, Time: *link.NotAfter})
+			}
+			from = to
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+)
+
+const (
+	// privateHashSize - количество случайных байт в идентификаторе приватного URL (128 бит).
+	privateHashSize = 16
+	// hashSize - количество байт в идентификаторе публичного URL.
+	hashSize = md5.Size / 5
+	// maxHashAttempts - количество попыток сгенерировать свободный идентификатор URL.
+	maxHashAttempts = 10
+)
+
+// newHash - генерирует идентификатор сокращенного URL. Идентификатор публичного URL вычисляется по URL и пользователю,
+// идентификатор приватного URL - длинный случайный, чтобы его нельзя было подобрать перебором. Идентификатор
+// остальных URL, которые не выдаются при сокращении того же адреса (см. LinkOptions.Shared), - случайный.
+func newHash(fullURL string, userID string, opts LinkOptions) (string, error) {
+	switch {
+	case opts.Private:
+		return randomHash(privateHashSize)
+	case !opts.Shared():
+		return randomHash(hashSize)
+	}
+	hasher := md5.Sum([]byte(fullURL + userID))
+	return hex.EncodeToString(hasher[:hashSize]), nil
+}
+
+// randomHash - генерирует случайный идентификатор сокращенного URL из size байт.
+func randomHash(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// insertHash - сохраняет URL функцией save с идентификатором, сгенерированным newHash, и возвращает идентификатор.
+// Если идентификатор занят (save возвращает ErrAliasExists), то пробует случайные идентификаторы.
+func insertHash(fullURL string, userID string, opts LinkOptions, save func(hash string) error) (string, error) {
+	size := hashSize
+	if opts.Private {
+		size = privateHashSize
+	}
+	hash, err := newHash(fullURL, userID, opts)
+	for i := 1; err == nil; i++ {
+		err = save(hash)
+		if !errors.Is(err, ErrAliasExists) {
+			break
+		}
+		if i == maxHashAttempts {
+			return "", ErrNoFreeHash
+		}
+		hash, err = randomHash(size)
+	}
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
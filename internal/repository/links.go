@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ErrSharedURL - ошибка, показывающая, что адрес URL нельзя изменить: идентификатор публичного URL выдается всем
+// пользователям, сократившим тот же адрес.
+var ErrSharedURL error = NewError(KindConflict, "destination of a public generated URL can't be changed, use a private URL or a custom code")
+
+// Link - ресурс сокращенного URL в REST API v2.
+type Link struct {
+	Code        string     `json:"code"`
+	ShortURL    string     `json:"short_url"`
+	Destination string     `json:"destination"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Deleted     bool       `json:"deleted"`
+	Clicks      int        `json:"clicks"`
+	Tags        []string   `json:"tags"`
+}
+
+// Link - возвращает ресурс REST API v2 для записи URL с сокращенным URL shortURL.
+func (n NodeURL) Link(shortURL string) Link {
+	tags := n.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return Link{
+		Code:        n.Hash,
+		ShortURL:    shortURL,
+		Destination: n.FURL,
+		CreatedAt:   knownTime(n.CreatedAt),
+		UpdatedAt:   knownTime(n.UpdatedAt),
+		ExpiresAt:   n.NotAfter,
+		Deleted:     n.Delete,
+		Clicks:      n.Clicks,
+		Tags:        tags,
+	}
+}
+
+// knownTime - возвращает время t или nil, если оно неизвестно (например, у URL, созданных до учета времени создания).
+func knownTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// LinkInput - тело запроса создания URL в REST API v2. Если code задан, то он становится идентификатором URL.
+type LinkInput struct {
+	Destination string     `json:"destination"`
+	Code        string     `json:"code,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Private     bool       `json:"private,omitempty"`
+}
+
+// Options - возвращает настройки сокращенного URL, переданные в запросе.
+func (i LinkInput) Options() LinkOptions {
+	return LinkOptions{
+		NotAfter: i.ExpiresAt,
+		Tags:     i.Tags,
+		Private:  i.Private,
+	}
+}
+
+// OptionalTime - поле времени в запросе изменения: Set сообщает, что поле передано, а nil Time - что передан null.
+type OptionalTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+// UnmarshalJSON - реализует json.Unmarshaler, отмечая поле переданным, в том числе со значением null.
+func (t *OptionalTime) UnmarshalJSON(b []byte) error {
+	t.Set = true
+	t.Time = nil
+	return json.Unmarshal(b, &t.Time)
+}
+
+// LinkUpdate - тело запроса изменения URL в REST API v2. Изменяются только переданные поля,
+// expires_at со значением null снимает ограничение срока действия.
+type LinkUpdate struct {
+	Destination *string      `json:"destination,omitempty"`
+	Tags        *[]string    `json:"tags,omitempty"`
+	ExpiresAt   OptionalTime `json:"expires_at"`
+}
+
+// apply - применяет изменения к записи URL в момент now и проверяет ее настройки.
+// Адрес можно изменить только у приватного URL или URL с идентификатором, заданным пользователем.
+func (u LinkUpdate) apply(link *URL, now time.Time) error {
+	if u.Destination != nil && *u.Destination != link.FURL {
+		if strings.TrimSpace(*u.Destination) == "" {
+			return ErrEmptyInsert
+		}
+		if !link.Private && !link.Alias {
+			return ErrSharedURL
+		}
+		link.FURL = *u.Destination
+	}
+	if u.Tags != nil {
+		link.Tags = append([]string(nil), *u.Tags...)
+	}
+	if u.ExpiresAt.Set {
+		link.NotAfter = u.ExpiresAt.Time
+	}
+	if err := link.LinkOptions.Validate(); err != nil {
+		return err
+	}
+	link.UpdatedAt = now
+	return nil
+}
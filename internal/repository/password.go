@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HashPassword - возвращает bcrypt хэш пароля сокращенного URL.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Protected - сообщает, защищен ли сокращенный URL паролем.
+func (o LinkOptions) Protected() bool {
+	return o.PasswordHash != ""
+}
+
+// CheckPassword - проверяет пароль сокращенного URL. Для URL без пароля всегда возвращает true.
+func (o LinkOptions) CheckPassword(password string) bool {
+	if !o.Protected() {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(o.PasswordHash), []byte(password)) == nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+)
+
+// Способы разрешения конфликта, когда добавляемый параметр запроса уже есть в адресе перенаправления.
+const (
+	QueryConflictKeep     = "keep"     // сохраняется значение из адреса перенаправления.
+	QueryConflictOverride = "override" // значение заменяется добавляемым.
+	QueryConflictAppend   = "append"   // сохраняются оба значения.
+)
+
+// UTM - шаблон UTM меток, автоматически добавляемых к адресу перенаправления.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+}
+
+// values - возвращает заданные UTM метки в виде параметров запроса.
+func (u *UTM) values() url.Values {
+	v := make(url.Values)
+	if u == nil {
+		return v
+	}
+	if u.Source != "" {
+		v.Set("utm_source", u.Source)
+	}
+	if u.Medium != "" {
+		v.Set("utm_medium", u.Medium)
+	}
+	if u.Campaign != "" {
+		v.Set("utm_campaign", u.Campaign)
+	}
+	return v
+}
+
+// IsQueryConflict - сообщает, является ли значение допустимым способом разрешения конфликта параметров запроса.
+func IsQueryConflict(conflict string) bool {
+	switch conflict {
+	case QueryConflictKeep, QueryConflictOverride, QueryConflictAppend:
+		return true
+	}
+	return false
+}
+
+// Location - формирует адрес перенаправления по URL: дополняет адрес destination без схемы схемой по умолчанию,
+// добавляет путь suffix (режим wildcard), UTM метки и, если включен режим passthrough, параметры входящего запроса
+// incoming. Конфликты параметров разрешаются способом, заданным для URL, иначе способом conflict из конфигурации.
+// Используется и HTTP, и gRPC сервером.
+func (o LinkOptions) Location(destination string, suffix string, incoming url.Values, conflict string) string {
+	if !strings.HasPrefix(destination, config.HTTP) && !strings.HasPrefix(destination, "https://") {
+		destination = config.HTTP + strings.TrimPrefix(destination, "//")
+	}
+	merged, err := appendSuffix(destination, suffix)
+	if err == nil {
+		merged, err = o.MergeQuery(merged, incoming, o.queryConflict(conflict))
+	}
+	if err != nil {
+		// Адрес, который не удалось разобрать, отдаем без изменений.
+		return destination
+	}
+	return merged
+}
+
+// queryConflict - возвращает способ разрешения конфликтов параметров запроса для URL: заданный при создании
+// или глобальный conflict из конфигурации.
+func (o LinkOptions) queryConflict(conflict string) string {
+	if o.QueryConflict != "" {
+		return o.QueryConflict
+	}
+	if IsQueryConflict(conflict) {
+		return conflict
+	}
+	return config.QueryConflict
+}
+
+// appendSuffix - добавляет экранированный путь suffix к пути адреса перенаправления.
+func appendSuffix(destination string, suffix string) (string, error) {
+	if suffix == "" {
+		return destination, nil
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + suffix
+	path, err := url.PathUnescape(escaped)
+	if err != nil {
+		return "", err
+	}
+	u.Path, u.RawPath = path, escaped
+	return u.String(), nil
+}
+
+// MergeQuery - дополняет адрес перенаправления UTM метками URL и, если включен режим passthrough,
+// параметрами входящего запроса. Конфликты параметров разрешаются способом conflict.
+func (o LinkOptions) MergeQuery(destination string, incoming url.Values, conflict string) (string, error) {
+	utm := o.UTM.values()
+	if len(utm) == 0 && (!o.Passthrough || len(incoming) == 0) {
+		return destination, nil
+	}
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	mergeValues(query, utm, conflict)
+	if o.Passthrough {
+		mergeValues(query, incoming, conflict)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// mergeValues - добавляет параметры add в query, разрешая конфликты способом conflict.
+func mergeValues(query url.Values, add url.Values, conflict string) {
+	for key, values := range add {
+		existing, ok := query[key]
+		if !ok {
+			query[key] = append([]string(nil), values...)
+			continue
+		}
+		switch conflict {
+		case QueryConflictOverride:
+			query[key] = append([]string(nil), values...)
+		case QueryConflictAppend:
+			query[key] = append(existing, values...)
+		}
+	}
+}
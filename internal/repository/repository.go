@@ -2,12 +2,12 @@ package repository
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"errors"
 	"io"
 	"log"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
 )
@@ -16,14 +16,18 @@ import (
 type Storage struct {
 	Data        map[string]URL
 	FileRecover *FileRecover
+	notifier
 	sync.RWMutex
 }
 
 // NewStorage - функция-конструктор in-memory хранилища,возвращает интерфейс.
-func NewStorage(c *config.Config) Storager {
+func NewStorage(c *config.Config, options ...Option) Storager {
 	s := &Storage{
 		Data: make(map[string]URL),
 	}
+	for _, opt := range options {
+		opt(&s.notifier)
+	}
 
 	// Проверяем задан ли FILE_STORAGE_PATH, если да, то восстанавливаем данные оттуда.
 	err := s.LoadRecoveryStorage(c.StoragePath)
@@ -38,22 +42,26 @@ func NewStorage(c *config.Config) Storager {
 
 // InsertURL - метод ,который генерирует hash для ключа,передает hash+url+userid хранилищу,возвращает сокращенный url.
 func (s *Storage) InsertURL(ctx context.Context, fullURL string, userID string) (string, error) {
-	// Генерируем hash .
-	hasher := md5.Sum([]byte(fullURL + userID))
-	hash := hex.EncodeToString(hasher[:len(hasher)/5])
-	// Проверяем есть ли в хранилище такой url.
-	okHash, err := s.GetShortURL(ctx, fullURL)
-	// Если нет, то вставляем новые данные.
-	if err != nil {
-		err = s.saveData(ctx, fullURL, userID, hash)
-		if err != nil {
-			return "", err
+	return s.InsertLink(ctx, fullURL, userID, LinkOptions{})
+}
+
+// InsertLink - метод, аналогичный InsertURL, но сохраняющий вместе с URL его дополнительные настройки.
+func (s *Storage) InsertLink(ctx context.Context, fullURL string, userID string, opts LinkOptions) (string, error) {
+	// Проверяем настройки.
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	// Публичный URL, который уже есть в хранилище, возвращаем вместе с ошибкой. Остальные URL (см. LinkOptions.Shared)
+	// сохраняем отдельно, не выдавая чужие идентификаторы и не теряя настройки.
+	if opts.Shared() {
+		if okHash, err := s.GetShortURL(ctx, fullURL); err == nil {
+			return okHash, ErrConflictInsert
 		}
-		// Возвращаем сгенерированный hash.
-		return hash, nil
 	}
-	// Если есть, возвращаем hash и ошибку.
-	return okHash, ErrConflictInsert
+	// Генерируем hash и сохраняем данные.
+	return insertHash(fullURL, userID, opts, func(hash string) error {
+		return s.saveData(ctx, fullURL, userID, hash, opts)
+	})
 }
 
 // GetCountUsers - возвращает количество пользователей в БД.
@@ -79,7 +87,7 @@ func (s *Storage) GetShortURL(_ context.Context, fullURL string) (string, error)
 	s.RLock()
 	defer s.RUnlock()
 	for hash, value := range s.Data {
-		if value.FURL == fullURL && !value.Delete {
+		if value.FURL == fullURL && !value.Delete && value.Shared() {
 			return hash, nil
 		}
 	}
@@ -103,32 +111,141 @@ func (s *Storage) GetFullURL(_ context.Context, shortURL string) (string, error)
 	return "", ErrNotFoundURL
 }
 
-// InsertURL - метод,заполняющий хранилище данными(полный url, id пользователя, hash).
-func (s *Storage) saveData(_ context.Context, fullURL string, userid string, hash string) error {
+// GetLink - метод, возвращающий сохраненную запись сокращенного URL вместе с ее настройками.
+func (s *Storage) GetLink(_ context.Context, shortURL string) (URL, error) {
+	s.RLock()
+	defer s.RUnlock()
+	val, ok := s.Data[shortURL]
+	if !ok {
+		return URL{}, ErrNotFoundURL
+	}
+	if val.Delete {
+		return URL{}, ErrDeletedURL
+	}
+	if val.Exhausted() {
+		return URL{}, ErrExhaustedURL
+	}
+	return val, nil
+}
+
+// Click - метод, учитывающий переход по сокращенному URL и, если задан, по его варианту.
+// Проверка лимита переходов и увеличение счетчика выполняются атомарно под блокировкой хранилища.
+func (s *Storage) Click(_ context.Context, shortURL string, variant string) error {
+	s.Lock()
+	defer s.Unlock()
+	val, ok := s.Data[shortURL]
+	if !ok {
+		return ErrNotFoundURL
+	}
+	if val.Delete {
+		return ErrDeletedURL
+	}
+	if val.Exhausted() {
+		return ErrExhaustedURL
+	}
+	val.Clicks++
+	if variant != "" {
+		// Счетчики вариантов копируем, так как ранее выданные записи URL ссылаются на прежнюю карту.
+		variantClicks := make(map[string]int, len(val.VariantClicks)+1)
+		for k, v := range val.VariantClicks {
+			variantClicks[k] = v
+		}
+		variantClicks[variant]++
+		val.VariantClicks = variantClicks
+	}
+	s.Data[shortURL] = val
+	s.clicked(shortURL, val.UserID, variant, val.Clicks, val.MaxClicks)
+	// Счетчик URL с лимитом переходов сохраняем в резервное хранилище, чтобы лимит не сбрасывался при перезапуске.
+	if s.FileRecover != nil && val.MaxClicks > 0 {
+		return s.FileRecover.Writer.Write(val.node(shortURL))
+	}
+	return nil
+}
+
+// SetVariants - метод, заменяющий варианты URL для A/B тестирования. Изменить варианты может только владелец URL.
+func (s *Storage) SetVariants(_ context.Context, shortURL string, userID string, variants []Variant) error {
+	if err := validateVariants(variants); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	val, ok := s.Data[shortURL]
+	if !ok || val.Delete {
+		return ErrNotFoundURL
+	}
+	if val.UserID != userID {
+		return ErrNotOwnerURL
+	}
+	val.Variants = variants
+	val.UpdatedAt = time.Now()
+	s.Data[shortURL] = val
+	if s.FileRecover != nil {
+		return s.FileRecover.Writer.Write(val.node(shortURL))
+	}
+	return nil
+}
+
+// GetLinkStats - метод, возвращающий статистику переходов по URL и его вариантам. Доступен только владельцу URL.
+func (s *Storage) GetLinkStats(_ context.Context, shortURL string, userID string) (LinkStats, error) {
+	s.RLock()
+	defer s.RUnlock()
+	val, ok := s.Data[shortURL]
+	if !ok || val.Delete {
+		return LinkStats{}, ErrNotFoundURL
+	}
+	if val.UserID != userID {
+		return LinkStats{}, ErrNotOwnerURL
+	}
+	return val.stats(val.VariantClicks), nil
+}
+
+// saveData - метод,заполняющий хранилище данными(полный url, id пользователя, hash, настройки).
+func (s *Storage) saveData(ctx context.Context, fullURL string, userid string, hash string, opts LinkOptions) error {
 	// Проверяем полученные данные.
 	if fullURL == "" || fullURL == " " || userid == "" || userid == " " || hash == "" || hash == " " {
-		return errors.New("ErrNoEmptyInsert")
+		return ErrEmptyInsert
+	}
+	// Не сохраняем URL, если операция уже отменена.
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 	// Блокируем хранилище на время операции.
 	s.Lock()
 	defer s.Unlock()
-	// Записываем данные в хранилище.
-	s.Data[hash] = URL{
-		UserID: userid,
-		FURL:   fullURL,
-		Delete: false,
+	// Занятый идентификатор не заменяется.
+	if _, ok := s.Data[hash]; ok {
+		return ErrAliasExists
+	}
+	return s.create(hash, URL{
+		UserID:      userid,
+		FURL:        fullURL,
+		Delete:      false,
+		CreatedAt:   time.Now(),
+		LinkOptions: opts,
+	})
+}
+
+// create - записывает новый сокращенный URL и публикует событие его создания. Вызывается под блокировкой хранилища.
+func (s *Storage) create(hash string, link URL) error {
+	if err := s.store(hash, link); err != nil {
+		return err
+	}
+	s.created(hash, link)
+	return nil
+}
+
+// store - записывает сокращенный URL в хранилище и резервное хранилище. Вызывается под блокировкой хранилища.
+func (s *Storage) store(hash string, link URL) error {
+	// Новая запись считается измененной в момент создания.
+	if link.UpdatedAt.IsZero() {
+		link.UpdatedAt = link.CreatedAt
 	}
+	// Записываем данные в хранилище.
+	s.Data[hash] = link
 	// Если FILE_STORAGE_PATH выставлен, нто записывает данные в резервное хранилище.
 	if s.FileRecover != nil {
-		// Готовим структуру для резервного хранилища.
-		URLItem := NodeURL{
-			Hash:   hash,
-			FURL:   fullURL,
-			UserID: userid,
-			Delete: false,
-		}
 		// Записываем.
-		err := s.FileRecover.Writer.Write(&URLItem)
+		err := s.FileRecover.Writer.Write(link.node(hash))
 		if err != nil {
 			return err
 		}
@@ -136,6 +253,67 @@ func (s *Storage) saveData(_ context.Context, fullURL string, userid string, has
 	return nil
 }
 
+// InsertAlias - метод, сохраняющий URL с идентификатором alias, заданным пользователем.
+// Возвращает ErrAliasExists, если идентификатор уже занят, в том числе удаленным URL.
+func (s *Storage) InsertAlias(ctx context.Context, alias string, fullURL string, userID string, opts LinkOptions) error {
+	// Проверяем идентификатор и настройки.
+	if err := ValidateAlias(alias); err != nil {
+		return err
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if fullURL == "" || fullURL == " " || userID == "" || userID == " " {
+		return ErrEmptyInsert
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Проверка и запись выполняются под одной блокировкой, чтобы идентификатор не заняли одновременно.
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.Data[alias]; ok {
+		return ErrAliasExists
+	}
+	opts.Alias = true
+	return s.create(alias, URL{
+		UserID:      userID,
+		FURL:        fullURL,
+		CreatedAt:   time.Now(),
+		LinkOptions: opts,
+	})
+}
+
+// ImportURL - метод, сохраняющий URL из другого сервиса сокращения URL, возвращает его идентификатор.
+// Исходный идентификатор сохраняется, если он допустим, иначе генерируется новый. Занятый идентификатор
+// не заменяется, а возвращается ErrAliasExists, поэтому повторный импорт не создает копий URL.
+func (s *Storage) ImportURL(ctx context.Context, link ImportedURL) (string, error) {
+	hash, err := link.hash()
+	if err != nil {
+		return "", err
+	}
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.Data[hash]; ok {
+		return "", ErrAliasExists
+	}
+	link.LinkOptions.Alias = true
+	err = s.create(hash, URL{
+		UserID:      link.UserID,
+		FURL:        link.FURL,
+		Clicks:      link.Clicks,
+		CreatedAt:   link.CreatedAt,
+		LinkOptions: link.LinkOptions,
+	})
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
 // LoadRecoveryStorage - метод, восстанавливающий данные из резервного хранилища при инициализации in-memory.
 func (s *Storage) LoadRecoveryStorage(str string) error {
 	// Выполняем проверку текущей конфигурации.
@@ -161,11 +339,19 @@ func (s *Storage) LoadRecoveryStorage(str string) error {
 		if err != nil {
 			return err
 		}
-		// Вставляем считанные данные.
+		// Вставляем считанные данные, у записей без времени изменения им считается время создания.
+		if node.UpdatedAt.IsZero() {
+			node.UpdatedAt = node.CreatedAt
+		}
 		s.Data[node.Hash] = URL{
-			UserID: node.UserID,
-			FURL:   node.FURL,
-			Delete: node.Delete,
+			UserID:        node.UserID,
+			FURL:          node.FURL,
+			Delete:        node.Delete,
+			Clicks:        node.Clicks,
+			CreatedAt:     node.CreatedAt,
+			UpdatedAt:     node.UpdatedAt,
+			LinkOptions:   node.LinkOptions,
+			VariantClicks: node.VariantClicks,
 		}
 	}
 	return nil
@@ -185,41 +371,114 @@ func (s *Storage) GetAllUserURLs(_ context.Context, userid string) ([]SlicedURL,
 			result = append(result, SlicedURL{
 				Short: hash,
 				Full:  url.FURL,
+				Tags:  url.Tags,
+				Alias: url.Alias,
 			})
 		}
 	}
 	// Если записи не найдены возвращаем ошибку.
 	if len(result) == 0 {
-		return nil, errors.New("ErrNotExistUserURLs")
+		return nil, ErrNoUserURLs
 	}
 	// Иначе возвращаем массив.
 	return result, nil
 }
 
+// GetUserLinks - метод, возвращающий все записи URL пользователя, упорядоченные по времени создания.
+// Удаленные URL возвращаются, если задан deleted. Если URL нет, то возвращается пустой массив.
+func (s *Storage) GetUserLinks(_ context.Context, userID string, deleted bool) ([]NodeURL, error) {
+	s.RLock()
+	defer s.RUnlock()
+	result := make([]NodeURL, 0)
+	for hash, url := range s.Data {
+		if url.UserID == userID && (deleted || !url.Delete) {
+			result = append(result, *url.node(hash))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].Hash < result[j].Hash
+	})
+	return result, nil
+}
+
+// GetUserLink - метод, возвращающий запись URL, в том числе удаленного. Доступен только владельцу URL.
+func (s *Storage) GetUserLink(_ context.Context, shortURL string, userID string) (NodeURL, error) {
+	s.RLock()
+	defer s.RUnlock()
+	val, ok := s.Data[shortURL]
+	if !ok {
+		return NodeURL{}, ErrNotFoundURL
+	}
+	if val.UserID != userID {
+		return NodeURL{}, ErrNotOwnerURL
+	}
+	return *val.node(shortURL), nil
+}
+
+// UpdateLink - метод, изменяющий адрес, метки и срок действия URL, возвращает измененную запись.
+// Изменить URL может только его владелец, удаленный URL не изменяется.
+func (s *Storage) UpdateLink(ctx context.Context, shortURL string, userID string, update LinkUpdate) (NodeURL, error) {
+	if err := ctx.Err(); err != nil {
+		return NodeURL{}, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	val, ok := s.Data[shortURL]
+	if !ok {
+		return NodeURL{}, ErrNotFoundURL
+	}
+	if val.UserID != userID {
+		return NodeURL{}, ErrNotOwnerURL
+	}
+	if val.Delete {
+		return NodeURL{}, ErrDeletedURL
+	}
+	if err := update.apply(&val, time.Now()); err != nil {
+		return NodeURL{}, err
+	}
+	if err := s.store(shortURL, val); err != nil {
+		return NodeURL{}, err
+	}
+	return *val.node(shortURL), nil
+}
+
+// ExpiredLinks - метод, возвращающий неудаленные URL, срок действия которых закончился после from и не позже to.
+func (s *Storage) ExpiredLinks(_ context.Context, from time.Time, to time.Time) ([]NodeURL, error) {
+	s.RLock()
+	defer s.RUnlock()
+	result := make([]NodeURL, 0)
+	for hash, url := range s.Data {
+		if !url.Delete && url.NotAfter != nil && url.NotAfter.After(from) && !url.NotAfter.After(to) {
+			result = append(result, *url.node(hash))
+		}
+	}
+	return result, nil
+}
+
 // Delete - метод, который данные помечает как удаленные по их hash(идентификатор).
-func (s *Storage) Delete(_ context.Context, hashes []string, userID string) error {
+func (s *Storage) Delete(ctx context.Context, hashes []string, userID string) error {
 	// Блокируем хранилище на время выполнения операции.
 	s.Lock()
 	defer s.Unlock()
 	// Проверяем что userID URL в базе данных с таким hash соответствует userID, сделавшему запрос.
 	for _, hash := range hashes {
-		if s.Data[hash].UserID == userID {
+		// Прерываем удаление, если операция отменена.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if val, ok := s.Data[hash]; ok && val.UserID == userID && !val.Delete {
 			// Применяем изменения.
-			s.Data[hash] = URL{
-				UserID: userID,
-				FURL:   s.Data[hash].FURL,
-				Delete: true,
-			}
+			val.Delete = true
+			val.UpdatedAt = time.Now()
+			s.Data[hash] = val
+			s.deleted(hash, userID)
 			// Если задан файл для резервного хранения, то пишем так же туда.
 			if s.FileRecover != nil {
-				URLItem := NodeURL{
-					Hash:   hash,
-					FURL:   s.Data[hash].FURL,
-					UserID: userID,
-					Delete: true,
-				}
 				// Записываем.
-				err := s.FileRecover.Writer.Write(&URLItem)
+				err := s.FileRecover.Writer.Write(val.node(hash))
 				if err != nil {
 					return err
 				}
@@ -2,9 +2,18 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gtgaleevtimur/reduction-url-service/internal/config"
+	"github.com/gtgaleevtimur/reduction-url-service/internal/events"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -72,11 +81,11 @@ func TestStorage_InsertURL(t *testing.T) {
 			cnf := config.NewConfig()
 			db := NewStorage(cnf)
 			if !tt.wantErr {
-				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash)
+				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash, LinkOptions{})
 				require.NoError(t, err)
 			}
 			if tt.wantErr {
-				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash)
+				err := db.saveData(context.Background(), tt.fullURL, tt.userID, tt.hash, LinkOptions{})
 				require.ErrorContains(t, err, "ErrNoEmptyInsert")
 			}
 		})
@@ -128,6 +137,509 @@ func TestStorage_GetFullURL(t *testing.T) {
 	}
 }
 
+func TestStorage_GetLink(t *testing.T) {
+	t.Run("Positive test", func(t *testing.T) {
+		cnf := config.NewConfig()
+		db := NewStorage(cnf)
+		hash, err := db.InsertLink(context.Background(), "http://test.test/test", "ASDfdSsWq",
+			LinkOptions{RedirectCode: 301})
+		require.NoError(t, err)
+		got, err := db.GetLink(context.Background(), hash)
+		require.NoError(t, err)
+		assert.Equal(t, 301, got.RedirectCode)
+		assert.Equal(t, "http://test.test/test", got.FURL)
+		err = db.Delete(context.Background(), []string{hash}, "ASDfdSsWq")
+		require.NoError(t, err)
+		_, err = db.GetLink(context.Background(), hash)
+		assert.ErrorIs(t, err, ErrDeletedURL)
+	})
+	t.Run("Negative invalid redirect code", func(t *testing.T) {
+		cnf := config.NewConfig()
+		db := NewStorage(cnf)
+		_, err := db.InsertLink(context.Background(), "http://test.test/test", "ASDfdSsWq",
+			LinkOptions{RedirectCode: 200})
+		assert.ErrorIs(t, err, ErrInvalidRedirectCode)
+	})
+}
+
+func TestFullURL_Options(t *testing.T) {
+	t.Run("Password is hashed", func(t *testing.T) {
+		opts, err := FullURL{Full: "http://test.test/test", Password: "qwerty"}.Options()
+		require.NoError(t, err)
+		assert.True(t, opts.Protected())
+		assert.NotEqual(t, "qwerty", opts.PasswordHash)
+		assert.True(t, opts.CheckPassword("qwerty"))
+		assert.False(t, opts.CheckPassword("wrong"))
+	})
+	t.Run("Without password", func(t *testing.T) {
+		opts, err := FullURL{Full: "http://test.test/test"}.Options()
+		require.NoError(t, err)
+		assert.False(t, opts.Protected())
+		assert.True(t, opts.CheckPassword(""))
+	})
+}
+
+func TestStorage_Click(t *testing.T) {
+	t.Run("Concurrent clicks do not exceed limit", func(t *testing.T) {
+		cnf := config.NewConfig()
+		db := NewStorage(cnf)
+		hash, err := db.InsertLink(context.Background(), "http://test.test/invite", "ASDfdSsWq",
+			LinkOptions{MaxClicks: 5})
+		require.NoError(t, err)
+		var wg sync.WaitGroup
+		var success int32
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if db.Click(context.Background(), hash, "") == nil {
+					atomic.AddInt32(&success, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(5), success)
+		err = db.Click(context.Background(), hash, "")
+		assert.ErrorIs(t, err, ErrExhaustedURL)
+		_, err = db.GetLink(context.Background(), hash)
+		assert.ErrorIs(t, err, ErrExhaustedURL)
+	})
+	t.Run("Negative not exist", func(t *testing.T) {
+		cnf := config.NewConfig()
+		db := NewStorage(cnf)
+		err := db.Click(context.Background(), "notIsShortURL", "")
+		assert.ErrorIs(t, err, ErrNotFoundURL)
+	})
+	t.Run("Negative invalid max clicks", func(t *testing.T) {
+		cnf := config.NewConfig()
+		db := NewStorage(cnf)
+		_, err := db.InsertLink(context.Background(), "http://test.test/test", "ASDfdSsWq", LinkOptions{MaxClicks: -1})
+		assert.ErrorIs(t, err, ErrInvalidMaxClicks)
+	})
+}
+
+func TestStorage_SetVariants(t *testing.T) {
+	cnf := config.NewConfig()
+	db := NewStorage(cnf)
+	hash, err := db.InsertURL(context.Background(), "http://test.test/landing", "ASDfdSsWq")
+	require.NoError(t, err)
+	variants := []Variant{
+		{ID: "a", URL: "http://test.test/landing-a", Weight: 3},
+		{ID: "b", URL: "http://test.test/landing-b", Weight: 1},
+	}
+	t.Run("Positive", func(t *testing.T) {
+		err := db.SetVariants(context.Background(), hash, "ASDfdSsWq", variants)
+		require.NoError(t, err)
+		require.NoError(t, db.Click(context.Background(), hash, "a"))
+		require.NoError(t, db.Click(context.Background(), hash, "a"))
+		require.NoError(t, db.Click(context.Background(), hash, "b"))
+		stats, err := db.GetLinkStats(context.Background(), hash, "ASDfdSsWq")
+		require.NoError(t, err)
+		assert.Equal(t, LinkStats{Clicks: 3, Variants: []VariantStats{
+			{Variant: variants[0], Clicks: 2},
+			{Variant: variants[1], Clicks: 1},
+		}}, stats)
+	})
+	t.Run("Negative not owner", func(t *testing.T) {
+		err := db.SetVariants(context.Background(), hash, "another", variants)
+		assert.ErrorIs(t, err, ErrNotOwnerURL)
+		_, err = db.GetLinkStats(context.Background(), hash, "another")
+		assert.ErrorIs(t, err, ErrNotOwnerURL)
+	})
+	t.Run("Negative invalid variants", func(t *testing.T) {
+		err := db.SetVariants(context.Background(), hash, "ASDfdSsWq", []Variant{
+			{ID: "a", URL: "http://test.test/landing-a", Weight: 1},
+			{ID: "a", URL: "http://test.test/landing-b", Weight: 1},
+		})
+		assert.ErrorIs(t, err, ErrInvalidVariant)
+		err = db.SetVariants(context.Background(), hash, "ASDfdSsWq", []Variant{{ID: "a", URL: "http://test.test", Weight: 0}})
+		assert.ErrorIs(t, err, ErrInvalidVariant)
+	})
+	t.Run("Negative not exist", func(t *testing.T) {
+		err := db.SetVariants(context.Background(), "notIsShortURL", "ASDfdSsWq", variants)
+		assert.ErrorIs(t, err, ErrNotFoundURL)
+	})
+}
+
+func TestLinkOptions_PickVariant(t *testing.T) {
+	opts := LinkOptions{Variants: []Variant{
+		{ID: "a", URL: "http://test.test/landing-a", Weight: 1},
+		{ID: "b", URL: "http://test.test/landing-b", Weight: 3},
+	}}
+	picked := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		picked[opts.PickVariant().ID]++
+	}
+	assert.Equal(t, 1000, picked["a"]+picked["b"])
+	assert.Greater(t, picked["b"], picked["a"])
+}
+
+func TestLinkOptions_MergeQuery(t *testing.T) {
+	incoming := url.Values{"ref": {"newsletter"}, "utm_source": {"twitter"}}
+	tests := []struct {
+		name     string
+		opts     LinkOptions
+		conflict string
+		want     string
+	}{
+		{
+			name: "Without options",
+			want: "http://test.test/landing?ref=site",
+		},
+		{
+			name: "UTM template",
+			opts: LinkOptions{UTM: &UTM{Source: "newsletter", Campaign: "spring"}},
+			want: "http://test.test/landing?ref=site&utm_campaign=spring&utm_source=newsletter",
+		},
+		{
+			name:     "Passthrough keep",
+			opts:     LinkOptions{Passthrough: true},
+			conflict: QueryConflictKeep,
+			want:     "http://test.test/landing?ref=site&utm_source=twitter",
+		},
+		{
+			name:     "Passthrough override",
+			opts:     LinkOptions{Passthrough: true},
+			conflict: QueryConflictOverride,
+			want:     "http://test.test/landing?ref=newsletter&utm_source=twitter",
+		},
+		{
+			name:     "Passthrough append with UTM",
+			opts:     LinkOptions{Passthrough: true, UTM: &UTM{Source: "email"}},
+			conflict: QueryConflictAppend,
+			want:     "http://test.test/landing?ref=site&ref=newsletter&utm_source=email&utm_source=twitter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.MergeQuery("http://test.test/landing?ref=site", incoming, tt.conflict)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	t.Run("Negative invalid conflict", func(t *testing.T) {
+		err := LinkOptions{QueryConflict: "merge"}.Validate()
+		assert.ErrorIs(t, err, ErrInvalidQueryConflict)
+	})
+}
+
+func TestStorage_InsertLinkPrivate(t *testing.T) {
+	cnf := config.NewConfig()
+	db := NewStorage(cnf)
+	private, err := db.InsertLink(context.Background(), "http://test.test/private", "ASDfdSsWq", LinkOptions{Private: true})
+	require.NoError(t, err)
+	assert.Len(t, private, privateHashSize*2)
+	another, err := db.InsertLink(context.Background(), "http://test.test/private", "ASDfdSsWq", LinkOptions{Private: true})
+	require.NoError(t, err)
+	assert.NotEqual(t, private, another)
+	// Публичный URL с тем же адресом не должен раскрывать идентификатор приватного.
+	public, err := db.InsertURL(context.Background(), "http://test.test/private", "another")
+	require.NoError(t, err)
+	assert.NotEqual(t, private, public)
+	assert.NotEqual(t, another, public)
+	link, err := db.GetLink(context.Background(), private)
+	require.NoError(t, err)
+	assert.True(t, link.Private)
+}
+
+func TestStorage_InsertLinkOptions(t *testing.T) {
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+	tests := []struct {
+		name string
+		opts LinkOptions
+	}{
+		{name: "Password", opts: LinkOptions{PasswordHash: "hash"}},
+		{name: "MaxClicks", opts: LinkOptions{MaxClicks: 1}},
+		{name: "NotBefore", opts: LinkOptions{NotBefore: &notBefore}},
+		{name: "NotAfter", opts: LinkOptions{NotAfter: &notAfter}},
+		{name: "FallbackURL", opts: LinkOptions{FallbackURL: "http://test.test/fallback"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewStorage(config.NewConfig())
+			ctx := context.Background()
+			fullURL := "http://test.test/options"
+			// URL с настройками не заменяется уже сохраненным публичным URL с тем же адресом.
+			public, err := db.InsertURL(ctx, fullURL, "user1")
+			require.NoError(t, err)
+			withOptions, err := db.InsertLink(ctx, fullURL, "user1", tt.opts)
+			require.NoError(t, err)
+			assert.NotEqual(t, public, withOptions)
+			link, err := db.GetLink(ctx, withOptions)
+			require.NoError(t, err)
+			assert.False(t, link.Shared())
+			// Публичный URL не выдает идентификатор URL с настройками.
+			again, err := db.InsertURL(ctx, fullURL, "user2")
+			assert.ErrorIs(t, err, ErrConflictInsert)
+			assert.Equal(t, public, again)
+			other := "http://test.test/options-first"
+			withOptions, err = db.InsertLink(ctx, other, "user1", tt.opts)
+			require.NoError(t, err)
+			public, err = db.InsertURL(ctx, other, "user2")
+			require.NoError(t, err)
+			assert.NotEqual(t, withOptions, public)
+			link, err = db.GetLink(ctx, public)
+			require.NoError(t, err)
+			assert.True(t, link.Shared())
+			// Тот же пользователь может сократить адрес с теми же настройками еще раз.
+			second, err := db.InsertLink(ctx, other, "user1", tt.opts)
+			require.NoError(t, err)
+			assert.NotEqual(t, withOptions, second)
+		})
+	}
+}
+
+func TestStorage_InsertAlias(t *testing.T) {
+	cnf := config.NewConfig()
+	db := NewStorage(cnf)
+	public, err := db.InsertURL(context.Background(), "http://test.test/alias", "ASDfdSsWq")
+	require.NoError(t, err)
+	// URL с заданным идентификатором сохраняется отдельно от публичного URL с тем же адресом.
+	err = db.InsertAlias(context.Background(), "my-alias", "http://test.test/alias", "ASDfdSsWq", LinkOptions{Tags: []string{"a", "b"}})
+	require.NoError(t, err)
+	link, err := db.GetLink(context.Background(), "my-alias")
+	require.NoError(t, err)
+	assert.True(t, link.Alias)
+	assert.Equal(t, []string{"a", "b"}, link.Tags)
+	hash, err := db.GetShortURL(context.Background(), "http://test.test/alias")
+	require.NoError(t, err)
+	assert.Equal(t, public, hash)
+	// Занятый, недопустимый или зарезервированный идентификатор не сохраняется.
+	err = db.InsertAlias(context.Background(), "my-alias", "http://test.test/other", "another", LinkOptions{})
+	assert.ErrorIs(t, err, ErrAliasExists)
+	err = db.InsertAlias(context.Background(), "my alias", "http://test.test/other", "another", LinkOptions{})
+	assert.ErrorIs(t, err, ErrInvalidAlias)
+	err = db.InsertAlias(context.Background(), "api", "http://test.test/other", "another", LinkOptions{})
+	assert.ErrorIs(t, err, ErrInvalidAlias)
+	err = db.InsertAlias(context.Background(), "tags", "http://test.test/other", "another", LinkOptions{Tags: []string{""}})
+	assert.ErrorIs(t, err, ErrInvalidTags)
+}
+
+func TestStorage_UpdateLink(t *testing.T) {
+	cnf := config.NewConfig()
+	db := NewStorage(cnf)
+	ctx := context.Background()
+	public, err := db.InsertURL(ctx, "http://test.test/update", "owner")
+	require.NoError(t, err)
+	err = db.InsertAlias(ctx, "update-alias", "http://test.test/update", "owner", LinkOptions{})
+	require.NoError(t, err)
+	created, err := db.GetUserLink(ctx, "update-alias", "owner")
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+	// Изменяются только переданные поля.
+	destination, expires := "http://test.test/updated", time.Now().Add(time.Hour).UTC()
+	updated, err := db.UpdateLink(ctx, "update-alias", "owner", LinkUpdate{
+		Destination: &destination,
+		ExpiresAt:   OptionalTime{Set: true, Time: &expires},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, destination, updated.FURL)
+	assert.Equal(t, &expires, updated.NotAfter)
+	assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt))
+	tags := []string{"news"}
+	updated, err = db.UpdateLink(ctx, "update-alias", "owner", LinkUpdate{Tags: &tags, ExpiresAt: OptionalTime{Set: true}})
+	require.NoError(t, err)
+	assert.Equal(t, destination, updated.FURL)
+	assert.Equal(t, tags, updated.Tags)
+	assert.Nil(t, updated.NotAfter)
+	// Адрес публичного URL, который выдается всем пользователям, не изменяется.
+	_, err = db.UpdateLink(ctx, public, "owner", LinkUpdate{Destination: &destination})
+	assert.ErrorIs(t, err, ErrSharedURL)
+	_, err = db.UpdateLink(ctx, "update-alias", "another", LinkUpdate{Tags: &tags})
+	assert.ErrorIs(t, err, ErrNotOwnerURL)
+	_, err = db.UpdateLink(ctx, "missing", "owner", LinkUpdate{Tags: &tags})
+	assert.ErrorIs(t, err, ErrNotFoundURL)
+	// Удаленный URL возвращается в списке только по запросу и не изменяется.
+	require.NoError(t, db.Delete(ctx, []string{public}, "owner"))
+	_, err = db.UpdateLink(ctx, public, "owner", LinkUpdate{Tags: &tags})
+	assert.ErrorIs(t, err, ErrDeletedURL)
+	links, err := db.GetUserLinks(ctx, "owner", false)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, "update-alias", links[0].Hash)
+	links, err = db.GetUserLinks(ctx, "owner", true)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+	links, err = db.GetUserLinks(ctx, "nobody", true)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func TestNodeURL_Link(t *testing.T) {
+	// У URL, сохраненных до учета времени создания, время создания и изменения неизвестно.
+	b, err := json.Marshal(NodeURL{Hash: "legacy", FURL: "http://test.test/legacy"}.Link("http://localhost:8080/legacy"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"created_at":null,"updated_at":null`)
+	created := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	link := NodeURL{Hash: "new", CreatedAt: created, UpdatedAt: created}.Link("http://localhost:8080/new")
+	require.NotNil(t, link.CreatedAt)
+	assert.Equal(t, created, *link.CreatedAt)
+}
+
+func TestStorage_Events(t *testing.T) {
+	cnf := config.NewConfig()
+	bus := events.NewBus()
+	db := NewStorage(cnf, WithEvents(bus))
+	ctx := context.Background()
+	_, err := db.InsertLink(ctx, "http://test.test/public", "owner", LinkOptions{})
+	require.NoError(t, err)
+	sub, _ := bus.Subscribe("owner", 0)
+	defer sub.Close()
+	hash, err := db.InsertLink(ctx, "http://test.test/events", "owner", LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	// Повторное сокращение и удаление уже удаленного URL событий не создают.
+	_, err = db.InsertLink(ctx, "http://test.test/public", "another", LinkOptions{})
+	require.ErrorIs(t, err, ErrConflictInsert)
+	require.NoError(t, db.Click(ctx, hash, ""))
+	require.NoError(t, db.Delete(ctx, []string{hash}, "owner"))
+	require.NoError(t, db.Delete(ctx, []string{hash}, "owner"))
+	for _, want := range []events.Event{
+		{Type: events.Created, Code: hash, URL: "http://test.test/events"},
+		{Type: events.Clicked, Code: hash},
+		{Type: events.Expired, Code: hash, Reason: events.ReasonClicks},
+		{Type: events.Deleted, Code: hash},
+	} {
+		e := <-sub.C
+		assert.Equal(t, want.Type, e.Type)
+		assert.Equal(t, want.Code, e.Code)
+		assert.Equal(t, want.URL, e.URL)
+		assert.Equal(t, want.Reason, e.Reason)
+	}
+	assert.Empty(t, sub.C)
+}
+
+func TestWatchExpired(t *testing.T) {
+	cnf := config.NewConfig()
+	bus := events.NewBus()
+	db := NewStorage(cnf)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, _ := bus.Subscribe("owner", 0)
+	defer sub.Close()
+	notAfter := time.Now().Add(50 * time.Millisecond)
+	hash, err := db.InsertLink(ctx, "http://test.test/watch", "owner", LinkOptions{NotAfter: &notAfter})
+	require.NoError(t, err)
+	go WatchExpired(ctx, db, bus, 10*time.Millisecond)
+	select {
+	case e := <-sub.C:
+		assert.Equal(t, events.Expired, e.Type)
+		assert.Equal(t, hash, e.Code)
+		assert.Equal(t, events.ReasonSchedule, e.Reason)
+	case <-time.After(time.Second):
+		t.Fatal("expired event is not published")
+	}
+	links, err := db.ExpiredLinks(ctx, notAfter.Add(-time.Second), notAfter)
+	require.NoError(t, err)
+	assert.Len(t, links, 1)
+}
+
+func TestParseTags(t *testing.T) {
+	assert.Equal(t, []string{"work", "news", "go"}, ParseTags(" work, news;go;;work "))
+	assert.Nil(t, ParseTags(" , "))
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "de", want: "de"},
+		{header: "en;q=0.5, fr-CH, fr;q=0.9", want: "fr-CH"},
+		{header: "ru;q=0, en;q=0.1", want: "en"},
+		{header: "*", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, preferredLanguage(tt.header))
+		})
+	}
+}
+
+func TestLinkOptions_CheckSchedule(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+	tests := []struct {
+		name string
+		opts LinkOptions
+		err  error
+	}{
+		{name: "Without schedule", opts: LinkOptions{}, err: nil},
+		{name: "Active", opts: LinkOptions{NotBefore: &before, NotAfter: &after}, err: nil},
+		{name: "Not active yet", opts: LinkOptions{NotBefore: &after}, err: ErrNotActiveURL},
+		{name: "Expired", opts: LinkOptions{NotAfter: &before}, err: ErrExpiredURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.opts.CheckSchedule(now), tt.err)
+		})
+	}
+	t.Run("Negative invalid schedule", func(t *testing.T) {
+		err := LinkOptions{NotBefore: &after, NotAfter: &before}.Validate()
+		assert.ErrorIs(t, err, ErrInvalidSchedule)
+	})
+}
+
+func TestRedirectRule_Match(t *testing.T) {
+	night := time.Date(2023, 1, 1, 23, 30, 0, 0, time.UTC)
+	day := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		rule RedirectRule
+		rc   RuleContext
+		want bool
+	}{
+		{
+			name: "Mobile matches iOS",
+			rule: RedirectRule{Device: DeviceMobile, URL: "http://m.test"},
+			rc:   RuleContext{Device: DeviceIOS, Now: day},
+			want: true,
+		},
+		{
+			name: "Language prefix",
+			rule: RedirectRule{Language: "en", URL: "http://en.test"},
+			rc:   RuleContext{Language: "en-GB", Now: day},
+			want: true,
+		},
+		{
+			name: "Night interval through midnight",
+			rule: RedirectRule{From: "22:00", To: "06:00", URL: "http://night.test"},
+			rc:   RuleContext{Now: night},
+			want: true,
+		},
+		{
+			name: "Day is not in night interval",
+			rule: RedirectRule{From: "22:00", To: "06:00", URL: "http://night.test"},
+			rc:   RuleContext{Now: day},
+			want: false,
+		},
+		{
+			name: "All conditions required",
+			rule: RedirectRule{Device: DeviceAndroid, Language: "ru", URL: "http://ru.android.test"},
+			rc:   RuleContext{Device: DeviceAndroid, Language: "en", Now: day},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.rule.Validate())
+			assert.Equal(t, tt.want, tt.rule.Match(tt.rc))
+		})
+	}
+	t.Run("Negative invalid rules", func(t *testing.T) {
+		for _, rule := range []RedirectRule{
+			{URL: "http://test.test"},
+			{Device: "tv", URL: "http://test.test"},
+			{From: "25:00", To: "06:00", URL: "http://test.test"},
+			{Language: "en"},
+		} {
+			assert.ErrorIs(t, LinkOptions{Rules: []RedirectRule{rule}}.Validate(), ErrInvalidRule)
+		}
+	})
+}
+
 func TestStorage_GetShortURL(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -225,6 +737,32 @@ func TestStorage_Delete(t *testing.T) {
 		err = db.Delete(context.Background(), []string{hash}, userID)
 		require.NoError(t, err)
 	})
+	t.Run("Canceled", func(t *testing.T) {
+		userID := "ASDfdSsWq"
+		cnf := config.NewConfig()
+		db := NewStorage(cnf)
+		hash, err := db.InsertURL(context.Background(), "http://test.test/canceled", userID)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, db.Delete(ctx, []string{hash}, userID), context.Canceled)
+		_, err = db.GetLink(context.Background(), hash)
+		require.NoError(t, err)
+		_, err = db.InsertURL(ctx, "http://test.test/canceled-insert", userID)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	ctx, cancel = WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
 }
 
 func TestStorage_Ping(t *testing.T) {
@@ -294,3 +832,30 @@ func TestMapStorage_LoadRecoveryStorage(t *testing.T) {
 	})
 }
 */
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{name: "Not found", err: ErrNotFoundURL, want: KindNotFound},
+		{name: "Gone", err: ErrExpiredURL, want: KindGone},
+		{name: "Conflict", err: ErrConflictInsert, want: KindConflict},
+		{name: "Invalid", err: ErrInvalidRule, want: KindInvalid},
+		{name: "Forbidden", err: ErrNotOwnerURL, want: KindForbidden},
+		{name: "Wrapped", err: fmt.Errorf("insert: %w", ErrEmptyInsert), want: KindInvalid},
+		{name: "No rows", err: sql.ErrNoRows, want: KindNotFound},
+		{name: "Deadline", err: context.DeadlineExceeded, want: KindUnavailable},
+		{name: "Explicit kind", err: Wrap(KindUnavailable, errors.New("connection refused")), want: KindUnavailable},
+		{name: "Unknown", err: errors.New("boom"), want: KindInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, KindOf(tt.err))
+		})
+	}
+	// Ошибки с видом сохраняют идентичность для errors.Is.
+	assert.True(t, errors.Is(fmt.Errorf("get: %w", ErrDeletedURL), ErrDeletedURL))
+	assert.Equal(t, "connection refused", Wrap(KindUnavailable, errors.New("connection refused")).Error())
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Типы устройств, поддерживаемые в правилах перенаправления.
+const (
+	DeviceIOS     string = "ios"     // iPhone, iPad, iPod.
+	DeviceAndroid string = "android" // устройства Android.
+	DeviceMobile  string = "mobile"  // любые мобильные устройства, включая iOS и Android.
+	DeviceDesktop string = "desktop" // остальные устройства.
+)
+
+// maxRules - максимальное количество правил перенаправления у одного URL.
+const maxRules = 20
+
+// RedirectRule - правило условного перенаправления. Условия правила объединяются по И,
+// пустое условие не проверяется.
+type RedirectRule struct {
+	Device   string `json:"device,omitempty"`
+	Language string `json:"language,omitempty"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	URL      string `json:"url"`
+}
+
+// RuleContext - сведения о запросе, по которым проверяются правила перенаправления.
+type RuleContext struct {
+	Device   string
+	Language string
+	Now      time.Time
+}
+
+// NewRuleContext - собирает сведения для проверки правил перенаправления по значениям заголовков User-Agent
+// и Accept-Language запроса (в gRPC - метаданных user-agent и accept-language) в момент времени now.
+func NewRuleContext(userAgent string, acceptLanguage string, now time.Time) RuleContext {
+	return RuleContext{
+		Device:   deviceFromUserAgent(userAgent),
+		Language: preferredLanguage(acceptLanguage),
+		Now:      now,
+	}
+}
+
+// deviceFromUserAgent - определяет тип устройства пользователя по заголовку User-Agent.
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return DeviceIOS
+	case strings.Contains(ua, "android"):
+		return DeviceAndroid
+	case strings.Contains(ua, "mobile"), strings.Contains(ua, "windows phone"):
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
+
+// preferredLanguage - возвращает наиболее предпочтительный язык пользователя из заголовка Accept-Language.
+func preferredLanguage(acceptLanguage string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+	languages := make([]language, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			quality = v
+		}
+		if quality <= 0 {
+			continue
+		}
+		languages = append(languages, language{tag: tag, quality: quality})
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+	// Сортировка устойчивая, чтобы при равном весе сохранить порядок из заголовка.
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+// Validate - проверяет корректность правила перенаправления.
+func (r RedirectRule) Validate() error {
+	if r.URL == "" {
+		return ErrInvalidRule
+	}
+	if r.Device == "" && r.Language == "" && r.From == "" && r.To == "" {
+		return ErrInvalidRule
+	}
+	switch r.Device {
+	case "", DeviceIOS, DeviceAndroid, DeviceMobile, DeviceDesktop:
+	default:
+		return ErrInvalidRule
+	}
+	if (r.From == "") != (r.To == "") {
+		return ErrInvalidRule
+	}
+	if r.From != "" {
+		if _, err := time.Parse("15:04", r.From); err != nil {
+			return ErrInvalidRule
+		}
+		if _, err := time.Parse("15:04", r.To); err != nil {
+			return ErrInvalidRule
+		}
+	}
+	if _, err := time.LoadLocation(r.Timezone); err != nil {
+		return ErrInvalidRule
+	}
+	return nil
+}
+
+// Match - проверяет, выполняются ли условия правила для запроса.
+func (r RedirectRule) Match(rc RuleContext) bool {
+	if r.Device != "" && !matchDevice(r.Device, rc.Device) {
+		return false
+	}
+	if r.Language != "" && !matchLanguage(r.Language, rc.Language) {
+		return false
+	}
+	if r.From != "" && !r.matchTime(rc.Now) {
+		return false
+	}
+	return true
+}
+
+// matchTime - проверяет, попадает ли время суток в интервал правила. Интервал может переходить через полночь.
+func (r RedirectRule) matchTime(now time.Time) bool {
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return false
+	}
+	from, err := time.Parse("15:04", r.From)
+	if err != nil {
+		return false
+	}
+	to, err := time.Parse("15:04", r.To)
+	if err != nil {
+		return false
+	}
+	now = now.In(loc)
+	minute := now.Hour()*60 + now.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// matchDevice - проверяет соответствие устройства пользователя устройству правила.
+func matchDevice(rule string, device string) bool {
+	if rule == DeviceMobile {
+		return device == DeviceMobile || device == DeviceIOS || device == DeviceAndroid
+	}
+	return rule == device
+}
+
+// matchLanguage - проверяет соответствие языка пользователя языку правила.
+// Язык правила "en" соответствует языкам "en", "en-US" и т.д.
+func matchLanguage(rule string, language string) bool {
+	rule = strings.ToLower(rule)
+	language = strings.ToLower(language)
+	return language == rule || strings.HasPrefix(language, rule+"-")
+}
+
+// MatchRule - возвращает первое выполнившееся для запроса правило перенаправления URL.
+func (o LinkOptions) MatchRule(rc RuleContext) (RedirectRule, bool) {
+	for _, rule := range o.Rules {
+		if rule.Match(rc) {
+			return rule, true
+		}
+	}
+	return RedirectRule{}, false
+}
@@ -5,12 +5,13 @@ import (
 )
 
 // NewDataSource - функция-хэлпер, выбирающая вид хранилища для текущей конфигурации.
-func NewDataSource() (result Storager, err error) {
+// Настройки options применяются к выбранному хранилищу.
+func NewDataSource(options ...Option) (result Storager, err error) {
 	// Конфигурация приложения через считывание флагов и переменных окружения.
 	conf := config.NewConfig(config.WithParseEnv())
 	if conf.DatabaseDSN != "" {
-		return NewDatabaseDSN(conf)
+		return NewDatabaseDSN(conf, options...)
 	} else {
-		return NewStorage(conf), nil
+		return NewStorage(conf, options...), nil
 	}
 }
@@ -2,16 +2,37 @@ package repository
 
 import (
 	"context"
-	"errors"
+	"net/http"
+	"time"
 )
 
+// WithTimeout - возвращает контекст операции с хранилищем, производный от ctx и ограниченный временем timeout.
+// Если timeout не задан, то операция ограничена только отменой ctx.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
 // Storager - интерфейс хранилища.
 type Storager interface {
 	GetShortURL(ctx context.Context, fullURL string) (string, error)
 	GetFullURL(ctx context.Context, shortURL string) (string, error)
-	saveData(ctx context.Context, fullURL string, userid string, hash string) error
+	GetLink(ctx context.Context, shortURL string) (URL, error)
+	saveData(ctx context.Context, fullURL string, userid string, hash string, opts LinkOptions) error
 	InsertURL(ctx context.Context, fURL string, userID string) (string, error)
+	InsertLink(ctx context.Context, fURL string, userID string, opts LinkOptions) (string, error)
+	InsertAlias(ctx context.Context, alias string, fURL string, userID string, opts LinkOptions) error
+	ImportURL(ctx context.Context, link ImportedURL) (string, error)
+	Click(ctx context.Context, shortURL string, variant string) error
+	SetVariants(ctx context.Context, shortURL string, userID string, variants []Variant) error
+	GetLinkStats(ctx context.Context, shortURL string, userID string) (LinkStats, error)
 	GetAllUserURLs(ctx context.Context, userid string) ([]SlicedURL, error)
+	GetUserLinks(ctx context.Context, userID string, deleted bool) ([]NodeURL, error)
+	GetUserLink(ctx context.Context, shortURL string, userID string) (NodeURL, error)
+	UpdateLink(ctx context.Context, shortURL string, userID string, update LinkUpdate) (NodeURL, error)
+	ExpiredLinks(ctx context.Context, from time.Time, to time.Time) ([]NodeURL, error)
 	Delete(ctx context.Context, hashes []string, userID string) error
 	Ping(ctx context.Context) error
 	GetCountURL(ctx context.Context) (int, error)
@@ -20,22 +41,197 @@ type Storager interface {
 
 // NodeURL - сущность сокращенного URL, использующаяся в логике резервного хранилища.
 type NodeURL struct {
-	Hash   string `json:"hash"`
-	FURL   string `json:"original_url"`
-	UserID string `json:"user_id"`
-	Delete bool   `json:"is_deleted"`
+	Hash      string    `json:"hash"`
+	FURL      string    `json:"original_url"`
+	UserID    string    `json:"user_id"`
+	Delete    bool      `json:"is_deleted"`
+	Clicks    int       `json:"clicks,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	LinkOptions
+	VariantClicks map[string]int `json:"variant_clicks,omitempty"`
 }
 
 // URL - сущность URL, использующаяся для записи в хэш-таблице по hash-ключу сокращенного URL.
 type URL struct {
-	UserID string `json:"userid"`
-	FURL   string `json:"original_url"`
-	Delete bool   `json:"is_deleted"`
+	UserID    string    `json:"userid"`
+	FURL      string    `json:"original_url"`
+	Delete    bool      `json:"is_deleted"`
+	Clicks    int       `json:"clicks"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	LinkOptions
+	VariantClicks map[string]int `json:"variant_clicks,omitempty"`
+}
+
+// Exhausted - сообщает, исчерпан ли лимит переходов по сокращенному URL.
+func (u URL) Exhausted() bool {
+	return u.MaxClicks > 0 && u.Clicks >= u.MaxClicks
+}
+
+// node - возвращает запись резервного хранилища для сокращенного URL.
+func (u URL) node(hash string) *NodeURL {
+	return &NodeURL{
+		Hash:          hash,
+		FURL:          u.FURL,
+		UserID:        u.UserID,
+		Delete:        u.Delete,
+		Clicks:        u.Clicks,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+		LinkOptions:   u.LinkOptions,
+		VariantClicks: u.VariantClicks,
+	}
+}
+
+// ImportedURL - URL, перенесенный из другого сервиса сокращения URL вместе с его идентификатором,
+// датой создания и количеством переходов.
+type ImportedURL struct {
+	Code      string
+	FURL      string
+	UserID    string
+	CreatedAt time.Time
+	Clicks    int
+	LinkOptions
+}
+
+// LinkOptions - дополнительные настройки сокращенного URL, задаваемые при его создании.
+type LinkOptions struct {
+	RedirectCode int            `json:"redirect_code,omitempty"`
+	PasswordHash string         `json:"password_hash,omitempty"`
+	MaxClicks    int            `json:"max_clicks,omitempty"`
+	NotBefore    *time.Time     `json:"not_before,omitempty"`
+	NotAfter     *time.Time     `json:"not_after,omitempty"`
+	FallbackURL  string         `json:"fallback_url,omitempty"`
+	Rules        []RedirectRule `json:"rules,omitempty"`
+	Variants     []Variant      `json:"variants,omitempty"`
+	Passthrough  bool           `json:"passthrough,omitempty"`
+	UTM          *UTM           `json:"utm,omitempty"`
+	// Private - приватный URL с длинным случайным идентификатором, который не выдается другим пользователям.
+	Private bool `json:"private,omitempty"`
+	// Wildcard - режим, в котором путь после идентификатора сокращенного URL добавляется к адресу перенаправления.
+	Wildcard bool `json:"wildcard,omitempty"`
+	// QueryConflict - способ разрешения конфликтов параметров запроса, если не задан - используется глобальный.
+	QueryConflict string `json:"query_conflict,omitempty"`
+	// Tags - метки, по которым пользователь группирует свои URL.
+	Tags []string `json:"tags,omitempty"`
+	// Alias - URL с идентификатором, заданным пользователем. Такой URL не объединяется с другими URL с тем же адресом.
+	Alias bool `json:"alias,omitempty"`
+}
+
+// Shared - сообщает, что URL можно выдавать всем пользователям, сокращающим тот же адрес: он не приватный,
+// его идентификатор не задан пользователем, он не защищен паролем, не ограничен по числу переходов и по времени
+// действия и не имеет резервного адреса. Остальные URL сохраняются отдельно
+// со случайным идентификатором и не выдаются при сокращении того же адреса.
+func (o LinkOptions) Shared() bool {
+	return !o.Private && !o.Alias && o.PasswordHash == "" && o.MaxClicks == 0 &&
+		o.NotBefore == nil && o.NotAfter == nil && o.FallbackURL == ""
+}
+
+// Validate - проверяет корректность настроек сокращенного URL.
+func (o LinkOptions) Validate() error {
+	if o.RedirectCode != 0 && !IsRedirectCode(o.RedirectCode) {
+		return ErrInvalidRedirectCode
+	}
+	if o.MaxClicks < 0 {
+		return ErrInvalidMaxClicks
+	}
+	if o.NotBefore != nil && o.NotAfter != nil && !o.NotAfter.After(*o.NotBefore) {
+		return ErrInvalidSchedule
+	}
+	if o.QueryConflict != "" && !IsQueryConflict(o.QueryConflict) {
+		return ErrInvalidQueryConflict
+	}
+	if err := validateTags(o.Tags); err != nil {
+		return err
+	}
+	if len(o.Rules) > maxRules {
+		return ErrInvalidRule
+	}
+	for _, rule := range o.Rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return validateVariants(o.Variants)
+}
+
+// CheckSchedule - проверяет, действует ли сокращенный URL в момент now.
+// Возвращает ErrNotActiveURL до начала действия и ErrExpiredURL после его окончания.
+func (o LinkOptions) CheckSchedule(now time.Time) error {
+	if o.NotBefore != nil && now.Before(*o.NotBefore) {
+		return ErrNotActiveURL
+	}
+	if o.NotAfter != nil && !now.Before(*o.NotAfter) {
+		return ErrExpiredURL
+	}
+	return nil
+}
+
+// Cacheable - сообщает, можно ли кэшировать перенаправление по сокращенному URL.
+// Нельзя кэшировать перенаправления, результат которых зависит от проверок при каждом переходе.
+func (o LinkOptions) Cacheable() bool {
+	return !o.Protected() && o.MaxClicks == 0 && o.NotBefore == nil && o.NotAfter == nil &&
+		len(o.Rules) == 0 && len(o.Variants) == 0
+}
+
+// IsRedirectCode - сообщает, является ли код допустимым кодом перенаправления.
+func IsRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
 
 // FullURL - сущность URL, использующая для записи оригинального URL в эндпоинта POST /api/shorten принимающего JSON.
 type FullURL struct {
-	Full string `json:"url"`
+	Full         string         `json:"url"`
+	RedirectCode int            `json:"redirect_code,omitempty"`
+	Password     string         `json:"password,omitempty"`
+	MaxClicks    int            `json:"max_clicks,omitempty"`
+	NotBefore    *time.Time     `json:"not_before,omitempty"`
+	NotAfter     *time.Time     `json:"not_after,omitempty"`
+	FallbackURL  string         `json:"fallback_url,omitempty"`
+	Rules        []RedirectRule `json:"rules,omitempty"`
+	Variants     []Variant      `json:"variants,omitempty"`
+	Passthrough  bool           `json:"passthrough,omitempty"`
+	UTM          *UTM           `json:"utm,omitempty"`
+	Wildcard     bool           `json:"wildcard,omitempty"`
+	Private      bool           `json:"private,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+
+	QueryConflict string `json:"query_conflict,omitempty"`
+}
+
+// Options - возвращает настройки сокращенного URL, переданные в запросе.
+// Пароль, если он задан, сохраняется в виде bcrypt хэша.
+func (f FullURL) Options() (LinkOptions, error) {
+	opts := LinkOptions{
+		RedirectCode: f.RedirectCode,
+		MaxClicks:    f.MaxClicks,
+		NotBefore:    f.NotBefore,
+		NotAfter:     f.NotAfter,
+		FallbackURL:  f.FallbackURL,
+		Rules:        f.Rules,
+		Variants:     f.Variants,
+		Passthrough:  f.Passthrough,
+		UTM:          f.UTM,
+		Wildcard:     f.Wildcard,
+		Private:      f.Private,
+		Tags:         f.Tags,
+
+		QueryConflict: f.QueryConflict,
+	}
+	if f.Password != "" {
+		hash, err := HashPassword(f.Password)
+		if err != nil {
+			return LinkOptions{}, err
+		}
+		opts.PasswordHash = hash
+	}
+	return opts, nil
 }
 
 // ShortURL - сущность URL, использующая для ответа сокращенного URL в эндпоинта POST /api/shorten принимающего JSON.
@@ -45,8 +241,11 @@ type ShortURL struct {
 
 // SlicedURL - сущность URL, использующаяся для формирования ответа с массивом всех сохраненных пользователем URL.
 type SlicedURL struct {
-	Short string `json:"short_url" db:"hash"`
-	Full  string `json:"original_url" db:"url"`
+	Short string   `json:"short_url" db:"hash"`
+	Full  string   `json:"original_url" db:"url"`
+	Tags  []string `json:"tags,omitempty" db:"tags"`
+	// Alias - идентификатор URL задан пользователем, в ответе API не передается.
+	Alias bool `json:"-" db:"alias"`
 }
 
 // FullBatch - сущность URL, использующаяся для записи массива с URL в эндпоинте POST /api/shorten/batch.
@@ -68,16 +267,55 @@ type StatStruct struct {
 }
 
 // ErrConflictInsert - ошибка, показывающая, что сохраняемый URL уже есть в базе данных.
-var ErrConflictInsert error = errors.New("URL is exist")
+var ErrConflictInsert error = NewError(KindConflict, "URL is exist")
+
+// ErrNoFreeHash - ошибка, показывающая, что не удалось сгенерировать свободный идентификатор URL.
+var ErrNoFreeHash error = NewError(KindUnavailable, "no free short URL id, try again")
 
 // ErrNotFoundURL - ошибка,показывающая , что запрашиваемый URL нет в базе данных.
-var ErrNotFoundURL error = errors.New("URL not found in DB")
+var ErrNotFoundURL error = NewError(KindNotFound, "URL not found in DB")
 
 // ErrDeletedURL - ошибка,показывающая , что запрашиваемый URL нет удален из БД.
-var ErrDeletedURL error = errors.New("URL is delete")
+var ErrDeletedURL error = NewError(KindGone, "URL is delete")
+
+// ErrExhaustedURL - ошибка, показывающая, что лимит переходов по URL исчерпан.
+var ErrExhaustedURL error = NewError(KindGone, "URL clicks limit is exhausted")
+
+// ErrInvalidMaxClicks - ошибка, показывающая, что лимит переходов задан неверно.
+var ErrInvalidMaxClicks error = NewError(KindInvalid, "max clicks must not be negative")
+
+// ErrNotActiveURL - ошибка, показывающая, что срок действия URL еще не наступил.
+var ErrNotActiveURL error = NewError(KindNotActive, "URL is not active yet")
+
+// ErrExpiredURL - ошибка, показывающая, что срок действия URL истек.
+var ErrExpiredURL error = NewError(KindGone, "URL is expired")
+
+// ErrInvalidSchedule - ошибка, показывающая, что окончание действия URL задано не позже его начала.
+var ErrInvalidSchedule error = NewError(KindInvalid, "not_after must be later than not_before")
+
+// ErrInvalidRule - ошибка, показывающая, что правило перенаправления задано неверно.
+var ErrInvalidRule error = NewError(KindInvalid, "redirect rule is invalid")
+
+// ErrInvalidVariant - ошибка, показывающая, что варианты URL заданы неверно.
+var ErrInvalidVariant error = NewError(KindInvalid, "URL variants are invalid")
+
+// ErrNotOwnerURL - ошибка, показывающая, что URL принадлежит другому пользователю.
+var ErrNotOwnerURL error = NewError(KindForbidden, "URL belongs to another user")
+
+// ErrInvalidQueryConflict - ошибка, показывающая, что способ разрешения конфликтов параметров запроса не поддерживается.
+var ErrInvalidQueryConflict error = NewError(KindInvalid, "query conflict mode must be keep, override or append")
+
+// ErrInvalidRedirectCode - ошибка, показывающая, что код перенаправления не поддерживается.
+var ErrInvalidRedirectCode error = NewError(KindInvalid, "redirect code is not supported")
+
+// ErrEmptyInsert - ошибка, показывающая, что для сохранения URL переданы пустые данные.
+var ErrEmptyInsert error = NewError(KindInvalid, "ErrNoEmptyInsert")
+
+// ErrNoUserURLs - ошибка, показывающая, что у пользователя нет сохраненных URL.
+var ErrNoUserURLs error = NewError(KindNotFound, "ErrNotExistUserURLs")
 
 // ErrFileStoragePathNil - ошибка, показывающая, что путь записи резервного хранилища не задан.
-var ErrFileStoragePathNil error = errors.New("err FILE_STORAGE_PATH is nil ")
+var ErrFileStoragePathNil error = NewError(KindInternal, "err FILE_STORAGE_PATH is nil ")
 
 // ErrCIDRContain - сообщает что IP пользователя не заслуживает доверия.
-var ErrCIDRContain error = errors.New("real ip not contains")
+var ErrCIDRContain error = NewError(KindForbidden, "real ip not contains")
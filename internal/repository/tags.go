@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Ограничения меток сокращенного URL.
+const (
+	maxTags      = 10 // максимальное количество меток у одного URL.
+	maxTagLength = 32 // максимальная длина метки в символах.
+)
+
+// ErrInvalidTags - ошибка, показывающая, что метки URL заданы неверно.
+var ErrInvalidTags error = NewError(KindInvalid, "tags are invalid")
+
+// validateTags - проверяет корректность списка меток URL.
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return ErrInvalidTags
+	}
+	for _, tag := range tags {
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.ContainsAny(tag, ",;") {
+			return ErrInvalidTags
+		}
+	}
+	return nil
+}
+
+// ParseTags - разбирает список меток, разделенных запятой или точкой с запятой.
+// Пустые метки и повторы отбрасываются.
+func ParseTags(s string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
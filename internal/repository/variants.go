@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"math/rand"
+)
+
+// maxVariants - максимальное количество вариантов у одного URL.
+const maxVariants = 10
+
+// Variant - вариант URL для перенаправления при A/B тестировании.
+// Трафик распределяется между вариантами пропорционально их весу.
+type Variant struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// VariantStats - статистика переходов по варианту URL.
+type VariantStats struct {
+	Variant
+	Clicks int `json:"clicks"`
+}
+
+// LinkStats - статистика переходов по сокращенному URL.
+type LinkStats struct {
+	Clicks   int            `json:"clicks"`
+	Variants []VariantStats `json:"variants"`
+}
+
+// validateVariants - проверяет корректность списка вариантов URL.
+func validateVariants(variants []Variant) error {
+	if len(variants) > maxVariants {
+		return ErrInvalidVariant
+	}
+	ids := make(map[string]bool, len(variants))
+	for _, v := range variants {
+		if v.ID == "" || v.URL == "" || v.Weight <= 0 || ids[v.ID] {
+			return ErrInvalidVariant
+		}
+		ids[v.ID] = true
+	}
+	return nil
+}
+
+// Variant - возвращает вариант URL по его идентификатору.
+func (o LinkOptions) Variant(id string) (Variant, bool) {
+	for _, v := range o.Variants {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// PickVariant - выбирает случайный вариант URL с учетом весов. У URL должен быть хотя бы один вариант.
+func (o LinkOptions) PickVariant() Variant {
+	total := 0
+	for _, v := range o.Variants {
+		total += v.Weight
+	}
+	n := rand.Intn(total)
+	for _, v := range o.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return o.Variants[len(o.Variants)-1]
+}
+
+// stats - формирует статистику переходов по URL из счетчиков вариантов.
+func (u URL) stats(variantClicks map[string]int) LinkStats {
+	result := LinkStats{
+		Clicks:   u.Clicks,
+		Variants: make([]VariantStats, 0, len(u.Variants)),
+	}
+	for _, v := range u.Variants {
+		result.Variants = append(result.Variants, VariantStats{
+			Variant: v,
+			Clicks:  variantClicks[v.ID],
+		})
+	}
+	return result
+}
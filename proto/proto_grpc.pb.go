@@ -30,6 +30,8 @@ type ShortenerClient interface {
 	GetUserURLs(ctx context.Context, in *NoParam, opts ...grpc.CallOption) (*GetUserURLsResponse, error)
 	PostJSON(ctx context.Context, in *PostJSONRespReq, opts ...grpc.CallOption) (*PostJSONRespReq, error)
 	PostBatch(ctx context.Context, in *PostBatchRequest, opts ...grpc.CallOption) (*PostBatchResponse, error)
+	Register(ctx context.Context, in *NoParam, opts ...grpc.CallOption) (*TokenResponse, error)
+	Login(ctx context.Context, in *NoParam, opts ...grpc.CallOption) (*TokenResponse, error)
 }
 
 type shortenerClient struct {
@@ -112,6 +114,24 @@ func (c *shortenerClient) PostBatch(ctx context.Context, in *PostBatchRequest, o
 	return out, nil
 }
 
+func (c *shortenerClient) Register(ctx context.Context, in *NoParam, opts ...grpc.CallOption) (*TokenResponse, error) {
+	out := new(TokenResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) Login(ctx context.Context, in *NoParam, opts ...grpc.CallOption) (*TokenResponse, error) {
+	out := new(TokenResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/Login", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility
@@ -124,6 +144,8 @@ type ShortenerServer interface {
 	GetUserURLs(context.Context, *NoParam) (*GetUserURLsResponse, error)
 	PostJSON(context.Context, *PostJSONRespReq) (*PostJSONRespReq, error)
 	PostBatch(context.Context, *PostBatchRequest) (*PostBatchResponse, error)
+	Register(context.Context, *NoParam) (*TokenResponse, error)
+	Login(context.Context, *NoParam) (*TokenResponse, error)
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -155,6 +177,12 @@ func (UnimplementedShortenerServer) PostJSON(context.Context, *PostJSONRespReq)
 func (UnimplementedShortenerServer) PostBatch(context.Context, *PostBatchRequest) (*PostBatchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method PostBatch not implemented")
 }
+func (UnimplementedShortenerServer) Register(context.Context, *NoParam) (*TokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedShortenerServer) Login(context.Context, *NoParam) (*TokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 
 // UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -312,6 +340,42 @@ func _Shortener_PostBatch_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NoParam)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Register(ctx, req.(*NoParam))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NoParam)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/Login",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Login(ctx, req.(*NoParam))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -351,6 +415,14 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PostBatch",
 			Handler:    _Shortener_PostBatch_Handler,
 		},
+		{
+			MethodName: "Register",
+			Handler:    _Shortener_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _Shortener_Login_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/proto.proto",